@@ -31,7 +31,9 @@ func handleImplicitSwitch() {
 	knownCommands := []string{
 		"init", "create", "list", "ls", "delete", "rm",
 		"current", "info", "help", "version", "completion",
-		"templates", "alias", "switch", "clone", "rename", "diff", "backup",
+		"templates", "template", "alias", "switch", "clone", "rename", "diff", "backup", "flags", "env",
+		"run", "which", "validate", "doctor", "repair", "import", "export", "undo",
+		"activate", "deactivate", "init-shell", "shim",
 	}
 
 	firstArg := os.Args[1]
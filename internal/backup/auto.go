@@ -0,0 +1,57 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+// AutoBackup backs up a profile before op changes it and returns the path of
+// the backup. enc sets whether it is encrypted. The CLI installs it as
+// config.AutoBackupFunc.
+func AutoBackup(cfg *config.Config, profile string, op config.BackupOperation, note, cdpVersion string, enc *config.ArchiveEncryption) (string, error) {
+	bm, err := NewBackupManager(cfg.GetProfilesDir())
+	if err != nil {
+		return "", err
+	}
+	bm.SetEncryption(enc)
+
+	return bm.BackupWithOptions(profile, Options{
+		Note:       note,
+		CdpVersion: cdpVersion,
+		Operation:  string(op),
+		Dedup:      cfg.BackupDedup,
+	})
+}
+
+// LastAutomatic returns the most recent automatic backup, or nil if there is
+// none
+func (bm *BackupManager) LastAutomatic() (*BackupInfo, error) {
+	backups, err := bm.List()
+	if err != nil {
+		return nil, err
+	}
+
+	// List returns the newest first
+	for i := range backups {
+		b := &backups[i]
+		if b.Encrypted && !b.HasManifest {
+			// List does not use the passphrase; whether this one is
+			// automatic is only known once it is decrypted
+			manifest, _, err := bm.readStoredManifest(b.Name, bm.keys())
+			if errors.Is(err, encryption.ErrNoKey) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", b.Name, err)
+			}
+			b.setManifest(manifest)
+		}
+		if b.Operation != "" {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
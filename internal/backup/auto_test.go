@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+func TestAutoBackup(t *testing.T) {
+	bm := setupManifestProfile(t)
+	cfg := &config.Config{ProfilesDir: bm.profilesDir}
+
+	if last, err := bm.LastAutomatic(); err != nil || last != nil {
+		t.Fatalf("LastAutomatic() = %v, %v; want none", last, err)
+	}
+
+	// Manual backups are never undone
+	if _, err := bm.Backup("work"); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	first, err := AutoBackup(cfg, "work", config.BackupBeforeTemplate, "template 'restrictive' applied", "1.0.0", nil)
+	if err != nil {
+		t.Fatalf("AutoBackup failed: %v", err)
+	}
+	second, err := AutoBackup(cfg, "work", config.BackupBeforeDelete, "", "1.0.0", nil)
+	if err != nil {
+		t.Fatalf("AutoBackup failed: %v", err)
+	}
+	if first == second {
+		t.Fatal("backups taken in the same second must not overwrite each other")
+	}
+
+	manifest, _, err := ReadManifest(first, nil)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if manifest.Operation != "template" || manifest.Note != "template 'restrictive' applied" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	last, err := bm.LastAutomatic()
+	if err != nil {
+		t.Fatalf("LastAutomatic failed: %v", err)
+	}
+	if last == nil || last.Path != second || last.Operation != "delete" {
+		t.Errorf("LastAutomatic() = %+v, want the backup before delete", last)
+	}
+
+	backups, err := bm.List()
+	if err != nil || len(backups) != 3 {
+		t.Fatalf("List() = %d backups, %v; want 3", len(backups), err)
+	}
+}
+
+func TestLastAutomatic_Passphrase(t *testing.T) {
+	bm := setupManifestProfile(t)
+	cfg := &config.Config{ProfilesDir: bm.profilesDir}
+
+	asked := 0
+	enc := &config.ArchiveEncryption{
+		Keys: &encryption.Keys{Passphrase: func(bool) (string, error) {
+			asked++
+			return "correct horse", nil
+		}},
+		RequireForCredentials: true,
+	}
+	autoPath, err := AutoBackup(cfg, "work", config.BackupBeforeDelete, "", "1.0.0", enc)
+	if err != nil {
+		t.Fatalf("AutoBackup failed: %v", err)
+	}
+
+	// List never asks for the passphrase, so it cannot tell the backup is automatic
+	bm.SetEncryption(enc)
+	backups, err := bm.List()
+	if err != nil || len(backups) != 1 || backups[0].HasManifest {
+		t.Fatalf("List() = %+v, %v", backups, err)
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+
+	last, err := bm.LastAutomatic()
+	if err != nil {
+		t.Fatalf("LastAutomatic failed: %v", err)
+	}
+	if last == nil || last.Path != autoPath || last.Operation != "delete" {
+		t.Errorf("LastAutomatic() = %+v, want the encrypted backup before delete", last)
+	}
+}
+
+func TestRestoreWithOptions_BeforeOverwrite(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	var called []string
+	opts := RestoreOptions{
+		Overwrite: true,
+		BeforeOverwrite: func(profile string) error {
+			// The existing data is still in place
+			if _, err := os.Stat(filepath.Join(bm.profilesDir, profile, "settings.json")); err != nil {
+				t.Errorf("BeforeOverwrite ran after the profile was replaced: %v", err)
+			}
+			called = append(called, profile)
+			return nil
+		},
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, opts); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	opts.Only = []string{"settings.json"}
+	opts.Overwrite = false
+	if _, err := bm.RestoreWithOptions(backupPath, opts); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	// Nothing is replaced when restoring under a new name
+	opts.Only = nil
+	opts.As = "work-copy"
+	if _, err := bm.RestoreWithOptions(backupPath, opts); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+
+	if len(called) != 2 || called[0] != "work" || called[1] != "work" {
+		t.Errorf("BeforeOverwrite calls = %v, want two for work", called)
+	}
+}
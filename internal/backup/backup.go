@@ -3,28 +3,54 @@ package backup
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+const (
+	// ArchiveExt is the extension of backups
+	ArchiveExt = ".tar.gz"
+	// SnapshotExt is the extension of dedup backups, whose files are kept
+	// as blobs
+	SnapshotExt = ".snapshot"
+	// EncryptedExt is added to the extension of encrypted backups
+	EncryptedExt = ".age"
 )
 
 // BackupManager handles profile backup and restore operations
 type BackupManager struct {
 	backupDir   string
 	profilesDir string
+	encryption  *config.ArchiveEncryption
+	storage     Storage
 }
 
 // BackupInfo contains information about a backup
 type BackupInfo struct {
 	Name        string
 	ProfileName string
-	Path        string
-	CreatedAt   time.Time
-	Size        int64
+	// Path is empty for backups that are not in a directory; see Fetch
+	Path      string
+	CreatedAt time.Time
+	Size      int64
+	Note      string
+	Operation string
+	FileCount int
+	// HasManifest is false for archives written before backups had manifests
+	HasManifest bool
+	Encrypted   bool
+	// Snapshot is set on dedup backups; Size is then only the snapshot's
+	Snapshot bool
 }
 
 // NewBackupManager creates a new backup manager
@@ -36,19 +62,73 @@ func NewBackupManager(profilesDir string) (*BackupManager, error) {
 
 	backupDir := filepath.Join(homeDir, ".cdp", "backups")
 
-	// Ensure backup directory exists
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
+	// Backups hold credentials, so only the owner may read them. Directories
+	// created by older versions are tightened too.
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create backup directory: %w", err)
 	}
+	if err := os.Chmod(backupDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to secure backup directory: %w", err)
+	}
 
 	return &BackupManager{
 		backupDir:   backupDir,
 		profilesDir: profilesDir,
+		storage:     NewDirStorage(backupDir),
 	}, nil
 }
 
+// SetStorage makes the manager keep backups in s instead of the backup
+// directory
+func (bm *BackupManager) SetStorage(s Storage) {
+	bm.storage = s
+}
+
+// Storage returns where the manager keeps backups
+func (bm *BackupManager) Storage() Storage {
+	return bm.storage
+}
+
+// SetEncryption sets when new backups are encrypted, and the keys used to
+// encrypt them and to read encrypted backups
+func (bm *BackupManager) SetEncryption(enc *config.ArchiveEncryption) {
+	bm.encryption = enc
+}
+
+// keys returns the keys used to read encrypted backups
+func (bm *BackupManager) keys() *encryption.Keys {
+	return bm.encryption.DecryptionKeys()
+}
+
+// Options controls what BackupWithOptions records
+type Options struct {
+	// Note is stored in the manifest and shown by backup list
+	Note string
+	// CdpVersion is the version of cdp writing the backup
+	CdpVersion string
+	// Operation tags automatic backups with the operation that triggered them
+	Operation string
+	// Dedup stores the files as blobs shared with other backups, and writes
+	// a snapshot listing them instead of an archive
+	Dedup bool
+}
+
 // Backup creates a backup of the specified profile
 func (bm *BackupManager) Backup(profileName string) (string, error) {
+	return bm.BackupWithOptions(profileName, Options{})
+}
+
+// BackupWithOptions creates a backup of the specified profile and returns
+// where it is kept. The archive starts with a manifest listing every file
+// with its SHA-256. It is encrypted as set by SetEncryption.
+func (bm *BackupManager) BackupWithOptions(profileName string, opts Options) (string, error) {
+	// Keep the profile from changing while it is archived
+	unlock, err := config.LockProfile(profileName)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	profilePath := filepath.Join(bm.profilesDir, profileName)
 
 	// Check if profile exists
@@ -56,28 +136,108 @@ func (bm *BackupManager) Backup(profileName string) (string, error) {
 		return "", fmt.Errorf("profile '%s' does not exist", profileName)
 	}
 
-	// Generate backup filename
-	timestamp := time.Now().Format("20060102-150405")
-	backupName := fmt.Sprintf("%s-%s.tar.gz", profileName, timestamp)
-	backupPath := filepath.Join(bm.backupDir, backupName)
+	manifest, err := buildManifest(profileName, profilePath, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
 
-	// Create backup file
-	file, err := os.Create(backupPath)
+	if opts.Dedup {
+		return bm.backupDedup(profilePath, manifest)
+	}
+
+	hasCredentials := manifest.HasCredentialFiles()
+	ext := backupExt(ArchiveExt, bm.encryption.Encrypts(hasCredentials))
+	backupName, err := bm.storeBackup(profileName, manifest.CreatedAt, ext, func(w io.Writer) error {
+		return bm.writeBackup(w, profilePath, manifest, hasCredentials)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create backup file: %w", err)
+		return "", fmt.Errorf("failed to create backup: %w", err)
 	}
-	defer file.Close()
 
+	return location(bm.storage, backupName), nil
+}
+
+// backupExt returns the extension of a backup
+func backupExt(ext string, encrypted bool) string {
+	if encrypted {
+		return ext + EncryptedExt
+	}
+	return ext
+}
+
+// storeBackup streams what write writes into the storage, named after the
+// profile and the time. A counter is added when a backup was already made in
+// the same second.
+func (bm *BackupManager) storeBackup(profileName string, createdAt time.Time, ext string, write func(io.Writer) error) (string, error) {
+	base := fmt.Sprintf("%s-%s", profileName, createdAt.Format("20060102-150405"))
+	for i := 1; ; i++ {
+		backupName := base + ext
+		if i > 1 {
+			backupName = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+
+		err := putStream(bm.storage, backupName, write)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return backupName, nil
+	}
+}
+
+// putStream stores what write writes under name, without holding it in
+// memory
+func putStream(s Storage, name string, write func(io.Writer) error) error {
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err := s.Put(name, pr)
+	// Stops the writer if Put gave up before reading everything
+	pr.Close()
+	writeErr := <-written
+
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
+	}
+	return err
+}
+
+// writeBackup writes the archive to w, encrypting it when it has to be
+func (bm *BackupManager) writeBackup(w io.Writer, profilePath string, manifest *Manifest, hasCredentials bool) error {
+	out, _, err := bm.encryption.Wrap(w, hasCredentials)
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(out, profilePath, manifest); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeArchive writes the manifest and the profile files as a tar.gz
+func writeArchive(w io.Writer, profilePath string, manifest *Manifest) error {
 	// Create gzip writer
-	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
+	gzWriter := gzip.NewWriter(w)
 
 	// Create tar writer
 	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
+
+	if err := writeManifest(tarWriter, manifest); err != nil {
+		return err
+	}
 
 	// Walk the profile directory and add files to tar
-	err = filepath.Walk(profilePath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(profilePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -93,12 +253,23 @@ func (bm *BackupManager) Backup(profileName string) (string, error) {
 			return nil
 		}
 
+		var link string
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !info.IsDir() && !info.Mode().IsRegular():
+			// Sockets and pipes cannot be archived
+			return nil
+		}
+
 		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
-		header.Name = relPath
+		header.Name = filepath.ToSlash(relPath)
 
 		// Write header
 		if err := tarWriter.WriteHeader(header); err != nil {
@@ -106,7 +277,7 @@ func (bm *BackupManager) Backup(profileName string) (string, error) {
 		}
 
 		// If it's a file, write content
-		if !info.IsDir() {
+		if info.Mode().IsRegular() {
 			file, err := os.Open(path)
 			if err != nil {
 				return err
@@ -120,172 +291,235 @@ func (bm *BackupManager) Backup(profileName string) (string, error) {
 
 		return nil
 	})
-
 	if err != nil {
-		os.Remove(backupPath) // Clean up on error
-		return "", fmt.Errorf("failed to create backup: %w", err)
+		return err
 	}
 
-	return backupPath, nil
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzWriter.Close()
 }
 
-// Restore restores a profile from a backup
-func (bm *BackupManager) Restore(backupPath string, overwrite bool) (string, error) {
-	// Open backup file
-	file, err := os.Open(backupPath)
+// List returns all available backups
+func (bm *BackupManager) List() ([]BackupInfo, error) {
+	files, err := bm.storage.List()
 	if err != nil {
-		return "", fmt.Errorf("failed to open backup file: %w", err)
+		return nil, fmt.Errorf("failed to read backups in %s: %w", bm.storage, err)
 	}
-	defer file.Close()
 
-	// Create gzip reader
-	gzReader, err := gzip.NewReader(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to read gzip: %w", err)
-	}
-	defer gzReader.Close()
+	// Reading a manifest must not ask for a passphrase, nor run its slow
+	// key derivation for every backup
+	keys := bm.keys().WithoutPassphrase()
 
-	// Create tar reader
-	tarReader := tar.NewReader(gzReader)
+	dir, _ := bm.storage.(*DirStorage)
+	backups := []BackupInfo{}
+	for _, file := range files {
+		if _, ok := trimBackupExt(file.Name); !ok {
+			continue
+		}
 
-	// Extract profile name from backup filename
-	baseName := filepath.Base(backupPath)
-	// Remove .tar.gz extension and timestamp
-	parts := strings.Split(strings.TrimSuffix(baseName, ".tar.gz"), "-")
-	if len(parts) < 3 {
-		return "", fmt.Errorf("invalid backup filename format")
+		backup := BackupInfo{
+			Name:     file.Name,
+			Size:     file.Size,
+			Snapshot: isSnapshot(file.Name),
+		}
+		if dir != nil {
+			backup.Path = dir.Path(file.Name)
+		}
+
+		manifest, encrypted, err := bm.readStoredManifest(file.Name, keys)
+		backup.Encrypted = encrypted
+		if err == nil {
+			backup.setManifest(manifest)
+		} else {
+			// Older archives, and encrypted ones without a key, only have
+			// the filename
+			profileName, createdAt, ok := parseBackupName(file.Name)
+			if !ok {
+				continue
+			}
+			backup.ProfileName = profileName
+			backup.CreatedAt = createdAt
+		}
+
+		backups = append(backups, backup)
 	}
-	// Profile name is everything except the last two parts (date-time)
-	profileName := strings.Join(parts[:len(parts)-2], "-")
 
-	profilePath := filepath.Join(bm.profilesDir, profileName)
+	// Sort by creation time (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
 
-	// Check if profile already exists
-	if _, err := os.Stat(profilePath); err == nil {
-		if !overwrite {
-			return "", fmt.Errorf("profile '%s' already exists. Use --overwrite to replace", profileName)
-		}
-		// Remove existing profile
-		if err := os.RemoveAll(profilePath); err != nil {
-			return "", fmt.Errorf("failed to remove existing profile: %w", err)
+	return backups, nil
+}
+
+func (b *BackupInfo) setManifest(manifest *Manifest) {
+	b.ProfileName = manifest.Profile
+	b.CreatedAt = manifest.CreatedAt
+	b.Note = manifest.Note
+	b.Operation = manifest.Operation
+	b.FileCount = manifest.FileCount
+	b.HasManifest = true
+}
+
+// trimBackupExt strips the extension from a backup filename and reports
+// whether the name has one
+func trimBackupExt(name string) (string, bool) {
+	for _, ext := range []string{ArchiveExt + EncryptedExt, ArchiveExt, SnapshotExt + EncryptedExt, SnapshotExt} {
+		if stem, ok := strings.CutSuffix(name, ext); ok {
+			return stem, true
 		}
 	}
+	return name, false
+}
 
-	// Create profile directory
-	if err := os.MkdirAll(profilePath, 0755); err != nil {
-		return "", fmt.Errorf("failed to create profile directory: %w", err)
+// parseBackupName extracts the profile name and creation time from a backup
+// filename of the form <profile>-YYYYMMDD-HHMMSS.tar.gz[.age], or .snapshot
+// for dedup backups
+func parseBackupName(name string) (string, time.Time, bool) {
+	stem, _ := trimBackupExt(name)
+	parts := strings.Split(stem, "-")
+	if len(parts) < 3 {
+		return "", time.Time{}, false
 	}
+	// Profile name is everything except the last two parts (date-time)
+	profileName := strings.Join(parts[:len(parts)-2], "-")
 
-	// Extract files
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			os.RemoveAll(profilePath) // Clean up on error
-			return "", fmt.Errorf("failed to read tar: %w", err)
-		}
+	timestamp := parts[len(parts)-2] + "-" + parts[len(parts)-1]
+	createdAt, _ := time.ParseInLocation("20060102-150405", timestamp, time.Local)
+
+	return profileName, createdAt, true
+}
 
-		targetPath := filepath.Join(profilePath, header.Name)
+// openBackup opens a backup file, decrypting it if it is encrypted, and
+// reports whether it is encrypted
+func openBackup(backupPath string, keys *encryption.Keys) (io.Reader, io.Closer, bool, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	return decryptBackup(file, keys)
+}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				os.RemoveAll(profilePath)
-				return "", fmt.Errorf("failed to create directory: %w", err)
-			}
-		case tar.TypeReg:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				os.RemoveAll(profilePath)
-				return "", fmt.Errorf("failed to create parent directory: %w", err)
-			}
+// decryptBackup decrypts a backup if it is encrypted, and reports whether it
+// is. file is closed when it fails.
+func decryptBackup(file io.ReadCloser, keys *encryption.Keys) (io.Reader, io.Closer, bool, error) {
+	r, encrypted, err := encryption.NewReader(file, keys)
+	if err != nil {
+		file.Close()
+		return nil, nil, encrypted, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	return r, file, encrypted, nil
+}
 
-			outFile, err := os.Create(targetPath)
-			if err != nil {
-				os.RemoveAll(profilePath)
-				return "", fmt.Errorf("failed to create file: %w", err)
-			}
+// openArchive opens a backup as a tar stream, decrypting it if it is
+// encrypted. The returned func closes it.
+func openArchive(backupPath string, keys *encryption.Keys) (*tar.Reader, func(), bool, error) {
+	r, file, encrypted, err := openBackup(backupPath, keys)
+	if err != nil {
+		return nil, nil, encrypted, err
+	}
+	return readArchive(r, file, encrypted)
+}
 
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				outFile.Close()
-				os.RemoveAll(profilePath)
-				return "", fmt.Errorf("failed to write file: %w", err)
-			}
-			outFile.Close()
-		}
+// readArchive reads a decrypted backup as a tar stream. The returned func
+// closes file.
+func readArchive(r io.Reader, file io.Closer, encrypted bool) (*tar.Reader, func(), bool, error) {
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		file.Close()
+		return nil, nil, encrypted, fmt.Errorf("failed to read gzip: %w", err)
 	}
 
-	return profileName, nil
+	return tar.NewReader(gzReader), func() {
+		gzReader.Close()
+		file.Close()
+	}, encrypted, nil
 }
 
-// List returns all available backups
-func (bm *BackupManager) List() ([]BackupInfo, error) {
-	entries, err := os.ReadDir(bm.backupDir)
+// CheckArchive reads a backup archive to the end to make sure it is intact
+func (bm *BackupManager) CheckArchive(backupPath string) error {
+	tarReader, closeArchive, _, err := bm.openBackupArchive(backupPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []BackupInfo{}, nil
-		}
-		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		return err
 	}
+	defer closeArchive()
 
-	var backups []BackupInfo
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tar.gz") {
-			continue
+	for {
+		_, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
 		}
-
-		info, err := entry.Info()
 		if err != nil {
-			continue
+			return fmt.Errorf("failed to read tar: %w", err)
 		}
-
-		// Parse profile name from filename
-		baseName := strings.TrimSuffix(entry.Name(), ".tar.gz")
-		parts := strings.Split(baseName, "-")
-		if len(parts) < 3 {
-			continue
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			return fmt.Errorf("failed to read tar: %w", err)
 		}
-		profileName := strings.Join(parts[:len(parts)-2], "-")
-
-		// Parse timestamp
-		timestamp := parts[len(parts)-2] + "-" + parts[len(parts)-1]
-		createdAt, _ := time.Parse("20060102-150405", timestamp)
-
-		backups = append(backups, BackupInfo{
-			Name:        entry.Name(),
-			ProfileName: profileName,
-			Path:        filepath.Join(bm.backupDir, entry.Name()),
-			CreatedAt:   createdAt,
-			Size:        info.Size(),
-		})
 	}
-
-	// Sort by creation time (newest first)
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].CreatedAt.After(backups[j].CreatedAt)
-	})
-
-	return backups, nil
 }
 
 // Delete removes a backup file
 func (bm *BackupManager) Delete(backupName string) error {
-	backupPath := filepath.Join(bm.backupDir, backupName)
-
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+	err := bm.storage.Delete(backupName)
+	if errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("backup '%s' does not exist", backupName)
 	}
-
-	if err := os.Remove(backupPath); err != nil {
+	if err != nil {
 		return fmt.Errorf("failed to delete backup: %w", err)
 	}
 
 	return nil
 }
 
-// GetBackupDir returns the backup directory path
+// Fetch returns the path of a backup, downloading it to a temporary
+// directory when the storage is not a directory. The returned func removes
+// the download.
+func (bm *BackupManager) Fetch(backupName string) (string, func(), error) {
+	if dir, ok := bm.storage.(*DirStorage); ok {
+		if err := checkStoredName(backupName); err != nil {
+			return "", nil, err
+		}
+		backupPath := dir.Path(backupName)
+		if _, err := os.Stat(backupPath); err != nil {
+			return "", nil, fmt.Errorf("backup '%s' does not exist", backupName)
+		}
+		return backupPath, func() {}, nil
+	}
+
+	r, err := bm.storage.Get(backupName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, fmt.Errorf("backup '%s' does not exist", backupName)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer r.Close()
+
+	// The download keeps its name, which restore notes mention
+	tmpDir, err := os.MkdirTemp(bm.backupDir, ".fetch-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	backupPath := filepath.Join(tmpDir, backupName)
+	file, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = io.Copy(file, r)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+	return backupPath, cleanup, nil
+}
+
+// GetBackupDir returns the path of the local backup directory
 func (bm *BackupManager) GetBackupDir() string {
 	return bm.backupDir
 }
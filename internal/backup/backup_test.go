@@ -3,12 +3,17 @@ package backup
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"filippo.io/age"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
 )
 
 func TestNewBackupManager(t *testing.T) {
@@ -613,3 +618,163 @@ func verifyTarGz(t *testing.T, path string, expectedFiles map[string]string) {
 		}
 	}
 }
+
+func TestCheckArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	profilesDir := filepath.Join(tmpDir, "profiles")
+
+	// Override HOME for test
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	os.MkdirAll(filepath.Join(profilesDir, "work"), 0755)
+	os.WriteFile(filepath.Join(profilesDir, "work", "settings.json"), []byte(`{"key": "value"}`), 0644)
+
+	bm, _ := NewBackupManager(profilesDir)
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	if err := bm.CheckArchive(backupPath); err != nil {
+		t.Errorf("CheckArchive() on a valid backup: %v", err)
+	}
+
+	// Truncate the archive
+	data, _ := os.ReadFile(backupPath)
+	os.WriteFile(backupPath, data[:len(data)/2], 0644)
+	if err := bm.CheckArchive(backupPath); err == nil {
+		t.Error("CheckArchive() should fail on a truncated backup")
+	}
+
+	notGzip := filepath.Join(bm.GetBackupDir(), "bad-20240101-000000.tar.gz")
+	os.WriteFile(notGzip, []byte("not an archive"), 0644)
+	if err := bm.CheckArchive(notGzip); err == nil {
+		t.Error("CheckArchive() should fail on a file that is not gzip")
+	}
+}
+
+func TestNewBackupManager_SecuresBackupDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	// Created by an older cdp
+	backupDir := filepath.Join(tmpDir, ".cdp", "backups")
+	os.MkdirAll(backupDir, 0755)
+
+	if _, err := NewBackupManager(filepath.Join(tmpDir, "profiles")); err != nil {
+		t.Fatalf("NewBackupManager failed: %v", err)
+	}
+	info, err := os.Stat(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("backup directory mode = %v, want 0700", info.Mode().Perm())
+	}
+}
+
+func TestBackupEncrypted(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.SetEncryption(&config.ArchiveEncryption{
+		Keys: &encryption.Keys{
+			Recipients: []age.Recipient{identity.Recipient()},
+			Identities: []age.Identity{identity},
+		},
+		Always: true,
+	})
+
+	backupPath, err := bm.BackupWithOptions("work", Options{Note: "encrypted"})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	if !strings.HasSuffix(backupPath, ArchiveExt+EncryptedExt) {
+		t.Errorf("backup path = %s, want the %s extension", backupPath, ArchiveExt+EncryptedExt)
+	}
+	info, _ := os.Stat(backupPath)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+	if encrypted, _ := encryption.IsEncryptedFile(backupPath); !encrypted {
+		t.Fatal("backup is not encrypted")
+	}
+
+	backups, err := bm.List()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("List() = %d backups, %v; want 1", len(backups), err)
+	}
+	if b := backups[0]; !b.Encrypted || !b.HasManifest || b.Note != "encrypted" || b.ProfileName != "work" {
+		t.Errorf("List() with the identity = %+v", b)
+	}
+
+	result, err := bm.Verify(backupPath)
+	if err != nil || !result.OK() {
+		t.Fatalf("Verify() = %+v, %v", result, err)
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "restored"}); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(bm.profilesDir, "restored", ".credentials.json"))
+	if err != nil || string(data) != `{"token": "secret"}` {
+		t.Errorf(".credentials.json = %q, %v", data, err)
+	}
+
+	// Without a key the backup is still listed, from its filename
+	bm.SetEncryption(nil)
+	backups, err = bm.List()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("List() = %d backups, %v; want 1", len(backups), err)
+	}
+	if b := backups[0]; !b.Encrypted || b.HasManifest || b.ProfileName != "work" {
+		t.Errorf("List() without a key = %+v", b)
+	}
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "locked"}); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("RestoreWithOptions() without a key = %v, want ErrNoKey", err)
+	}
+	if _, err := bm.Verify(backupPath); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("Verify() without a key = %v, want ErrNoKey", err)
+	}
+}
+
+func TestBackupRequireForCredentials(t *testing.T) {
+	bm := setupManifestProfile(t)
+	os.MkdirAll(filepath.Join(bm.profilesDir, "plain"), 0755)
+	os.WriteFile(filepath.Join(bm.profilesDir, "plain", "settings.json"), []byte("{}"), 0644)
+
+	bm.SetEncryption(&config.ArchiveEncryption{RequireForCredentials: true})
+
+	if _, err := bm.Backup("work"); !errors.Is(err, config.ErrEncryptionRequired) {
+		t.Fatalf("Backup() of a profile with credentials = %v, want ErrEncryptionRequired", err)
+	}
+	if entries, _ := os.ReadDir(bm.GetBackupDir()); len(entries) != 0 {
+		t.Errorf("a failed backup left %d file(s) behind", len(entries))
+	}
+
+	plainPath, err := bm.Backup("plain")
+	if err != nil {
+		t.Fatalf("Backup() of a profile without credentials failed: %v", err)
+	}
+	if encrypted, _ := encryption.IsEncryptedFile(plainPath); encrypted {
+		t.Error("a profile without credentials should not need encryption")
+	}
+
+	identity, _ := age.GenerateX25519Identity()
+	bm.SetEncryption(&config.ArchiveEncryption{
+		Keys:                  &encryption.Keys{Recipients: []age.Recipient{identity.Recipient()}},
+		RequireForCredentials: true,
+	})
+	workPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup() failed: %v", err)
+	}
+	if encrypted, _ := encryption.IsEncryptedFile(workPath); !encrypted {
+		t.Error("a profile with credentials should be encrypted")
+	}
+}
@@ -0,0 +1,413 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+const (
+	// SnapshotFormat identifies the snapshots of dedup backups
+	SnapshotFormat = "cdp-snapshot"
+	// SnapshotVersion is the snapshot format written by this version of cdp
+	SnapshotVersion = 1
+
+	// blobDir holds the blobs next to the snapshots
+	blobDir = "blobs"
+	// blobGracePeriod keeps garbage collection away from the blobs of a
+	// backup that is still running and has not written its snapshot yet
+	blobGracePeriod = time.Hour
+	// blobAttempts is how often a file that changes while it is stored is
+	// hashed and stored again
+	blobAttempts = 3
+)
+
+// ErrDedupPassphrase is returned when a dedup backup would have to be
+// encrypted with a passphrase. Every blob would need its own slow key
+// derivation, so dedup backups are only encrypted to recipients.
+var ErrDedupPassphrase = errors.New("dedup backups can only be encrypted to recipients; set encryption.recipients in config.yaml or pass --recipient")
+
+// errBlobChanged is returned while storing a file that changed since it was
+// hashed
+var errBlobChanged = errors.New("file changed while it was backed up")
+
+// Snapshot is what a dedup backup stores instead of an archive: the
+// manifest, whose SHA-256 of each file names the blob holding it, and the
+// directories
+type Snapshot struct {
+	Format   string    `json:"format"`
+	Version  int       `json:"version"`
+	Manifest *Manifest `json:"manifest"`
+	// Dirs lists the directories, so empty ones and their modes are restored
+	Dirs []ManifestFile `json:"dirs,omitempty"`
+}
+
+// isSnapshot reports whether a backup name or path is a dedup backup
+func isSnapshot(name string) bool {
+	return strings.HasSuffix(name, SnapshotExt) || strings.HasSuffix(name, SnapshotExt+EncryptedExt)
+}
+
+// blobName returns the name of the blob holding content with this SHA-256.
+// Encrypted blobs are kept apart, so an encrypted backup never refers to
+// content stored in the clear.
+func blobName(sum string, encrypted bool) string {
+	if encrypted {
+		return sum + EncryptedExt
+	}
+	return sum
+}
+
+// isBlobName reports whether a stored file is a blob
+func isBlobName(name string) bool {
+	sum := strings.TrimSuffix(name, EncryptedExt)
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// blobStorage returns the storage of the blobs of dedup backups, next to
+// the snapshots
+func (bm *BackupManager) blobStorage() (Storage, error) {
+	switch s := bm.storage.(type) {
+	case *DirStorage:
+		return NewDirStorage(filepath.Join(s.dir, blobDir)), nil
+	case *S3Storage:
+		opts := s.opts
+		opts.Prefix += blobDir + "/"
+		return NewS3Storage(opts)
+	default:
+		return nil, fmt.Errorf("%s cannot hold dedup backups", s)
+	}
+}
+
+// backupDedup stores the files of a profile as blobs, skipping those
+// already stored by earlier backups, then writes a snapshot listing them
+func (bm *BackupManager) backupDedup(profilePath string, manifest *Manifest) (string, error) {
+	hasCredentials := manifest.HasCredentialFiles()
+	encrypted := bm.encryption.Encrypts(hasCredentials)
+	if keys := bm.encryption.DecryptionKeys(); encrypted && (keys == nil || len(keys.Recipients) == 0) {
+		return "", ErrDedupPassphrase
+	}
+
+	blobs, err := bm.blobStorage()
+	if err != nil {
+		return "", err
+	}
+	stored, err := blobs.List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list blobs: %w", err)
+	}
+	existing := make(map[string]bool, len(stored))
+	for _, blob := range stored {
+		existing[blob.Name] = true
+	}
+
+	for i := range manifest.Files {
+		f := &manifest.Files[i]
+		if f.SHA256 == "" || existing[blobName(f.SHA256, encrypted)] {
+			continue
+		}
+		if err := bm.putBlob(blobs, profilePath, f, existing, hasCredentials); err != nil {
+			return "", fmt.Errorf("failed to create backup: %s: %w", f.Path, err)
+		}
+	}
+
+	dirs, err := listDirs(profilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	snapshot := &Snapshot{Format: SnapshotFormat, Version: SnapshotVersion, Manifest: manifest, Dirs: dirs}
+
+	ext := backupExt(SnapshotExt, encrypted)
+	backupName, err := bm.storeBackup(manifest.Profile, manifest.CreatedAt, ext, func(w io.Writer) error {
+		out, _, err := bm.encryption.Wrap(w, hasCredentials)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(out).Encode(snapshot); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	return location(bm.storage, backupName), nil
+}
+
+// putBlob stores a profile file as a blob. A file that changes while it is
+// stored is hashed again and f updated, so a blob always holds the content
+// its name says.
+func (bm *BackupManager) putBlob(blobs Storage, profilePath string, f *ManifestFile, existing map[string]bool, hasCredentials bool) error {
+	path := filepath.Join(profilePath, filepath.FromSlash(f.Path))
+	encrypted := bm.encryption.Encrypts(hasCredentials)
+
+	for attempt := 1; attempt <= blobAttempts; attempt++ {
+		if attempt > 1 {
+			sum, size, err := hashFileSize(path)
+			if err != nil {
+				return err
+			}
+			f.SHA256, f.Size = sum, size
+			if existing[blobName(f.SHA256, encrypted)] {
+				return nil
+			}
+		}
+
+		name := blobName(f.SHA256, encrypted)
+		err := putStream(blobs, name, func(w io.Writer) error {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			out, _, err := bm.encryption.Wrap(w, hasCredentials)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, &checkedReader{r: file, hash: sha256.New(), want: f.SHA256}); err != nil {
+				out.Close()
+				return err
+			}
+			return out.Close()
+		})
+		if err == nil || errors.Is(err, fs.ErrExist) {
+			existing[name] = true
+			return nil
+		}
+		if !errors.Is(err, errBlobChanged) {
+			return err
+		}
+	}
+	return fmt.Errorf("kept changing while it was backed up")
+}
+
+// checkedReader fails at the end of r when its content does not have the
+// wanted SHA-256
+type checkedReader struct {
+	r    io.Reader
+	hash hash.Hash
+	want string
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(c.hash.Sum(nil)) != c.want {
+		return n, errBlobChanged
+	}
+	return n, err
+}
+
+// listDirs returns the directories below a profile directory
+func listDirs(profilePath string) ([]ManifestFile, error) {
+	var dirs []ManifestFile
+	err := filepath.Walk(profilePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == profilePath {
+			return nil
+		}
+		relPath, err := filepath.Rel(profilePath, path)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, ManifestFile{Path: filepath.ToSlash(relPath), Mode: info.Mode()})
+		return nil
+	})
+	return dirs, err
+}
+
+// decodeSnapshot reads a snapshot, decrypting it if it is encrypted, and
+// reports whether it is. file is closed.
+func decodeSnapshot(file io.ReadCloser, keys *encryption.Keys) (*Snapshot, bool, error) {
+	r, closer, encrypted, err := decryptBackup(file, keys)
+	if err != nil {
+		return nil, encrypted, err
+	}
+	defer closer.Close()
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(io.LimitReader(r, maxManifestSize)).Decode(&snapshot); err != nil || snapshot.Format != SnapshotFormat || snapshot.Manifest == nil {
+		return nil, encrypted, fmt.Errorf("not a valid snapshot")
+	}
+	if snapshot.Version > SnapshotVersion {
+		return nil, encrypted, fmt.Errorf("snapshot version %d is newer than this cdp supports (%d); upgrade cdp", snapshot.Version, SnapshotVersion)
+	}
+	return &snapshot, encrypted, nil
+}
+
+// readSnapshot reads the snapshot at backupPath
+func readSnapshot(backupPath string, keys *encryption.Keys) (*Snapshot, bool, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	return decodeSnapshot(file, keys)
+}
+
+// openBackupArchive opens a backup as a tar stream. Snapshots are streamed
+// as the archive they stand for, reading the files from the blobs of the
+// storage. The returned func closes it.
+func (bm *BackupManager) openBackupArchive(backupPath string) (*tar.Reader, func(), bool, error) {
+	if !isSnapshot(backupPath) {
+		return openArchive(backupPath, bm.keys())
+	}
+
+	snapshot, encrypted, err := readSnapshot(backupPath, bm.keys())
+	if err != nil {
+		return nil, nil, encrypted, err
+	}
+	blobs, err := bm.blobStorage()
+	if err != nil {
+		return nil, nil, encrypted, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSnapshotArchive(pw, snapshot, encrypted, blobs, bm.keys()))
+	}()
+	return tar.NewReader(pr), func() { pr.Close() }, encrypted, nil
+}
+
+// writeSnapshotArchive writes a snapshot as a tar stream: its manifest, then
+// every directory and file
+func writeSnapshotArchive(w io.Writer, snapshot *Snapshot, encrypted bool, blobs Storage, keys *encryption.Keys) error {
+	tarWriter := tar.NewWriter(w)
+	if err := writeManifest(tarWriter, snapshot.Manifest); err != nil {
+		return err
+	}
+
+	entries := append(append([]ManifestFile(nil), snapshot.Dirs...), snapshot.Manifest.Files...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.Path,
+			Mode:    int64(entry.Mode.Perm()),
+			ModTime: snapshot.Manifest.CreatedAt,
+		}
+		switch {
+		case entry.Mode.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case entry.Link != "":
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.Link
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.Size
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if err := copyBlob(tarWriter, blobs, entry, encrypted, keys); err != nil {
+				return err
+			}
+		}
+	}
+	return tarWriter.Close()
+}
+
+// copyBlob writes the content of a file from its blob, checking it
+func copyBlob(w io.Writer, blobs Storage, f ManifestFile, encrypted bool, keys *encryption.Keys) error {
+	file, err := blobs.Get(blobName(f.SHA256, encrypted))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("blob of %s is missing", f.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read blob of %s: %w", f.Path, err)
+	}
+	r, closer, _, err := decryptBackup(file, keys)
+	if err != nil {
+		return fmt.Errorf("failed to read blob of %s: %w", f.Path, err)
+	}
+	defer closer.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(r, f.Size))
+	if err != nil {
+		return fmt.Errorf("failed to read blob of %s: %w", f.Path, err)
+	}
+	if n != f.Size || hex.EncodeToString(hash.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("blob of %s is corrupted", f.Path)
+	}
+	return nil
+}
+
+// collectBlobs removes the blobs no snapshot refers to, and returns how
+// many it removed and their size. Snapshots in removed are about to be
+// deleted and do not count. When a snapshot cannot be read, nothing is
+// removed.
+func (bm *BackupManager) collectBlobs(removed map[string]bool, dryRun bool) (int, int64, error) {
+	files, err := bm.storage.List()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, file := range files {
+		if !isSnapshot(file.Name) || removed[file.Name] {
+			continue
+		}
+		stored, err := bm.storage.Get(file.Name)
+		if err != nil {
+			return 0, 0, err
+		}
+		snapshot, encrypted, err := decodeSnapshot(stored, bm.keys())
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot tell which blobs %s uses: %w", file.Name, err)
+		}
+		for _, f := range snapshot.Manifest.Files {
+			if f.SHA256 != "" {
+				referenced[blobName(f.SHA256, encrypted)] = true
+			}
+		}
+	}
+
+	blobs, err := bm.blobStorage()
+	if err != nil {
+		// Nothing there can hold blobs
+		return 0, 0, nil
+	}
+	stored, err := blobs.List()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, freed := 0, int64(0)
+	cutoff := time.Now().Add(-blobGracePeriod)
+	for _, blob := range stored {
+		if !isBlobName(blob.Name) || referenced[blob.Name] || blob.ModTime.After(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := blobs.Delete(blob.Name); err != nil {
+				return count, freed, err
+			}
+		}
+		count++
+		freed += blob.Size
+	}
+	return count, freed, nil
+}
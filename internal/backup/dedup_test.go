@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+// blobCount returns the number of blobs next to the backups of bm
+func blobCount(t *testing.T, bm *BackupManager) int {
+	t.Helper()
+	blobs, err := bm.blobStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := blobs.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+// ageBlobs moves the blobs out of the grace period of garbage collection
+func ageBlobs(t *testing.T, bm *BackupManager) {
+	t.Helper()
+	dir := filepath.Join(bm.backupDir, blobDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * blobGracePeriod)
+	for _, entry := range entries {
+		if err := os.Chtimes(filepath.Join(dir, entry.Name()), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackupDedup(t *testing.T) {
+	bm := setupManifestProfile(t)
+	profileDir := filepath.Join(bm.profilesDir, "work")
+	os.MkdirAll(filepath.Join(profileDir, "projects"), 0755)
+
+	first, err := bm.BackupWithOptions("work", Options{Dedup: true})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	if !strings.HasSuffix(first, SnapshotExt) {
+		t.Errorf("backup path = %s, want a snapshot", first)
+	}
+	// Six files, and the symlink has no blob
+	if n := blobCount(t, bm); n != 6 {
+		t.Errorf("first backup stored %d blobs, want 6", n)
+	}
+
+	os.WriteFile(filepath.Join(profileDir, "settings.json"), []byte(`{"model": "haiku"}`), 0644)
+	second, err := bm.BackupWithOptions("work", Options{Dedup: true})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	if n := blobCount(t, bm); n != 7 {
+		t.Errorf("second backup left %d blobs, want 7: only the changed file is added", n)
+	}
+
+	backups, err := bm.List()
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("List() = %+v, %v", backups, err)
+	}
+	if b := backups[0]; !b.Snapshot || !b.HasManifest || b.FileCount != 7 || b.ProfileName != "work" {
+		t.Errorf("List() = %+v", b)
+	}
+
+	result, err := bm.Verify(first)
+	if err != nil || !result.OK() || result.Files != 7 {
+		t.Errorf("Verify() = %+v, %v", result, err)
+	}
+
+	_, entries, err := bm.Contents(first)
+	if err != nil {
+		t.Fatalf("Contents failed: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, entry := range entries {
+		paths[entry.Path] = entry.IsDir
+	}
+	if _, ok := paths["commands/git/log.md"]; !ok || !paths["projects"] {
+		t.Errorf("Contents() = %+v", entries)
+	}
+
+	if _, err := bm.RestoreWithOptions(first, RestoreOptions{As: "restored"}); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	restored := filepath.Join(bm.profilesDir, "restored")
+	if data, _ := os.ReadFile(filepath.Join(restored, "settings.json")); string(data) != `{"model": "opus"}` {
+		t.Errorf("settings.json = %q, want the first version", data)
+	}
+	if link, err := os.Readlink(filepath.Join(restored, "commands", "r.md")); err != nil || link != "review.md" {
+		t.Errorf("symlink = %q, %v", link, err)
+	}
+	if info, err := os.Stat(filepath.Join(restored, "projects")); err != nil || !info.IsDir() {
+		t.Errorf("empty directory not restored: %v", err)
+	}
+
+	if _, err := bm.RestoreWithOptions(second, RestoreOptions{As: "work", Only: []string{"settings.json"}}); err != nil {
+		t.Fatalf("RestoreWithOptions with Only failed: %v", err)
+	}
+}
+
+func TestBackupDedup_MissingBlob(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.BackupWithOptions("work", Options{Dedup: true})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	sum, err := hashFile(filepath.Join(bm.profilesDir, "work", "todos", "list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(bm.backupDir, blobDir, sum)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := bm.Verify(backupPath)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if result.OK() || !strings.Contains(strings.Join(result.Problems, "\n"), "todos/list.json") {
+		t.Errorf("Problems = %v, want the missing blob", result.Problems)
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "broken"}); err == nil {
+		t.Error("RestoreWithOptions succeeded without a blob")
+	}
+	if _, err := os.Stat(filepath.Join(bm.profilesDir, "broken")); !os.IsNotExist(err) {
+		t.Error("a failed restore left the profile behind")
+	}
+}
+
+func TestPrune_CollectsBlobs(t *testing.T) {
+	bm := setupManifestProfile(t)
+	profileDir := filepath.Join(bm.profilesDir, "work")
+
+	old, err := bm.BackupWithOptions("work", Options{Dedup: true})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(profileDir, "settings.json"), []byte(`{"model": "haiku"}`), 0644)
+	if _, err := bm.BackupWithOptions("work", Options{Dedup: true}); err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	policy := config.RetentionPolicy{KeepLast: 1}
+
+	// Blobs within the grace period may belong to a running backup
+	result, err := bm.Prune(PruneOptions{Policy: policy, DryRun: true})
+	if err != nil || result.BlobsErr != nil {
+		t.Fatalf("Prune() = %+v, %v", result, err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Path != old || result.Blobs != 0 {
+		t.Errorf("dry run removed %v and %d blobs", backupNames(result.Removed), result.Blobs)
+	}
+
+	ageBlobs(t, bm)
+	result, err = bm.Prune(PruneOptions{Policy: policy, DryRun: true})
+	if err != nil || result.Blobs != 1 || result.BlobsFreed != int64(len(`{"model": "opus"}`)) {
+		t.Errorf("dry run = %+v, %v; want the old settings.json blob", result, err)
+	}
+	if n := blobCount(t, bm); n != 7 {
+		t.Errorf("dry run left %d blobs, want 7", n)
+	}
+
+	result, err = bm.Prune(PruneOptions{Policy: policy})
+	if err != nil || result.BlobsErr != nil || result.Blobs != 1 {
+		t.Fatalf("Prune() = %+v, %v", result, err)
+	}
+	backups, _ := bm.List()
+	if len(backups) != 1 {
+		t.Fatalf("List() = %+v", backups)
+	}
+	verify, err := bm.Verify(backups[0].Path)
+	if err != nil || !verify.OK() {
+		t.Errorf("Verify() of the kept backup = %+v, %v", verify, err)
+	}
+}
+
+func TestPrune_UnreadableSnapshotKeepsBlobs(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	if _, err := bm.BackupWithOptions("work", Options{Dedup: true}); err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(bm.backupDir, "other-20240101-090000"+SnapshotExt), []byte("garbage"), 0600)
+	ageBlobs(t, bm)
+
+	result, err := bm.Prune(PruneOptions{Policy: config.RetentionPolicy{KeepLast: 5}})
+	if err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	if result.BlobsErr == nil || result.Blobs != 0 {
+		t.Errorf("Prune() = %+v, want the snapshot error and no blobs removed", result)
+	}
+	if n := blobCount(t, bm); n != 6 {
+		t.Errorf("Prune() left %d blobs, want 6", n)
+	}
+}
+
+func TestBackupDedup_Encrypted(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	bm.SetEncryption(&config.ArchiveEncryption{Keys: &encryption.Keys{}, Always: true})
+	if _, err := bm.BackupWithOptions("work", Options{Dedup: true}); !errors.Is(err, ErrDedupPassphrase) {
+		t.Errorf("BackupWithOptions() with a passphrase = %v, want ErrDedupPassphrase", err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.SetEncryption(&config.ArchiveEncryption{
+		Keys: &encryption.Keys{
+			Recipients: []age.Recipient{identity.Recipient()},
+			Identities: []age.Identity{identity},
+		},
+		Always: true,
+	})
+
+	backupPath, err := bm.BackupWithOptions("work", Options{Dedup: true})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	if !strings.HasSuffix(backupPath, SnapshotExt+EncryptedExt) {
+		t.Errorf("backup path = %s", backupPath)
+	}
+	sum, _ := hashFile(filepath.Join(bm.profilesDir, "work", ".credentials.json"))
+	blob := filepath.Join(bm.backupDir, blobDir, blobName(sum, true))
+	if encrypted, err := encryption.IsEncryptedFile(blob); err != nil || !encrypted {
+		t.Errorf("credentials blob encrypted = %v, %v", encrypted, err)
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "restored"}); err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(bm.profilesDir, "restored", ".credentials.json"))
+	if err != nil || string(data) != `{"token": "secret"}` {
+		t.Errorf(".credentials.json = %q, %v", data, err)
+	}
+}
+
+func TestBackupDedup_S3Storage(t *testing.T) {
+	bm := setupManifestProfile(t)
+	bm.SetStorage(newStubStorage(t, "laptop/"))
+
+	if _, err := bm.BackupWithOptions("work", Options{Dedup: true}); err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	if _, err := bm.BackupWithOptions("work", Options{Dedup: true}); err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	// Blobs are below the prefix, but not listed as backups
+	backups, err := bm.List()
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("List() = %+v, %v", backups, err)
+	}
+	if n := blobCount(t, bm); n != 6 {
+		t.Errorf("storage holds %d blobs, want 6", n)
+	}
+
+	backupPath, cleanup, err := bm.Fetch(backups[0].Name)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	defer cleanup()
+	result, err := bm.Verify(backupPath)
+	if err != nil || !result.OK() {
+		t.Errorf("Verify() = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,369 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+const (
+	// ManifestName is the archive entry holding the backup manifest. It is
+	// always the first entry, so it can be read without reading the archive.
+	ManifestName = "manifest.json"
+	// ManifestFormat identifies cdp backup manifests
+	ManifestFormat = "cdp-backup"
+	// ManifestVersion is the manifest format written by this version of cdp
+	ManifestVersion = 1
+
+	// maxManifestSize bounds the memory used to read a manifest
+	maxManifestSize = 64 << 20
+)
+
+// ErrNoManifest is returned for archives written before backups had manifests
+var ErrNoManifest = errors.New("backup has no manifest")
+
+// Manifest describes the content of a backup archive
+type Manifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Profile    string    `json:"profile"`
+	CreatedAt  time.Time `json:"createdAt"`
+	CdpVersion string    `json:"cdpVersion,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	// Operation is set on automatic backups to the operation that triggered them
+	Operation string `json:"operation,omitempty"`
+	FileCount int    `json:"fileCount"`
+	// Files lists the regular files and symlinks in the archive
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file recorded in a backup manifest
+type ManifestFile struct {
+	Path string      `json:"path"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+	// SHA256 is the content hash of a regular file
+	SHA256 string `json:"sha256,omitempty"`
+	// Link is the target of a symlink
+	Link string `json:"link,omitempty"`
+}
+
+// HasCredentialFiles reports whether the backup contains login tokens
+func (m *Manifest) HasCredentialFiles() bool {
+	for _, f := range m.Files {
+		if config.IsCredentialFile(f.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyResult is the outcome of verifying a backup archive
+type VerifyResult struct {
+	// Manifest is nil for archives without a manifest
+	Manifest *Manifest
+	// Files is the number of files read from the archive
+	Files int
+	// Problems lists every integrity problem found
+	Problems []string
+}
+
+// OK reports whether the archive is intact
+func (r *VerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// buildManifest hashes the files of a profile directory
+func buildManifest(profileName, profilePath string, opts Options) (*Manifest, error) {
+	manifest := &Manifest{
+		Format:     ManifestFormat,
+		Version:    ManifestVersion,
+		Profile:    profileName,
+		CreatedAt:  time.Now(),
+		CdpVersion: opts.CdpVersion,
+		Note:       opts.Note,
+		Operation:  opts.Operation,
+	}
+
+	err := filepath.Walk(profilePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(profilePath, path)
+		if err != nil {
+			return err
+		}
+
+		file := ManifestFile{Path: filepath.ToSlash(relPath), Size: info.Size(), Mode: info.Mode()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			file.Link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			file.Size = 0
+		case info.Mode().IsRegular():
+			file.SHA256, err = hashFile(path)
+			if err != nil {
+				return err
+			}
+		default:
+			// Sockets and pipes cannot be archived
+			return nil
+		}
+
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.FileCount = len(manifest.Files)
+	return manifest, nil
+}
+
+func hashFile(path string) (string, error) {
+	sum, _, err := hashFileSize(path)
+	return sum, err
+}
+
+// hashFileSize returns the SHA-256 and the size of a file, read at once
+func hashFileSize(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// writeManifest adds the manifest as an archive entry
+func writeManifest(tarWriter *tar.Writer, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	header := &tar.Header{
+		Name:     ManifestName,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(data)
+	return err
+}
+
+// ReadManifest reads the manifest of a backup archive, decrypting it with
+// keys if it is encrypted, and reports whether it is encrypted. Returns
+// ErrNoManifest for archives written before backups had manifests.
+func ReadManifest(backupPath string, keys *encryption.Keys) (*Manifest, bool, error) {
+	if isSnapshot(backupPath) {
+		snapshot, encrypted, err := readSnapshot(backupPath, keys)
+		if err != nil {
+			return nil, encrypted, err
+		}
+		return snapshot.Manifest, encrypted, nil
+	}
+
+	tarReader, closeArchive, encrypted, err := openArchive(backupPath, keys)
+	if err != nil {
+		return nil, encrypted, err
+	}
+	defer closeArchive()
+
+	manifest, err := readManifestEntry(tarReader)
+	return manifest, encrypted, err
+}
+
+// readStoredManifest reads the manifest of a backup in the storage, and
+// reports whether the backup is encrypted
+func (bm *BackupManager) readStoredManifest(backupName string, keys *encryption.Keys) (*Manifest, bool, error) {
+	stored, err := bm.storage.Get(backupName)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	if isSnapshot(backupName) {
+		snapshot, encrypted, err := decodeSnapshot(stored, keys)
+		if err != nil {
+			return nil, encrypted, err
+		}
+		return snapshot.Manifest, encrypted, nil
+	}
+
+	r, file, encrypted, err := decryptBackup(stored, keys)
+	if err != nil {
+		return nil, encrypted, err
+	}
+	tarReader, closeArchive, encrypted, err := readArchive(r, file, encrypted)
+	if err != nil {
+		return nil, encrypted, err
+	}
+	defer closeArchive()
+
+	manifest, err := readManifestEntry(tarReader)
+	return manifest, encrypted, err
+}
+
+// readManifestEntry reads the first archive entry as the manifest
+func readManifestEntry(tarReader *tar.Reader) (*Manifest, error) {
+	header, err := tarReader.Next()
+	if err == io.EOF {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tar: %w", err)
+	}
+	if header.Name != ManifestName {
+		return nil, ErrNoManifest
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tarReader, maxManifestSize)).Decode(&manifest); err != nil || manifest.Format != ManifestFormat {
+		// A profile file that happens to be called manifest.json
+		return nil, ErrNoManifest
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("backup manifest version %d is newer than this cdp supports (%d); upgrade cdp", manifest.Version, ManifestVersion)
+	}
+
+	return &manifest, nil
+}
+
+// Verify reads a backup archive without extracting it and checks every file
+// against the manifest. Archives without a manifest are only checked for
+// readability.
+func (bm *BackupManager) Verify(backupPath string) (*VerifyResult, error) {
+	manifest, _, err := ReadManifest(backupPath, bm.keys())
+	if err != nil && !errors.Is(err, ErrNoManifest) {
+		return nil, err
+	}
+
+	result := &VerifyResult{Manifest: manifest}
+
+	var tarReader *tar.Reader
+	if isSnapshot(backupPath) {
+		// Missing and corrupted blobs show up as a corrupted archive
+		snapshotReader, closeArchive, _, err := bm.openBackupArchive(backupPath)
+		if err != nil {
+			return nil, err
+		}
+		defer closeArchive()
+		tarReader = snapshotReader
+	} else {
+		r, file, _, err := openBackup(backupPath, bm.keys())
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("not a gzip archive: %v", err))
+			return result, nil
+		}
+		defer gzReader.Close()
+		tarReader = tar.NewReader(gzReader)
+	}
+
+	expected := make(map[string]ManifestFile)
+	if manifest != nil {
+		for _, f := range manifest.Files {
+			expected[f.Path] = f
+		}
+	}
+
+	first := true
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("archive is corrupted: %v", err))
+			return result, nil
+		}
+
+		isManifest := first && manifest != nil
+		first = false
+		if isManifest {
+			continue
+		}
+
+		// Restore would refuse the archive
+		if _, err := checkEntry(header); err != nil {
+			result.Problems = append(result.Problems, err.Error())
+			continue
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		result.Files++
+		hash := sha256.New()
+		size, err := io.Copy(hash, tarReader)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("archive is corrupted: %v", err))
+			return result, nil
+		}
+
+		if manifest == nil {
+			continue
+		}
+
+		want, ok := expected[header.Name]
+		if !ok {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: not in manifest", header.Name))
+			continue
+		}
+		delete(expected, header.Name)
+
+		switch {
+		case want.Link != "":
+			if header.Typeflag != tar.TypeSymlink || header.Linkname != want.Link {
+				result.Problems = append(result.Problems, fmt.Sprintf("%s: symlink does not match manifest", header.Name))
+			}
+		case size != want.Size || hex.EncodeToString(hash.Sum(nil)) != want.SHA256:
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: content does not match manifest", header.Name))
+		}
+	}
+
+	missing := make([]string, 0, len(expected))
+	for path := range expected {
+		missing = append(missing, path)
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		result.Problems = append(result.Problems, fmt.Sprintf("%s: missing from archive", path))
+	}
+
+	return result, nil
+}
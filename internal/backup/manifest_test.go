@@ -0,0 +1,315 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupManifestProfile creates a profile with nested files and a symlink
+func setupManifestProfile(t *testing.T) *BackupManager {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	profilesDir := filepath.Join(tmpDir, "profiles")
+	profileDir := filepath.Join(profilesDir, "work")
+
+	files := map[string]string{
+		"settings.json":       `{"model": "opus"}`,
+		".credentials.json":   `{"token": "secret"}`,
+		"commands/review.md":  "Review this",
+		"agents/tester.md":    "Test things",
+		"todos/list.json":     "[]",
+		"commands/git/log.md": "Show the log",
+	}
+	for name, content := range files {
+		path := filepath.Join(profileDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("review.md", filepath.Join(profileDir, "commands", "r.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err := NewBackupManager(profilesDir)
+	if err != nil {
+		t.Fatalf("NewBackupManager failed: %v", err)
+	}
+	return bm
+}
+
+// writeLegacyBackup writes an archive without a manifest, as older cdp did
+func writeLegacyBackup(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rewriteBackup copies an archive, letting edit change the content of entries
+func rewriteBackup(t *testing.T, src, dst string, edit func(name string, data []byte) []byte) {
+	t.Helper()
+
+	file, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(gzReader)
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			data = edit(header.Name, data)
+			header.Size = int64(len(data))
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+
+	if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupWithOptions_WritesManifest(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.BackupWithOptions("work", Options{Note: "before upgrade", CdpVersion: "1.2.3"})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+
+	manifest, _, err := ReadManifest(backupPath, nil)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+
+	if manifest.Profile != "work" || manifest.Note != "before upgrade" || manifest.CdpVersion != "1.2.3" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if manifest.FileCount != 7 || len(manifest.Files) != 7 {
+		t.Errorf("FileCount = %d, files = %d, want 7", manifest.FileCount, len(manifest.Files))
+	}
+
+	sum := sha256.Sum256([]byte("Review this"))
+	found := map[string]ManifestFile{}
+	for _, f := range manifest.Files {
+		found[f.Path] = f
+	}
+	if got := found["commands/review.md"].SHA256; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("commands/review.md sha256 = %s", got)
+	}
+	if got := found["commands/r.md"].Link; got != "review.md" {
+		t.Errorf("commands/r.md link = %q, want review.md", got)
+	}
+}
+
+func TestRestore_UsesManifestProfileName(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// The filename no longer carries the profile name
+	renamed := filepath.Join(t.TempDir(), "renamed.tar.gz")
+	if err := os.Rename(backupPath, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(bm.profilesDir, "work")); err != nil {
+		t.Fatal(err)
+	}
+
+	profileName, err := bm.Restore(renamed, false)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if profileName != "work" {
+		t.Errorf("profileName = %s, want work", profileName)
+	}
+
+	profileDir := filepath.Join(bm.profilesDir, "work")
+	if _, err := os.Stat(filepath.Join(profileDir, ManifestName)); !os.IsNotExist(err) {
+		t.Error("manifest should not be restored into the profile")
+	}
+	if data, err := os.ReadFile(filepath.Join(profileDir, "commands", "git", "log.md")); err != nil || string(data) != "Show the log" {
+		t.Errorf("commands/git/log.md = %q, %v", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(profileDir, "commands", "r.md")); err != nil || link != "review.md" {
+		t.Errorf("commands/r.md link = %q, %v", link, err)
+	}
+}
+
+func TestRestore_ProfileFileNamedManifest(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	// A profile file called manifest.json is not mistaken for the manifest
+	legacy := filepath.Join(bm.backupDir, "old-20240101-120000.tar.gz")
+	writeLegacyBackup(t, legacy, map[string]string{ManifestName: `{"plugins": []}`})
+
+	if _, _, err := ReadManifest(legacy, nil); !errors.Is(err, ErrNoManifest) {
+		t.Fatalf("ReadManifest error = %v, want ErrNoManifest", err)
+	}
+
+	if _, err := bm.Restore(legacy, false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(bm.profilesDir, "old", ManifestName))
+	if err != nil || string(data) != `{"plugins": []}` {
+		t.Errorf("manifest.json = %q, %v", data, err)
+	}
+}
+
+func TestList_LegacyAndManifestBackups(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	if _, err := bm.BackupWithOptions("work", Options{Note: "weekly"}); err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+	writeLegacyBackup(t, filepath.Join(bm.backupDir, "old-profile-20240101-120000.tar.gz"), map[string]string{"settings.json": "{}"})
+
+	backups, err := bm.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("List returned %d backups, want 2", len(backups))
+	}
+
+	current, legacy := backups[0], backups[1]
+	if current.ProfileName != "work" || !current.HasManifest || current.Note != "weekly" || current.FileCount != 7 {
+		t.Errorf("manifest backup = %+v", current)
+	}
+	if legacy.ProfileName != "old-profile" || legacy.HasManifest {
+		t.Errorf("legacy backup = %+v", legacy)
+	}
+	if legacy.CreatedAt.Year() != 2024 {
+		t.Errorf("legacy CreatedAt = %v, want 2024 from the filename", legacy.CreatedAt)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		result, err := bm.Verify(backupPath)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if !result.OK() {
+			t.Errorf("Problems = %v", result.Problems)
+		}
+		if result.Manifest == nil || result.Files != 7 {
+			t.Errorf("Manifest = %v, Files = %d", result.Manifest, result.Files)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+		rewriteBackup(t, backupPath, tampered, func(name string, data []byte) []byte {
+			if name == "settings.json" {
+				return []byte(`{"model": "haiku"}`)
+			}
+			return data
+		})
+
+		result, err := bm.Verify(tampered)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if len(result.Problems) != 1 || !strings.Contains(result.Problems[0], "settings.json") {
+			t.Errorf("Problems = %v, want one for settings.json", result.Problems)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data, err := os.ReadFile(backupPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := filepath.Join(t.TempDir(), "truncated.tar.gz")
+		if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := bm.Verify(truncated)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if result.OK() {
+			t.Error("Verify should report a truncated archive")
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		legacy := filepath.Join(t.TempDir(), "old-20240101-120000.tar.gz")
+		writeLegacyBackup(t, legacy, map[string]string{"settings.json": "{}", "CLAUDE.md": "# Notes"})
+
+		result, err := bm.Verify(legacy)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if !result.OK() || result.Manifest != nil || result.Files != 2 {
+			t.Errorf("result = %+v", result)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+// PruneOptions controls Prune
+type PruneOptions struct {
+	Policy config.RetentionPolicy
+	// Profile limits pruning to the backups of one profile
+	Profile string
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+}
+
+// PruneResult lists the backups kept and removed by Prune
+type PruneResult struct {
+	Kept    []BackupInfo
+	Removed []BackupInfo
+	// Freed is the size of the removed backups
+	Freed int64
+	// Blobs is the number of dedup blobs no remaining backup uses, removed
+	// after the backups, and BlobsFreed their size
+	Blobs      int
+	BlobsFreed int64
+	// BlobsErr is why unused blobs could not be removed. The backups were
+	// pruned regardless.
+	BlobsErr error
+}
+
+// Prune removes the backups the retention policy does not keep
+func (bm *BackupManager) Prune(opts PruneOptions) (*PruneResult, error) {
+	if opts.Policy.IsZero() {
+		return nil, fmt.Errorf("retention policy has no rules; it would remove every backup")
+	}
+
+	backups, err := bm.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Profile != "" {
+		var selected []BackupInfo
+		for _, b := range backups {
+			if b.ProfileName == opts.Profile {
+				selected = append(selected, b)
+			}
+		}
+		backups = selected
+	}
+
+	result := &PruneResult{}
+	result.Kept, result.Removed = SelectRetained(opts.Policy, backups)
+	for _, b := range result.Removed {
+		result.Freed += b.Size
+	}
+
+	removed := make(map[string]bool, len(result.Removed))
+	for _, b := range result.Removed {
+		removed[b.Name] = true
+	}
+
+	if !opts.DryRun {
+		for _, b := range result.Removed {
+			if err := bm.Delete(b.Name); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	result.Blobs, result.BlobsFreed, result.BlobsErr = bm.collectBlobs(removed, opts.DryRun)
+	return result, nil
+}
+
+// SelectRetained splits backups into those the policy keeps and those it
+// removes. Rules apply to the backups of each profile separately. Days and
+// weeks are calendar days and ISO weeks in local time, and only those with a
+// backup count, so a profile that is rarely backed up keeps its old backups.
+func SelectRetained(policy config.RetentionPolicy, backups []BackupInfo) (keep, remove []BackupInfo) {
+	byProfile := make(map[string][]BackupInfo)
+	for _, b := range backups {
+		byProfile[b.ProfileName] = append(byProfile[b.ProfileName], b)
+	}
+
+	profiles := make([]string, 0, len(byProfile))
+	for name := range byProfile {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	for _, name := range profiles {
+		list := byProfile[name]
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		})
+
+		kept := make([]bool, len(list))
+		for i := 0; i < policy.KeepLast && i < len(list); i++ {
+			kept[i] = true
+		}
+		keepNewestPerPeriod(list, kept, policy.KeepDaily, func(t time.Time) string {
+			return t.Local().Format("2006-01-02")
+		})
+		keepNewestPerPeriod(list, kept, policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.Local().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+
+		for i, b := range list {
+			if kept[i] {
+				keep = append(keep, b)
+			} else {
+				remove = append(remove, b)
+			}
+		}
+	}
+
+	return keep, remove
+}
+
+// keepNewestPerPeriod marks the newest backup of each of the n most recent
+// periods that have one. list must be sorted newest first.
+func keepNewestPerPeriod(list []BackupInfo, kept []bool, n int, period func(time.Time) string) {
+	seen := make(map[string]bool)
+	for i, b := range list {
+		if len(seen) >= n {
+			return
+		}
+		key := period(b.CreatedAt)
+		if !seen[key] {
+			seen[key] = true
+			kept[i] = true
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+func backupNames(backups []BackupInfo) []string {
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = b.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSelectRetained(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 3, day, hour, 0, 0, 0, time.Local)
+	}
+
+	var backups []BackupInfo
+	add := func(profile string, created time.Time) {
+		backups = append(backups, BackupInfo{
+			Name:        fmt.Sprintf("%s-%s.tar.gz", profile, created.Format("20060102-150405")),
+			ProfileName: profile,
+			CreatedAt:   created,
+		})
+	}
+	// Two a day for the last two weeks
+	for day := 1; day <= 15; day++ {
+		add("work", at(day, 9))
+		add("work", at(day, 18))
+	}
+	// A single old backup survives every rule
+	add("personal", at(1, 9))
+
+	tests := []struct {
+		name   string
+		policy config.RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "keep last",
+			policy: config.RetentionPolicy{KeepLast: 3},
+			want: []string{
+				"personal-20240301-090000.tar.gz",
+				"work-20240314-180000.tar.gz",
+				"work-20240315-090000.tar.gz",
+				"work-20240315-180000.tar.gz",
+			},
+		},
+		{
+			name:   "keep daily",
+			policy: config.RetentionPolicy{KeepDaily: 3},
+			want: []string{
+				"personal-20240301-090000.tar.gz",
+				"work-20240313-180000.tar.gz",
+				"work-20240314-180000.tar.gz",
+				"work-20240315-180000.tar.gz",
+			},
+		},
+		{
+			// ISO weeks start on Monday 11 March, 4 March and 26 February
+			name:   "keep weekly",
+			policy: config.RetentionPolicy{KeepWeekly: 3},
+			want: []string{
+				"personal-20240301-090000.tar.gz",
+				"work-20240303-180000.tar.gz",
+				"work-20240310-180000.tar.gz",
+				"work-20240315-180000.tar.gz",
+			},
+		},
+		{
+			name:   "combined",
+			policy: config.RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepWeekly: 2},
+			want: []string{
+				"personal-20240301-090000.tar.gz",
+				"work-20240310-180000.tar.gz",
+				"work-20240314-180000.tar.gz",
+				"work-20240315-180000.tar.gz",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove := SelectRetained(tt.policy, backups)
+			if got := backupNames(keep); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+			if len(keep)+len(remove) != len(backups) {
+				t.Errorf("kept %d and removed %d of %d backups", len(keep), len(remove), len(backups))
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	for _, name := range []string{
+		"work-20240101-090000.tar.gz",
+		"work-20240102-090000.tar.gz",
+		"work-20240103-090000.tar.gz",
+		"other-20240101-090000.tar.gz",
+	} {
+		writeLegacyBackup(t, filepath.Join(bm.backupDir, name), map[string]string{"settings.json": "{}"})
+	}
+
+	policy := config.RetentionPolicy{KeepLast: 1}
+
+	if _, err := bm.Prune(PruneOptions{}); err == nil {
+		t.Error("Prune() without rules should fail instead of removing everything")
+	}
+
+	result, err := bm.Prune(PruneOptions{Policy: policy, DryRun: true})
+	if err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	if len(result.Removed) != 2 || result.Freed == 0 {
+		t.Errorf("dry run removed %v, freed %d", backupNames(result.Removed), result.Freed)
+	}
+	if entries, _ := os.ReadDir(bm.backupDir); len(entries) != 4 {
+		t.Errorf("dry run left %d backups, want 4", len(entries))
+	}
+
+	result, err = bm.Prune(PruneOptions{Policy: policy, Profile: "other"})
+	if err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	if len(result.Removed) != 0 || len(result.Kept) != 1 {
+		t.Errorf("pruning other kept %v and removed %v", backupNames(result.Kept), backupNames(result.Removed))
+	}
+
+	if _, err := bm.Prune(PruneOptions{Policy: policy}); err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	backups, err := bm.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"other-20240101-090000.tar.gz", "work-20240103-090000.tar.gz"}
+	if got := backupNames(backups); !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining backups = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,460 @@
+package backup
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+// Limits applied when restoring, so a crafted archive cannot fill the disk
+var (
+	// MaxRestoreSize is the total size of the files extracted from a backup
+	MaxRestoreSize int64 = 4 << 30
+	// MaxRestoreEntries is the number of entries extracted from a backup
+	MaxRestoreEntries = 1000000
+)
+
+// RestoreOptions controls RestoreWithOptions
+type RestoreOptions struct {
+	// As restores under this profile name instead of the backed up one
+	As string
+	// Only restores the matching files into the existing profile and leaves
+	// everything else in place. Patterns use path.Match syntax against paths
+	// in the archive; a pattern matching a directory selects its content.
+	Only []string
+	// Overwrite replaces an existing profile when restoring everything
+	Overwrite bool
+	// BeforeOverwrite is called with the profile lock held before existing
+	// profile data is replaced, e.g. to back it up
+	BeforeOverwrite func(profile string) error
+}
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	Profile string
+	// Files are the archive paths of the restored files
+	Files []string
+}
+
+// ArchiveEntry is a file or directory in a backup archive
+type ArchiveEntry struct {
+	Path  string
+	Size  int64
+	Mode  fs.FileMode
+	Link  string
+	IsDir bool
+}
+
+// Restore restores a profile from a backup
+func (bm *BackupManager) Restore(backupPath string, overwrite bool) (string, error) {
+	result, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Overwrite: overwrite})
+	if err != nil {
+		return "", err
+	}
+	return result.Profile, nil
+}
+
+// RestoreWithOptions restores a whole profile, or selected files of it, from
+// a backup
+func (bm *BackupManager) RestoreWithOptions(backupPath string, opts RestoreOptions) (*RestoreResult, error) {
+	for _, pattern := range opts.Only {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	// Take the profile name from the manifest, or from the filename for
+	// archives written before backups had manifests
+	manifest, _, err := ReadManifest(backupPath, bm.keys())
+	if err != nil && !errors.Is(err, ErrNoManifest) {
+		return nil, err
+	}
+
+	profileName := opts.As
+	if profileName == "" {
+		if profileName, err = backupProfileName(backupPath, manifest); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ValidateName(profileName); err != nil {
+		return nil, fmt.Errorf("backup has an invalid profile name: %w", err)
+	}
+
+	unlock, err := config.LockProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	profilePath := filepath.Join(bm.profilesDir, profileName)
+	result := &RestoreResult{Profile: profileName}
+
+	if len(opts.Only) > 0 {
+		if _, err := os.Stat(profilePath); os.IsNotExist(err) {
+			return nil, fmt.Errorf("profile '%s' does not exist; restore the whole backup first", profileName)
+		}
+	} else if _, err := os.Stat(profilePath); err == nil && !opts.Overwrite {
+		return nil, fmt.Errorf("profile '%s' already exists. Use --overwrite to replace", profileName)
+	}
+
+	// Extract next to the profiles so a failed or hostile restore never
+	// touches the existing profile, then move it into place
+	if err := os.MkdirAll(bm.profilesDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profiles directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(bm.profilesDir, ".restore-"+profileName+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	stagedPath := filepath.Join(staging, profileName)
+
+	if len(opts.Only) > 0 {
+		match := func(name string) bool { return matchesAny(name, opts.Only) }
+		if result.Files, err = bm.extractArchive(backupPath, manifest, stagedPath, match); err != nil {
+			return nil, err
+		}
+		if len(result.Files) == 0 {
+			return nil, fmt.Errorf("no files in the backup match %s", strings.Join(opts.Only, ", "))
+		}
+		if err := opts.beforeOverwrite(profileName); err != nil {
+			return nil, err
+		}
+		for _, name := range result.Files {
+			if err := restoreFile(profilePath, stagedPath, name); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	if result.Files, err = bm.extractArchive(backupPath, manifest, stagedPath, nil); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(profilePath); err == nil {
+		if err := opts.beforeOverwrite(profileName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.InstallStaged(stagedPath, profilePath); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (opts RestoreOptions) beforeOverwrite(profile string) error {
+	if opts.BeforeOverwrite == nil {
+		return nil
+	}
+	return opts.BeforeOverwrite(profile)
+}
+
+// Contents lists the entries of a backup archive without extracting it.
+// The manifest is nil for archives written before backups had manifests.
+func (bm *BackupManager) Contents(backupPath string) (*Manifest, []ArchiveEntry, error) {
+	manifest, _, err := ReadManifest(backupPath, bm.keys())
+	if err != nil && !errors.Is(err, ErrNoManifest) {
+		return nil, nil, err
+	}
+
+	var entries []ArchiveEntry
+	err = bm.walkArchive(backupPath, manifest, func(header *tar.Header, r io.Reader) error {
+		entries = append(entries, ArchiveEntry{
+			Path:  strings.TrimSuffix(header.Name, "/"),
+			Size:  header.Size,
+			Mode:  header.FileInfo().Mode(),
+			Link:  header.Linkname,
+			IsDir: header.Typeflag == tar.TypeDir,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return manifest, entries, nil
+}
+
+// backupProfileName returns the name of the profile a backup was made of
+func backupProfileName(backupPath string, manifest *Manifest) (string, error) {
+	if manifest != nil {
+		return manifest.Profile, nil
+	}
+	profileName, _, ok := parseBackupName(filepath.Base(backupPath))
+	if !ok {
+		return "", fmt.Errorf("invalid backup filename format")
+	}
+	return profileName, nil
+}
+
+// walkArchive calls fn for every entry of a backup archive except the manifest
+func (bm *BackupManager) walkArchive(backupPath string, manifest *Manifest, fn func(header *tar.Header, r io.Reader) error) error {
+	tarReader, closeArchive, _, err := bm.openBackupArchive(backupPath)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	first := true
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		// The manifest is not part of the profile
+		isManifest := first && manifest != nil
+		first = false
+		if isManifest {
+			continue
+		}
+
+		if err := fn(header, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// extractLimits counts what has been extracted against MaxRestoreSize and
+// MaxRestoreEntries
+type extractLimits struct {
+	size    int64
+	entries int
+}
+
+func (l *extractLimits) add(header *tar.Header) error {
+	l.entries++
+	if l.entries > MaxRestoreEntries {
+		return fmt.Errorf("backup has more than %d entries", MaxRestoreEntries)
+	}
+	if header.Typeflag == tar.TypeReg {
+		if header.Size < 0 || header.Size > MaxRestoreSize-l.size {
+			return fmt.Errorf("backup is larger than the restore limit of %d bytes", MaxRestoreSize)
+		}
+		l.size += header.Size
+	}
+	return nil
+}
+
+// checkEntry refuses archive entries that could write outside the profile
+// and returns the cleaned path of the entry. An empty path means the entry
+// carries no profile content and is skipped.
+func checkEntry(header *tar.Header) (string, error) {
+	if header.Typeflag == tar.TypeXGlobalHeader {
+		return "", nil
+	}
+
+	name := path.Clean(header.Name)
+	if name == "." && header.Typeflag == tar.TypeDir {
+		// The profile directory itself, as written by tar -C dir .
+		return "", nil
+	}
+	if strings.Contains(header.Name, `\`) || !fs.ValidPath(name) {
+		return "", fmt.Errorf("backup contains unsafe path '%s'", header.Name)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeDir:
+		return name, nil
+	case tar.TypeSymlink:
+		if err := checkLinkTarget(name, header.Linkname); err != nil {
+			return "", err
+		}
+		return name, nil
+	case tar.TypeLink:
+		return "", fmt.Errorf("backup contains hard link '%s'; hard links are not supported", header.Name)
+	default:
+		return "", fmt.Errorf("backup contains '%s' of unsupported type %q", header.Name, header.Typeflag)
+	}
+}
+
+// checkLinkTarget refuses symlinks pointing outside the profile. Targets may
+// only climb with leading ".." elements, so where they point never depends
+// on other links.
+func checkLinkTarget(name, link string) error {
+	if link == "" || path.IsAbs(link) || strings.Contains(link, `\`) {
+		return fmt.Errorf("backup contains symlink '%s' pointing outside the profile", name)
+	}
+
+	depth := strings.Count(name, "/")
+	climbing := true
+	for _, elem := range strings.Split(link, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			if !climbing || depth == 0 {
+				return fmt.Errorf("backup contains symlink '%s' pointing outside the profile", name)
+			}
+			depth--
+		default:
+			climbing = false
+		}
+	}
+	return nil
+}
+
+// extractArchive extracts a backup into dir, which must not exist: the
+// whole backup, or only the files and symlinks that match reports true for.
+// Every entry is checked either way. Returns the paths of the extracted files.
+func (bm *BackupManager) extractArchive(backupPath string, manifest *Manifest, dir string, match func(name string) bool) ([]string, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+
+	var files []string
+	dirModes := make(map[string]fs.FileMode)
+	limits := &extractLimits{}
+
+	err := bm.walkArchive(backupPath, manifest, func(header *tar.Header, r io.Reader) error {
+		name, err := checkEntry(header)
+		if err != nil || name == "" {
+			return err
+		}
+		if match != nil && (header.Typeflag == tar.TypeDir || !match(name)) {
+			return nil
+		}
+		if err := limits.add(header); err != nil {
+			return err
+		}
+		if err := checkParents(dir, name); err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(dir, filepath.FromSlash(name))
+		perm := fs.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(targetPath, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			// Applied at the end, so read-only directories can be filled
+			dirModes[targetPath] = perm
+			return nil
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory: %w", err)
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return fmt.Errorf("failed to create symlink: %w", err)
+			}
+		default:
+			// Ensure parent directory exists
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory: %w", err)
+			}
+			if err := writeFile(targetPath, r, perm); err != nil {
+				return err
+			}
+		}
+
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Deepest first, so a parent never becomes read-only before its children
+	dirs := make([]string, 0, len(dirModes))
+	for dirPath := range dirModes {
+		dirs = append(dirs, dirPath)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dirPath := range dirs {
+		if err := os.Chmod(dirPath, dirModes[dirPath]); err != nil {
+			return nil, fmt.Errorf("failed to set directory mode: %w", err)
+		}
+	}
+
+	return files, nil
+}
+
+// checkParents refuses entries below a symlink extracted earlier, which
+// could otherwise redirect the write outside the profile
+func checkParents(dir, name string) error {
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(parent)))
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("backup contains '%s' below the symlink '%s'", name, parent)
+		}
+	}
+	return nil
+}
+
+// writeFile creates a new file with the given permissions
+func writeFile(targetPath string, r io.Reader, perm fs.FileMode) error {
+	outFile, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if _, err := io.Copy(outFile, r); err != nil {
+		outFile.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// OpenFile is subject to the umask
+	return os.Chmod(targetPath, perm)
+}
+
+// restoreFile moves a file or symlink extracted to stagedPath into the
+// existing profile at profilePath, replacing its current version. It never
+// writes through a symlink of the profile: a parent directory that is one is
+// refused, and a symlink in place of the file is replaced.
+func restoreFile(profilePath, stagedPath, name string) error {
+	if err := checkParents(profilePath, name); err != nil {
+		return err
+	}
+
+	targetPath := filepath.Join(profilePath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	if info, err := os.Lstat(targetPath); err == nil && info.IsDir() {
+		return fmt.Errorf("cannot restore %s over a directory", name)
+	}
+
+	// Claude may be reading the file right now; rename replaces it atomically
+	if err := os.Rename(filepath.Join(stagedPath, filepath.FromSlash(name)), targetPath); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	return nil
+}
+
+// matchesAny reports whether an archive path, or one of its parent
+// directories, matches one of the patterns
+func matchesAny(name string, patterns []string) bool {
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(path.Clean(filepath.ToSlash(pattern)), "/")
+		for prefix := name; prefix != "." && prefix != "/"; prefix = path.Dir(prefix) {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRestoreWithOptions_As(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// The live profile is left alone
+	livePath := filepath.Join(bm.profilesDir, "work", "settings.json")
+	if err := os.WriteFile(livePath, []byte(`{"model": "sonnet"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "work-old"})
+	if err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+	if result.Profile != "work-old" || len(result.Files) != 7 {
+		t.Errorf("result = %+v", result)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(bm.profilesDir, "work-old", "settings.json")); string(data) != `{"model": "opus"}` {
+		t.Errorf("restored settings.json = %s", data)
+	}
+	if data, _ := os.ReadFile(livePath); string(data) != `{"model": "sonnet"}` {
+		t.Errorf("live settings.json = %s", data)
+	}
+
+	// Restoring under the same name again needs --overwrite
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "work-old"}); err == nil {
+		t.Error("RestoreWithOptions should refuse to replace an existing profile")
+	}
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "../escape"}); err == nil {
+		t.Error("RestoreWithOptions should reject an invalid profile name")
+	}
+}
+
+func TestRestoreWithOptions_Only(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	profileDir := filepath.Join(bm.profilesDir, "work")
+	changes := map[string]string{
+		"settings.json":       `{"model": "broken"}`,
+		".credentials.json":   `{"token": "fresh"}`,
+		"commands/review.md":  "Changed",
+		"commands/git/log.md": "Changed",
+		"CLAUDE.md":           "Added after the backup",
+	}
+	for name, content := range changes {
+		if err := os.WriteFile(filepath.Join(profileDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(profileDir, "agents")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Only: []string{"settings.json", "commands/*.md", "agents"}})
+	if err != nil {
+		t.Fatalf("RestoreWithOptions failed: %v", err)
+	}
+
+	want := []string{"agents/tester.md", "commands/r.md", "commands/review.md", "settings.json"}
+	got := append([]string(nil), result.Files...)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %v, want %v", got, want)
+	}
+
+	expected := map[string]string{
+		"settings.json":       `{"model": "opus"}`,
+		"commands/review.md":  "Review this",
+		"agents/tester.md":    "Test things",
+		".credentials.json":   `{"token": "fresh"}`,
+		"commands/git/log.md": "Changed",
+		"CLAUDE.md":           "Added after the backup",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(profileDir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, content)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(profileDir, "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("settings.json mode = %v, want the backed up 0644", info.Mode().Perm())
+	}
+}
+
+func TestRestoreWithOptions_OnlyErrors(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Only: []string{"nothing-*.json"}}); err == nil {
+		t.Error("RestoreWithOptions should fail when no file matches")
+	}
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Only: []string{"[settings"}}); err == nil {
+		t.Error("RestoreWithOptions should reject an invalid pattern")
+	}
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "missing", Only: []string{"settings.json"}}); err == nil {
+		t.Error("RestoreWithOptions should need an existing profile with Only")
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"settings.json", []string{"settings.json"}, true},
+		{"settings.local.json", []string{"settings.json"}, false},
+		{"settings.local.json", []string{"settings*.json"}, true},
+		{"commands/git/log.md", []string{"commands"}, true},
+		{"commands/git/log.md", []string{"commands/"}, true},
+		{"commands/git/log.md", []string{"commands/*.md"}, false},
+		{"commands/git/log.md", []string{"commands/*"}, true},
+		{"agents/tester.md", []string{"commands", "agents/*.md"}, true},
+		{"CLAUDE.md", []string{"*.json"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesAny(tt.name, tt.patterns); got != tt.want {
+			t.Errorf("matchesAny(%q, %v) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestContents(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.BackupWithOptions("work", Options{Note: "nightly"})
+	if err != nil {
+		t.Fatalf("BackupWithOptions failed: %v", err)
+	}
+
+	manifest, entries, err := bm.Contents(backupPath)
+	if err != nil {
+		t.Fatalf("Contents failed: %v", err)
+	}
+	if manifest == nil || manifest.Note != "nightly" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	byPath := make(map[string]ArchiveEntry)
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	if _, ok := byPath[ManifestName]; ok {
+		t.Error("Contents should not list the manifest")
+	}
+	if !byPath["commands"].IsDir {
+		t.Error("commands should be listed as a directory")
+	}
+	if byPath["commands/r.md"].Link != "review.md" {
+		t.Errorf("commands/r.md = %+v", byPath["commands/r.md"])
+	}
+	if byPath["commands/review.md"].Size != int64(len("Review this")) {
+		t.Errorf("commands/review.md = %+v", byPath["commands/review.md"])
+	}
+}
+
+type rawEntry struct {
+	header  tar.Header
+	content string
+}
+
+// writeRawBackup writes an archive with arbitrary entries, as a crafted or
+// foreign backup could contain
+func writeRawBackup(t *testing.T, path string, entries []rawEntry) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(entry.content))
+		}
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		if err := tarWriter.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestore_RejectsUnsafeEntries(t *testing.T) {
+	settings := rawEntry{tar.Header{Name: "settings.json", Typeflag: tar.TypeReg}, "{}"}
+
+	tests := []struct {
+		name  string
+		entry rawEntry
+	}{
+		{"parent directory", rawEntry{tar.Header{Name: "../escape.txt", Typeflag: tar.TypeReg}, "pwned"}},
+		{"nested parent directory", rawEntry{tar.Header{Name: "commands/../../escape.txt", Typeflag: tar.TypeReg}, "pwned"}},
+		{"absolute path", rawEntry{tar.Header{Name: "/tmp/escape.txt", Typeflag: tar.TypeReg}, "pwned"}},
+		{"absolute symlink", rawEntry{tar.Header{Name: "escape.txt", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, ""}},
+		{"climbing symlink", rawEntry{tar.Header{Name: "commands/escape.txt", Typeflag: tar.TypeSymlink, Linkname: "../../escape.txt"}, ""}},
+		{"symlink climbing after a name", rawEntry{tar.Header{Name: "escape.txt", Typeflag: tar.TypeSymlink, Linkname: "commands/../.."}, ""}},
+		{"hard link", rawEntry{tar.Header{Name: "escape.txt", Typeflag: tar.TypeLink, Linkname: "settings.json"}, ""}},
+		{"device", rawEntry{tar.Header{Name: "escape.txt", Typeflag: tar.TypeChar}, ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := setupManifestProfile(t)
+			backupPath := filepath.Join(bm.backupDir, "work-20240101-120000.tar.gz")
+			writeRawBackup(t, backupPath, []rawEntry{settings, tt.entry})
+
+			if _, err := bm.Restore(backupPath, true); err == nil {
+				t.Fatal("Restore should reject the archive")
+			}
+
+			// The existing profile is untouched and nothing was left behind
+			data, err := os.ReadFile(filepath.Join(bm.profilesDir, "work", "settings.json"))
+			if err != nil || string(data) != `{"model": "opus"}` {
+				t.Errorf("settings.json = %q, %v", data, err)
+			}
+			entries, _ := os.ReadDir(bm.profilesDir)
+			if len(entries) != 1 {
+				t.Errorf("profiles directory has %d entries, want only the profile", len(entries))
+			}
+
+			result, err := bm.Verify(backupPath)
+			if err != nil || result.OK() {
+				t.Errorf("Verify should report the unsafe entry: %+v, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestRestore_RejectsEntriesBelowSymlinks(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	// The link itself stays inside the profile, but writing through it
+	// would land next to the profile
+	backupPath := filepath.Join(bm.backupDir, "other-20240101-120000.tar.gz")
+	writeRawBackup(t, backupPath, []rawEntry{
+		{tar.Header{Name: "commands", Typeflag: tar.TypeSymlink, Linkname: "."}, ""},
+		{tar.Header{Name: "commands/escape", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+	})
+
+	if _, err := bm.Restore(backupPath, false); err == nil {
+		t.Fatal("Restore should reject entries below a symlink")
+	}
+	if _, err := os.Lstat(filepath.Join(bm.profilesDir, "other")); !os.IsNotExist(err) {
+		t.Error("a rejected restore should not create the profile")
+	}
+}
+
+func TestRestoreWithOptions_OnlyRejectsEntriesBelowSymlinks(t *testing.T) {
+	bm := setupManifestProfile(t)
+	home := os.Getenv("HOME")
+
+	// Each link stays inside the profile on its own, but together they
+	// lead out of it
+	backupPath := filepath.Join(bm.backupDir, "work-20240101-120000.tar.gz")
+	writeRawBackup(t, backupPath, []rawEntry{
+		{tar.Header{Name: "d/l1", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+		{tar.Header{Name: "d/l1/e/l2", Typeflag: tar.TypeSymlink, Linkname: "../../.."}, ""},
+		{tar.Header{Name: "d/l1/e/l2/pwned.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}, "owned"},
+	})
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Only: []string{"d"}}); err == nil {
+		t.Error("RestoreWithOptions should reject entries below a symlink")
+	}
+	for _, path := range []string{filepath.Join(home, "pwned.txt"), filepath.Join(bm.profilesDir, "work", "d")} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written by a rejected restore", path)
+		}
+	}
+}
+
+func TestRestoreWithOptions_OnlyKeepsProfileSymlinks(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// The user keeps agents elsewhere; restoring must not write there
+	outside := t.TempDir()
+	agents := filepath.Join(bm.profilesDir, "work", "agents")
+	if err := os.RemoveAll(agents); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, agents); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{Only: []string{"agents"}}); err == nil {
+		t.Error("RestoreWithOptions should refuse to write through a symlinked directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "tester.md")); !os.IsNotExist(err) {
+		t.Error("RestoreWithOptions wrote through a symlink of the profile")
+	}
+}
+
+func TestRestore_ForeignArchive(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	// As written by tar -czf other-....tar.gz -C profile .
+	backupPath := filepath.Join(bm.backupDir, "other-20240101-120000.tar.gz")
+	writeRawBackup(t, backupPath, []rawEntry{
+		{tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "./hooks/", Typeflag: tar.TypeDir, Mode: 0700}, ""},
+		{tar.Header{Name: "./hooks/lint.sh", Typeflag: tar.TypeReg, Mode: 0755}, "#!/bin/sh"},
+		{tar.Header{Name: "./.credentials.json", Typeflag: tar.TypeReg, Mode: 0600}, "{}"},
+		{tar.Header{Name: "./CLAUDE.md", Typeflag: tar.TypeReg, Mode: 04644}, "# Notes"},
+	})
+
+	if _, err := bm.Restore(backupPath, false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	modes := map[string]os.FileMode{
+		"hooks":             0700,
+		"hooks/lint.sh":     0755,
+		".credentials.json": 0600,
+		// Special bits are dropped
+		"CLAUDE.md": 0644,
+	}
+	for name, want := range modes {
+		info, err := os.Stat(filepath.Join(bm.profilesDir, "other", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode() & (os.ModePerm | os.ModeSetuid); got != want {
+			t.Errorf("%s mode = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRestore_SizeLimit(t *testing.T) {
+	bm := setupManifestProfile(t)
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	t.Run("size", func(t *testing.T) {
+		defer func(limit int64) { MaxRestoreSize = limit }(MaxRestoreSize)
+		MaxRestoreSize = 16
+
+		if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "too-big"}); err == nil || !strings.Contains(err.Error(), "limit") {
+			t.Errorf("RestoreWithOptions error = %v, want the size limit", err)
+		}
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		defer func(limit int) { MaxRestoreEntries = limit }(MaxRestoreEntries)
+		MaxRestoreEntries = 3
+
+		if _, err := bm.RestoreWithOptions(backupPath, RestoreOptions{As: "too-many"}); err == nil || !strings.Contains(err.Error(), "entries") {
+			t.Errorf("RestoreWithOptions error = %v, want the entry limit", err)
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(bm.profilesDir, "too-big")); !os.IsNotExist(err) {
+		t.Error("a restore over the limit should not create the profile")
+	}
+}
@@ -0,0 +1,363 @@
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3Storage
+type S3Options struct {
+	// Endpoint is the URL of the service. Buckets are addressed by path
+	// (endpoint/bucket/key), which AWS and MinIO both support.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// TempDir holds uploads while their checksum is computed
+	TempDir string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// S3Storage keeps backups as objects in an S3-compatible bucket. Requests
+// are signed with AWS Signature Version 4.
+type S3Storage struct {
+	opts     S3Options
+	endpoint *url.URL
+}
+
+// NewS3Storage returns a storage in a bucket
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s'", opts.Endpoint)
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &S3Storage{opts: opts, endpoint: endpoint}, nil
+}
+
+// Put uploads a backup. S3 needs the size and checksum up front, so r is
+// first copied to a temporary file unless it can seek.
+func (s *S3Storage) Put(name string, r io.Reader) error {
+	if err := checkStoredName(name); err != nil {
+		return err
+	}
+
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		tmp, err := os.CreateTemp(s.opts.TempDir, ".upload-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		body = tmp
+	}
+
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	// Never replace a backup with the same name
+	header.Set("If-None-Match", "*")
+	resp, err := s.do(http.MethodPut, s.key(name), nil, header, io.NopCloser(body), size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed:
+		return &fs.PathError{Op: "put", Path: location(s, name), Err: fs.ErrExist}
+	default:
+		return responseError(resp)
+	}
+}
+
+// Get downloads a backup
+func (s *S3Storage) Get(name string) (io.ReadCloser, error) {
+	if err := checkStoredName(name); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, s.key(name), nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, &fs.PathError{Op: "get", Path: location(s, name), Err: fs.ErrNotExist}
+		}
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// List returns the objects directly below the prefix
+func (s *S3Storage) List() ([]StoredFile, error) {
+	var files []StoredFile
+	token := ""
+	for {
+		// The delimiter leaves out the blobs of dedup backups
+		query := url.Values{"list-type": {"2"}, "prefix": {s.opts.Prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil, 0, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+		} else if decodeErr := xml.NewDecoder(resp.Body).Decode(&result); decodeErr != nil {
+			err = fmt.Errorf("failed to read bucket listing: %w", decodeErr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.opts.Prefix)
+			if checkStoredName(name) != nil {
+				continue
+			}
+			files = append(files, StoredFile{Name: name, Size: object.Size, ModTime: object.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Delete removes a backup. S3 reports success for objects that do not
+// exist, so it checks first.
+func (s *S3Storage) Delete(name string) error {
+	if err := checkStoredName(name); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return &fs.PathError{Op: "delete", Path: location(s, name), Err: fs.ErrNotExist}
+	default:
+		return fmt.Errorf("failed to check %s: %s", location(s, name), resp.Status)
+	}
+
+	resp, err = s.do(http.MethodDelete, s.key(name), nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (s *S3Storage) String() string {
+	return "s3://" + s.opts.Bucket + "/" + s.opts.Prefix
+}
+
+func (s *S3Storage) key(name string) string {
+	return s.opts.Prefix + name
+}
+
+// do sends a signed request for an object, or for the bucket when key is
+// empty
+func (s *S3Storage) do(method, key string, query url.Values, header http.Header, body io.ReadCloser, size int64, payloadHash string) (*http.Response, error) {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/") + "/" + s.opts.Bucket + "/" + key
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	if body == nil || size == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, time.Now())
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", s.endpoint.Host, err)
+	}
+	return resp, nil
+}
+
+// responseError turns an S3 error response into an error
+func responseError(resp *http.Response) error {
+	var body struct {
+		Code    string
+		Message string
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &body) != nil || body.Code == "" {
+		return fmt.Errorf("s3: %s", resp.Status)
+	}
+	return fmt.Errorf("s3: %s: %s: %s", resp.Status, body.Code, body.Message)
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signV4 signs req with AWS Signature Version 4. It covers the host and
+// every header already set on req, which must include X-Amz-Content-Sha256.
+func signV4(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query sorted by name, as SigV4 expects
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+// Storage keeps backup archives. Names are backup filenames without any
+// directory.
+type Storage interface {
+	// Put stores the content of r under name. It fails with an error
+	// matching fs.ErrExist when the name is taken, and leaves nothing behind
+	// when it fails.
+	Put(name string, r io.Reader) error
+	// Get opens a backup. It fails with an error matching fs.ErrNotExist
+	// when there is none with that name.
+	Get(name string) (io.ReadCloser, error)
+	// List returns every stored file, backups or not
+	List() ([]StoredFile, error)
+	// Delete removes a backup. It fails with an error matching
+	// fs.ErrNotExist when there is none with that name.
+	Delete(name string) error
+	// String tells where the backups are, for messages
+	String() string
+}
+
+// StoredFile describes a file in a Storage
+type StoredFile struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// DirStorage keeps backups as files in a directory
+type DirStorage struct {
+	dir string
+}
+
+// NewDirStorage returns a storage in dir, which must exist
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{dir: dir}
+}
+
+// Path returns the path of a backup in the directory
+func (s *DirStorage) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Put writes the backup to a temporary file first, so the directory never
+// holds a partial backup, even while a sync tool or another machine is
+// reading it
+func (s *DirStorage) Put(name string, r io.Reader) error {
+	if err := checkStoredName(name); err != nil {
+		return err
+	}
+	path := s.Path(name)
+	if _, err := os.Lstat(path); err == nil {
+		return &fs.PathError{Op: "put", Path: path, Err: fs.ErrExist}
+	}
+
+	// Blob directories are created with their first blob
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens a backup file
+func (s *DirStorage) Get(name string) (io.ReadCloser, error) {
+	if err := checkStoredName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(s.Path(name))
+}
+
+// List returns the files in the directory
+func (s *DirStorage) List() ([]StoredFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []StoredFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, StoredFile{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+// Delete removes a backup file
+func (s *DirStorage) Delete(name string) error {
+	if err := checkStoredName(name); err != nil {
+		return err
+	}
+	return os.Remove(s.Path(name))
+}
+
+func (s *DirStorage) String() string {
+	return s.dir
+}
+
+// checkStoredName rejects names that would reach outside the storage
+func checkStoredName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid backup name '%s'", name)
+	}
+	return nil
+}
+
+// location returns where a backup is kept: its path in a directory, or its
+// URL in other storages
+func location(s Storage, name string) string {
+	if dir, ok := s.(*DirStorage); ok {
+		return dir.Path(name)
+	}
+	return strings.TrimSuffix(s.String(), "/") + "/" + name
+}
+
+// OpenTarget returns the storage of a backup target. The target is "local"
+// for the backup directory, the name of an entry of backupTargets in
+// config.yaml, or the path of a directory.
+func (bm *BackupManager) OpenTarget(cfg *config.Config, name string) (Storage, error) {
+	if name == "" || name == config.LocalTarget {
+		return NewDirStorage(bm.backupDir), nil
+	}
+
+	target, ok := cfg.BackupTargets[name]
+	if !ok {
+		if !filepath.IsAbs(name) && !strings.ContainsRune(name, filepath.Separator) {
+			return nil, fmt.Errorf("unknown backup target '%s'; add it to backupTargets in config.yaml", name)
+		}
+		target = config.BackupTarget{Type: config.TargetDir, Path: name}
+	}
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("backup target '%s': %w", name, err)
+	}
+
+	switch target.Type {
+	case config.TargetS3:
+		accessKey, secretKey, err := target.Credentials()
+		if err != nil {
+			return nil, fmt.Errorf("backup target '%s': %w", name, err)
+		}
+		storage, err := NewS3Storage(S3Options{
+			Endpoint:  target.Endpoint,
+			Region:    target.RegionOrDefault(),
+			Bucket:    target.Bucket,
+			Prefix:    target.Prefix,
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			TempDir:   bm.backupDir,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup target '%s': %w", name, err)
+		}
+		return storage, nil
+	default:
+		// A share that is not mounted must not fill the local disk instead
+		dir := target.Dir()
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("backup target '%s': %s is not a directory; is it mounted?", name, dir)
+		}
+		return NewDirStorage(dir), nil
+	}
+}
@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+// testStorage checks the behaviour every Storage must have
+func testStorage(t *testing.T, s Storage) {
+	t.Helper()
+
+	if files, err := s.List(); err != nil || len(files) != 0 {
+		t.Fatalf("List() on an empty storage = %v, %v", files, err)
+	}
+
+	if err := s.Put("work-20240115-143022.tar.gz", strings.NewReader("first")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// A reader that cannot seek, like the archive pipe
+	if err := s.Put("home-20240115-143022.tar.gz", io.MultiReader(strings.NewReader("sec"), strings.NewReader("ond"))); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put("work-20240115-143022.tar.gz", strings.NewReader("replaced")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Put over an existing backup = %v, want fs.ErrExist", err)
+	}
+	if err := s.Put("../escape.tar.gz", strings.NewReader("x")); err == nil {
+		t.Error("Put accepted a name outside the storage")
+	}
+
+	r, err := s.Get("work-20240115-143022.tar.gz")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "first" {
+		t.Errorf("Get() = %q, want the first upload", data)
+	}
+	if _, err := s.Get("missing.tar.gz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get(missing) = %v, want fs.ErrNotExist", err)
+	}
+
+	files, err := s.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	sizes := map[string]int64{}
+	for _, file := range files {
+		sizes[file.Name] = file.Size
+	}
+	if len(sizes) != 2 || sizes["work-20240115-143022.tar.gz"] != 5 || sizes["home-20240115-143022.tar.gz"] != 6 {
+		t.Errorf("List() = %+v", files)
+	}
+
+	if err := s.Delete("work-20240115-143022.tar.gz"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete("work-20240115-143022.tar.gz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete(missing) = %v, want fs.ErrNotExist", err)
+	}
+	if files, _ := s.List(); len(files) != 1 {
+		t.Errorf("List() after Delete = %+v", files)
+	}
+}
+
+func TestDirStorage(t *testing.T) {
+	dir := t.TempDir()
+	testStorage(t, NewDirStorage(dir))
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want 1", len(entries))
+	}
+}
+
+func TestOpenTarget(t *testing.T) {
+	bm := setupManifestProfile(t)
+	nas := t.TempDir()
+	cfg := &config.Config{BackupTargets: map[string]config.BackupTarget{
+		"nas":       {Type: config.TargetDir, Path: nas},
+		"unmounted": {Type: config.TargetDir, Path: filepath.Join(nas, "missing")},
+		"offsite":   {Type: config.TargetS3, Endpoint: "http://127.0.0.1:9000", Bucket: "backups"},
+	}}
+
+	local, err := bm.OpenTarget(cfg, config.LocalTarget)
+	if err != nil || local.String() != bm.GetBackupDir() {
+		t.Errorf("OpenTarget(local) = %v, %v", local, err)
+	}
+	if s, err := bm.OpenTarget(cfg, "nas"); err != nil || s.String() != nas {
+		t.Errorf("OpenTarget(nas) = %v, %v", s, err)
+	}
+	if s, err := bm.OpenTarget(cfg, nas); err != nil || s.String() != nas {
+		t.Errorf("OpenTarget(<path>) = %v, %v", s, err)
+	}
+	if _, err := bm.OpenTarget(cfg, "unmounted"); err == nil || !strings.Contains(err.Error(), "mounted") {
+		t.Errorf("OpenTarget(unmounted) = %v, want an error", err)
+	}
+	if _, err := bm.OpenTarget(cfg, "elsewhere"); err == nil {
+		t.Error("OpenTarget accepted an unknown target")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := bm.OpenTarget(cfg, "offsite"); err == nil || !strings.Contains(err.Error(), "AWS_ACCESS_KEY_ID") {
+		t.Errorf("OpenTarget(offsite) without credentials = %v", err)
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if s, err := bm.OpenTarget(cfg, "offsite"); err != nil || s.String() != "s3://backups/" {
+		t.Errorf("OpenTarget(offsite) = %v, %v", s, err)
+	}
+}
+
+func TestBackupManager_MirrorStorage(t *testing.T) {
+	bm := setupManifestProfile(t)
+	mirror := t.TempDir()
+	bm.SetStorage(NewDirStorage(mirror))
+
+	backupPath, err := bm.Backup("work")
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if filepath.Dir(backupPath) != mirror {
+		t.Errorf("backup written to %s, want the mirror", backupPath)
+	}
+	if entries, _ := os.ReadDir(bm.GetBackupDir()); len(entries) != 0 {
+		t.Errorf("backup directory holds %d entries, want none", len(entries))
+	}
+
+	backups, err := bm.List()
+	if err != nil || len(backups) != 1 || !backups[0].HasManifest || backups[0].Path != backupPath {
+		t.Fatalf("List() = %+v, %v", backups, err)
+	}
+}
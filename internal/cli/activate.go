@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/executor"
+	"github.com/tiagokriok/cdp/internal/shellenv"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+// HandleActivate switches to a profile and writes the shell code that
+// activates it in the calling shell: to the file of the shell hook, or to
+// stdout for eval. Without a name the profile is resolved for the working
+// directory and only activated, without becoming the current profile.
+// Messages go to stderr, so stdout stays valid shell code.
+func HandleActivate(name string, shell shellenv.Shell) error {
+	makeCurrent := name != ""
+	if name == "" {
+		res, err := resolveProfile()
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			return fmt.Errorf("no profile given, none found for this directory and no profile is currently active")
+		}
+		name = res.Profile
+	}
+
+	profile, err := useProfile(name, makeCurrent, func(msg string) {
+		printStderr(ui.WarnSymbol, msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeActivation(profile, shell); err != nil {
+		return err
+	}
+
+	printStderr(ui.SuccessSymbol, fmt.Sprintf("Activated profile: %s", name))
+	if !hookActive() && term.IsTerminal(os.Stdout.Fd()) {
+		printStderr(ui.InfoSymbol, fmt.Sprintf("Nothing changed yet: run 'eval \"$(cdp activate %s)\"', or set up 'cdp init-shell'.", name))
+	}
+	return nil
+}
+
+// HandleDeactivate writes the shell code that undoes the profile active in
+// the calling shell
+func HandleDeactivate(shell shellenv.Shell) error {
+	environ := os.Environ()
+	name := executor.ActiveProfile(environ)
+	if name == "" {
+		printStderr(ui.InfoSymbol, "No profile is active in this shell.")
+		return nil
+	}
+
+	if err := writeShellCode(shell.Script(executor.Deactivate(environ))); err != nil {
+		return err
+	}
+	printStderr(ui.SuccessSymbol, fmt.Sprintf("Deactivated profile: %s", name))
+	return nil
+}
+
+// HandleInitShell prints the shell hook defining the cdp function
+func HandleInitShell(shell shellenv.Shell) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the cdp executable: %w", err)
+	}
+	fmt.Print(shell.Hook(executable))
+	return nil
+}
+
+// hookActive reports whether cdp was started by the shell hook
+func hookActive() bool {
+	return os.Getenv(executor.ActivateFileEnv) != ""
+}
+
+// writeActivation writes the shell code that activates profile
+func writeActivation(profile *config.Profile, shell shellenv.Shell) error {
+	changes, dropped := executor.Activate(os.Environ(), profile.Path, profile.Metadata.Env, profile.Metadata.UnsetEnv)
+	for _, key := range dropped {
+		printStderr(ui.WarnSymbol, fmt.Sprintf("Skipping environment variable %q of profile '%s': invalid name", key, profile.Name))
+	}
+	return writeShellCode(shell.Script(changes))
+}
+
+// writeShellCode hands shell code to the calling shell: through the file of
+// the shell hook, or on stdout
+func writeShellCode(code string) error {
+	path := os.Getenv(executor.ActivateFileEnv)
+	if path == "" {
+		fmt.Print(code)
+		return nil
+	}
+
+	// The hook created the file; never create one elsewhere
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to write shell code: %w", err)
+	}
+	if _, err := file.WriteString(code); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write shell code: %w", err)
+	}
+	return file.Close()
+}
+
+func printStderr(symbol, msg string) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", symbol, msg)
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/executor"
+	"github.com/tiagokriok/cdp/internal/shellenv"
+)
+
+// setupActivateFile sets up a profile and the file the shell hook passes
+func setupActivateFile(t *testing.T) string {
+	t.Helper()
+	_, cleanup := setupTestEnv(t)
+	t.Cleanup(cleanup)
+
+	if err := config.Init(); err != nil {
+		t.Fatalf("config.Init() failed: %v", err)
+	}
+	cfg, _ := config.Load()
+	pm := config.NewProfileManager(cfg)
+	if err := pm.CreateProfile("work", "Work profile"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SetEnv("work", map[string]string{"HTTPS_PROXY": "http://proxy.corp:8080"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "cdp-activate")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(executor.ActivateFileEnv, file)
+	return file
+}
+
+func TestHandleActivate(t *testing.T) {
+	file := setupActivateFile(t)
+
+	if err := HandleActivate("work", shellenv.Bash); err != nil {
+		t.Fatalf("HandleActivate() failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(file)
+	code := string(data)
+	for _, want := range []string{"export CLAUDE_PROFILE='work';", "export HTTPS_PROXY='http://proxy.corp:8080';", "export CLAUDE_CONFIG_DIR="} {
+		if !strings.Contains(code, want) {
+			t.Errorf("shell code lacks %q:\n%s", want, code)
+		}
+	}
+
+	cfg, _ := config.Load()
+	if cfg.GetCurrentProfile() != "work" {
+		t.Errorf("Current profile = %q, want work", cfg.GetCurrentProfile())
+	}
+
+	if err := HandleActivate("missing", shellenv.Bash); err == nil {
+		t.Error("HandleActivate() should fail for a non-existent profile")
+	}
+}
+
+func TestHandleDeactivate(t *testing.T) {
+	file := setupActivateFile(t)
+
+	// Nothing active: no code
+	if err := HandleDeactivate(shellenv.Bash); err != nil {
+		t.Fatalf("HandleDeactivate() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); len(data) != 0 {
+		t.Errorf("HandleDeactivate() without a profile wrote %q", data)
+	}
+
+	t.Setenv("CLAUDE_PROFILE", "work")
+	t.Setenv("_CDP_ACTIVE_VARS", "CLAUDE_PROFILE")
+	if err := HandleDeactivate(shellenv.Fish); err != nil {
+		t.Fatalf("HandleDeactivate() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "set -e CLAUDE_PROFILE;") {
+		t.Errorf("shell code = %q", data)
+	}
+}
+
+func TestHandleSwitch_NoRunActivatesWithHook(t *testing.T) {
+	file := setupActivateFile(t)
+	t.Setenv(executor.ShellEnv, "zsh")
+
+	if err := HandleSwitch("work", nil, true); err != nil {
+		t.Fatalf("HandleSwitch() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "export CLAUDE_PROFILE='work';") {
+		t.Errorf("shell code = %q", data)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/cli"
+	"github.com/tiagokriok/cdp/internal/shellenv"
+)
+
+var shellFlag string
+
+// activateCmd represents the activate command
+var activateCmd = &cobra.Command{
+	Use:   "activate [profile]",
+	Short: "Activate a profile in the current shell",
+	Long: `Switches to a profile and prints the shell code that exports
+CLAUDE_CONFIG_DIR, CLAUDE_PROFILE and the profile's environment variables,
+so plain 'claude' in this shell uses the profile. Without a profile, the one
+resolved for the current directory is activated (see 'cdp which').
+
+Evaluate the output in your shell:
+  eval "$(cdp activate work)"                   # bash, zsh
+  cdp activate work | source                    # fish
+  cdp activate work | Out-String | Invoke-Expression   # PowerShell
+
+or install the shell hook once with 'cdp init-shell', after which
+'cdp activate work', 'cdp work --no-run' and the interactive menu change the
+shell directly. 'cdp deactivate' restores the previous environment.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell, err := selectedShell()
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		return cli.HandleActivate(name, shell)
+	},
+}
+
+// deactivateCmd represents the deactivate command
+var deactivateCmd = &cobra.Command{
+	Use:   "deactivate",
+	Short: "Undo 'cdp activate' in the current shell",
+	Long: `Prints the shell code that restores the environment the current shell
+had before 'cdp activate'. Evaluate it like the output of activate:
+  eval "$(cdp deactivate)"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell, err := selectedShell()
+		if err != nil {
+			return err
+		}
+		return cli.HandleDeactivate(shell)
+	},
+}
+
+// initShellCmd represents the init-shell command
+var initShellCmd = &cobra.Command{
+	Use:   "init-shell [bash|zsh|fish|powershell]",
+	Short: "Print the shell hook for 'cdp activate'",
+	Long: `Prints a cdp shell function that lets cdp change the calling shell, so
+'cdp activate', 'cdp deactivate', 'cdp <profile> --no-run' and the
+interactive menu take effect without eval. Without an argument the shell is
+detected from $SHELL.
+
+Add it to your shell's startup file:
+  eval "$(cdp init-shell bash)"                      # ~/.bashrc
+  eval "$(cdp init-shell zsh)"                       # ~/.zshrc
+  cdp init-shell fish | source                       # ~/.config/fish/config.fish
+  cdp init-shell powershell | Out-String | Invoke-Expression   # $PROFILE`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := shellenv.Detect()
+		if len(args) == 1 {
+			var err error
+			if shell, err = shellenv.Parse(args[0]); err != nil {
+				return err
+			}
+		}
+		return cli.HandleInitShell(shell)
+	},
+}
+
+// selectedShell returns the shell from --shell, or the detected one
+func selectedShell() (shellenv.Shell, error) {
+	if shellFlag != "" {
+		return shellenv.Parse(shellFlag)
+	}
+	return shellenv.Detect(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(activateCmd)
+	rootCmd.AddCommand(deactivateCmd)
+	rootCmd.AddCommand(initShellCmd)
+
+	for _, cmd := range []*cobra.Command{activateCmd, deactivateCmd} {
+		cmd.Flags().StringVar(&shellFlag, "shell", "", "Shell to print code for: bash, zsh, fish or powershell (default: detected)")
+	}
+}
@@ -2,14 +2,34 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tiagokriok/cdp/internal/backup"
 	"github.com/tiagokriok/cdp/internal/config"
 	"github.com/tiagokriok/cdp/internal/ui"
+	"github.com/tiagokriok/cdp/pkg/encryption"
 )
 
-var overwriteFlag bool
+var (
+	overwriteFlag   bool
+	noteFlag        string
+	restoreAsFlag   string
+	restoreOnlyFlag []string
+
+	pruneProfileFlag    string
+	pruneKeepLastFlag   int
+	pruneKeepDailyFlag  int
+	pruneKeepWeeklyFlag int
+	pruneDryRunFlag     bool
+	backupAllPruneFlag  bool
+
+	backupToFlag   string
+	backupFromFlag string
+	dedupFlag      bool
+)
 
 // backupCmd represents the backup command
 var backupCmd = &cobra.Command{
@@ -19,9 +39,44 @@ var backupCmd = &cobra.Command{
 
 Commands:
   cdp backup <profile>       - Create a backup of a profile
+  cdp backup all             - Create a backup of every profile
   cdp backup list            - List all backups
   cdp backup restore <file>  - Restore a profile from backup
-  cdp backup delete <file>   - Delete a backup file`,
+  cdp backup show <file>     - List the files in a backup
+  cdp backup verify <file>   - Check a backup against its manifest
+  cdp backup delete <file>   - Delete a backup file
+  cdp backup prune           - Remove backups outside the retention policy
+
+Backups are kept in ~/.cdp/backups. Use --to with create and all, and --from
+with the other commands, to keep them elsewhere: a directory such as a mounted
+NAS share or a Syncthing folder, or an S3-compatible bucket (AWS S3, MinIO).
+Targets are named in the backupTargets section of config.yaml:
+
+  backupTargets:
+    nas:
+      type: dir
+      path: /mnt/nas/cdp-backups
+    offsite:
+      type: s3
+      endpoint: https://s3.eu-west-1.amazonaws.com
+      region: eu-west-1
+      bucket: my-backups
+      prefix: laptop/
+
+S3 credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or
+from the variables named by accessKeyEnv and secretKeyEnv. --to and --from
+also take the path of a directory, and "local" for ~/.cdp/backups.
+
+With --dedup, or backupDedup: true in config.yaml, a backup stores each file
+once in the blobs directory of the target, shared with earlier dedup backups,
+and a small snapshot listing them. Daily backups of a large profile then only
+add the files that changed. Blobs no backup uses any more are removed by
+'cdp backup prune'.
+
+Example:
+  cdp backup create work --to offsite
+  cdp backup list --from offsite
+  cdp backup restore work-20240115-143022.tar.gz --from offsite --as work-old`,
 }
 
 // backupCreateCmd creates a backup
@@ -37,21 +92,184 @@ var backupCreateCmd = &cobra.Command{
 			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
 		}
 
-		bm, err := backup.NewBackupManager(cfg.GetProfilesDir())
+		bm, err := newBackupManager(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to initialize backup manager: %w", err)
+			return err
+		}
+		if err := useBackupTarget(cfg, bm, backupToFlag); err != nil {
+			return err
 		}
 
-		backupPath, err := bm.Backup(profileName)
+		backupPath, err := bm.BackupWithOptions(profileName, backup.Options{Note: noteFlag, CdpVersion: Version, Dedup: dedupFlag || cfg.BackupDedup})
 		if err != nil {
 			return fmt.Errorf("failed to create backup: %w", err)
 		}
 
-		ui.Success(fmt.Sprintf("Backup created: %s", backupPath))
+		ui.Success(fmt.Sprintf("Backup created: %s%s", backupPath, encryptedLabel(backupPath)))
+		return nil
+	},
+}
+
+// backupAllCmd creates a backup of every profile
+var backupAllCmd = &cobra.Command{
+	Use:   "all",
+	Short: "Create a backup of every profile",
+	Long: `Creates a backup of every profile in one run, for use from cron or a
+systemd timer. A profile that fails to back up does not stop the others, but
+the command exits with an error.
+
+With --prune, backups outside the backupRetention policy in config.yaml are
+removed afterwards.
+
+Example crontab entry:
+  0 3 * * * cdp backup all --prune`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+
+		if backupAllPruneFlag && (cfg.BackupRetention == nil || cfg.BackupRetention.IsZero()) {
+			return fmt.Errorf("--prune needs a backupRetention policy in config.yaml")
+		}
+
+		bm, err := newBackupManager(cfg)
+		if err != nil {
+			return err
+		}
+		if err := useBackupTarget(cfg, bm, backupToFlag); err != nil {
+			return err
+		}
+
+		profiles, err := config.NewProfileManager(cfg).ListProfiles()
+		if err != nil {
+			return fmt.Errorf("failed to list profiles: %w", err)
+		}
+		if len(profiles) == 0 {
+			ui.Info("No profiles to back up.")
+			return nil
+		}
+
+		var failed []string
+		for _, profile := range profiles {
+			backupPath, err := bm.BackupWithOptions(profile.Name, backup.Options{Note: noteFlag, CdpVersion: Version, Dedup: dedupFlag || cfg.BackupDedup})
+			if err != nil {
+				ui.Error(fmt.Sprintf("%s: %v", profile.Name, err))
+				failed = append(failed, profile.Name)
+				continue
+			}
+			ui.Success(fmt.Sprintf("%s: %s%s", profile.Name, filepath.Base(backupPath), encryptedLabel(backupPath)))
+		}
+
+		if backupAllPruneFlag {
+			result, err := bm.Prune(backup.PruneOptions{Policy: *cfg.BackupRetention})
+			if err != nil {
+				return fmt.Errorf("failed to prune backups: %w", err)
+			}
+			ui.Info(fmt.Sprintf("Pruned %d backup(s), freed %s", len(result.Removed), formatBytes(result.Freed)))
+			printBlobCollection(result, false)
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to back up %d of %d profile(s): %s", len(failed), len(profiles), strings.Join(failed, ", "))
+		}
 		return nil
 	},
 }
 
+// backupPruneCmd removes old backups
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove backups outside the retention policy",
+	Long: `Removes old backups, keeping for each profile:
+
+  --keep-last N     the N newest backups
+  --keep-daily D    the newest backup of each of the last D days with backups
+  --keep-weekly W   the newest backup of each of the last W weeks with backups
+
+A backup is kept when any rule keeps it. Rules not given on the command line
+come from the backupRetention section of config.yaml:
+
+  backupRetention:
+    keepLast: 5
+    keepDaily: 7
+    keepWeekly: 4
+
+Use --dry-run to see what would be removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+
+		bm, err := newBackupManager(cfg)
+		if err != nil {
+			return err
+		}
+		if err := useBackupTarget(cfg, bm, backupFromFlag); err != nil {
+			return err
+		}
+
+		var policy config.RetentionPolicy
+		if cfg.BackupRetention != nil {
+			policy = *cfg.BackupRetention
+		}
+		if cmd.Flags().Changed("keep-last") {
+			policy.KeepLast = pruneKeepLastFlag
+		}
+		if cmd.Flags().Changed("keep-daily") {
+			policy.KeepDaily = pruneKeepDailyFlag
+		}
+		if cmd.Flags().Changed("keep-weekly") {
+			policy.KeepWeekly = pruneKeepWeeklyFlag
+		}
+		if policy.IsZero() {
+			return fmt.Errorf("no retention policy: use --keep-last, --keep-daily or --keep-weekly, or set backupRetention in config.yaml")
+		}
+
+		result, err := bm.Prune(backup.PruneOptions{Policy: policy, Profile: pruneProfileFlag, DryRun: pruneDryRunFlag})
+		if err != nil {
+			return fmt.Errorf("failed to prune backups: %w", err)
+		}
+
+		if len(result.Removed) == 0 {
+			ui.Info(fmt.Sprintf("Nothing to prune; keeping %d backup(s).", len(result.Kept)))
+			printBlobCollection(result, pruneDryRunFlag)
+			return nil
+		}
+
+		verb := "Removed"
+		if pruneDryRunFlag {
+			verb = "Would remove"
+		}
+		for _, b := range result.Removed {
+			fmt.Printf("  %s %s\n", ui.DimStyle.Render("-"), b.Name)
+		}
+		fmt.Println()
+		ui.Success(fmt.Sprintf("%s %d backup(s), freeing %s; keeping %d.", verb, len(result.Removed), formatBytes(result.Freed), len(result.Kept)))
+		printBlobCollection(result, pruneDryRunFlag)
+		return nil
+	},
+}
+
+// printBlobCollection reports the dedup blobs a prune removed
+func printBlobCollection(result *backup.PruneResult, dryRun bool) {
+	if result.BlobsErr != nil {
+		ui.Warn(fmt.Sprintf("Unused blobs were not removed: %v", result.BlobsErr))
+		return
+	}
+	if result.Blobs == 0 {
+		return
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	ui.Info(fmt.Sprintf("%s %d unused blob(s), freeing %s.", verb, result.Blobs, formatBytes(result.BlobsFreed)))
+}
+
 // backupListCmd lists all backups
 var backupListCmd = &cobra.Command{
 	Use:   "list",
@@ -62,9 +280,12 @@ var backupListCmd = &cobra.Command{
 			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
 		}
 
-		bm, err := backup.NewBackupManager(cfg.GetProfilesDir())
+		bm, err := newBackupManager(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to initialize backup manager: %w", err)
+			return err
+		}
+		if err := useBackupTarget(cfg, bm, backupFromFlag); err != nil {
+			return err
 		}
 
 		backups, err := bm.List()
@@ -87,10 +308,34 @@ var backupListCmd = &cobra.Command{
 			fmt.Printf("    Profile: %s\n", b.ProfileName)
 			fmt.Printf("    Created: %s\n", b.CreatedAt.Format("2006-01-02 15:04:05"))
 			fmt.Printf("    Size: %s\n", formatBytes(b.Size))
+			switch {
+			case b.HasManifest:
+				fmt.Printf("    Files: %d\n", b.FileCount)
+			case b.Encrypted:
+				fmt.Printf("    Files: %s\n", ui.DimStyle.Render("unknown (encrypted)"))
+			default:
+				fmt.Printf("    Files: %s\n", ui.DimStyle.Render("unknown (no manifest)"))
+			}
+			if b.Encrypted {
+				fmt.Println("    Encrypted: yes")
+			}
+			if b.Snapshot {
+				fmt.Println("    Deduplicated: yes")
+			}
+			if b.Operation != "" {
+				fmt.Printf("    Automatic: before %s\n", b.Operation)
+			}
+			if b.Note != "" {
+				fmt.Printf("    Note: %s\n", b.Note)
+			}
 			fmt.Println()
 		}
 
-		fmt.Printf("Backup directory: %s\n", bm.GetBackupDir())
+		if backupFromFlag != "" {
+			fmt.Printf("Backup target: %s\n", bm.Storage())
+		} else {
+			fmt.Printf("Backup directory: %s\n", bm.GetBackupDir())
+		}
 		return nil
 	},
 }
@@ -104,7 +349,18 @@ var backupRestoreCmd = &cobra.Command{
 The backup file can be specified as just the filename (if in default backup directory)
 or as a full path.
 
-Use --overwrite to replace an existing profile with the same name.`,
+Use --overwrite to replace an existing profile with the same name, or --as to
+restore alongside it under a new name.
+
+Use --only to pull single files back into an existing profile without touching
+the rest of it, e.g. to recover settings.json while keeping the current login.
+Patterns are matched against the paths shown by 'cdp backup show'; a directory
+selects everything below it.
+
+Examples:
+  cdp backup restore work-20240115-143022.tar.gz --as work-old
+  cdp backup restore work-20240115-143022.tar.gz --only settings.json
+  cdp backup restore work-20240115-143022.tar.gz --only 'commands/*.md' --only agents`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		backupFile := args[0]
@@ -114,22 +370,153 @@ Use --overwrite to replace an existing profile with the same name.`,
 			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
 		}
 
-		bm, err := backup.NewBackupManager(cfg.GetProfilesDir())
+		bm, err := newBackupManager(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to initialize backup manager: %w", err)
+			return err
 		}
 
-		// If not a path, assume it's in the backup directory
-		if backupFile[0] != '/' && backupFile[0] != '.' {
-			backupFile = fmt.Sprintf("%s/%s", bm.GetBackupDir(), backupFile)
+		if len(restoreOnlyFlag) > 0 && overwriteFlag {
+			return fmt.Errorf("--overwrite cannot be used with --only; matching files are always replaced")
 		}
 
-		profileName, err := bm.Restore(backupFile, overwriteFlag)
+		backupPath, cleanup, err := backupFilePath(cfg, bm, backupFile)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		result, err := bm.RestoreWithOptions(backupPath, backup.RestoreOptions{
+			As:              restoreAsFlag,
+			Only:            restoreOnlyFlag,
+			Overwrite:       overwriteFlag,
+			BeforeOverwrite: backupBeforeRestore(cfg, backupPath),
+		})
 		if err != nil {
-			return fmt.Errorf("failed to restore backup: %w", err)
+			return fmt.Errorf("failed to restore backup: %w", decryptHint(err))
 		}
 
-		ui.Success(fmt.Sprintf("Profile '%s' restored successfully!", profileName))
+		if len(restoreOnlyFlag) > 0 {
+			ui.Success(fmt.Sprintf("Restored %d file(s) into profile '%s':", len(result.Files), result.Profile))
+			for _, file := range result.Files {
+				fmt.Printf("  %s\n", file)
+			}
+			return nil
+		}
+
+		ui.Success(fmt.Sprintf("Profile '%s' restored successfully!", result.Profile))
+		return nil
+	},
+}
+
+// backupShowCmd lists the content of a backup
+var backupShowCmd = &cobra.Command{
+	Use:   "show <backup-file>",
+	Short: "List the files in a backup",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+
+		bm, err := newBackupManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		backupPath, cleanup, err := backupFilePath(cfg, bm, args[0])
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		manifest, entries, err := bm.Contents(backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", decryptHint(err))
+		}
+		encrypted, _ := encryption.IsEncryptedFile(backupPath)
+
+		ui.Header(fmt.Sprintf("Backup %s", filepath.Base(args[0])))
+		if manifest != nil {
+			fmt.Printf("  Profile: %s\n", manifest.Profile)
+			fmt.Printf("  Created: %s\n", manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+			if manifest.CdpVersion != "" {
+				fmt.Printf("  cdp version: %s\n", manifest.CdpVersion)
+			}
+			if manifest.Note != "" {
+				fmt.Printf("  Note: %s\n", manifest.Note)
+			}
+			if encrypted {
+				fmt.Println("  Encrypted: yes")
+			}
+		} else {
+			fmt.Printf("  %s\n", ui.DimStyle.Render("No manifest (created by an older cdp)"))
+		}
+		fmt.Println()
+
+		files := 0
+		for _, entry := range entries {
+			switch {
+			case entry.IsDir:
+				fmt.Printf("  %s  %8s  %s/\n", entry.Mode, "", entry.Path)
+			case entry.Link != "":
+				files++
+				fmt.Printf("  %s  %8s  %s -> %s\n", entry.Mode, "", entry.Path, entry.Link)
+			default:
+				files++
+				fmt.Printf("  %s  %8s  %s\n", entry.Mode, formatBytes(entry.Size), entry.Path)
+			}
+		}
+
+		fmt.Printf("\n%d file(s)\n", files)
+		return nil
+	},
+}
+
+// backupVerifyCmd checks a backup without extracting it
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify <backup-file>",
+	Short: "Check a backup against its manifest",
+	Long: `Reads a backup archive without extracting it and checks the size and
+SHA-256 of every file against the manifest stored in the archive.
+
+Backups created before manifests existed are only checked for readability.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+
+		bm, err := newBackupManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		backupPath, cleanup, err := backupFilePath(cfg, bm, args[0])
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		result, err := bm.Verify(backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify backup: %w", decryptHint(err))
+		}
+
+		if !result.OK() {
+			for _, problem := range result.Problems {
+				ui.Error(problem)
+			}
+			return fmt.Errorf("backup '%s' failed verification (%d problem(s))", args[0], len(result.Problems))
+		}
+
+		if result.Manifest == nil {
+			ui.Warn(fmt.Sprintf("Backup has no manifest; %d file(s) are readable but cannot be checked", result.Files))
+			return nil
+		}
+
+		ui.Success(fmt.Sprintf("Backup of '%s' verified: %d file(s) match the manifest", result.Manifest.Profile, result.Files))
 		return nil
 	},
 }
@@ -147,9 +534,12 @@ var backupDeleteCmd = &cobra.Command{
 			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
 		}
 
-		bm, err := backup.NewBackupManager(cfg.GetProfilesDir())
+		bm, err := newBackupManager(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to initialize backup manager: %w", err)
+			return err
+		}
+		if err := useBackupTarget(cfg, bm, backupFromFlag); err != nil {
+			return err
 		}
 
 		if err := bm.Delete(backupFile); err != nil {
@@ -161,6 +551,58 @@ var backupDeleteCmd = &cobra.Command{
 	},
 }
 
+// backupBeforeRestore backs up a profile before a restore replaces its data,
+// if the autoBackup policy asks for it
+func backupBeforeRestore(cfg *config.Config, backupPath string) func(string) error {
+	return func(profile string) error {
+		return cfg.BackupBefore(profile, config.BackupBeforeRestore, fmt.Sprintf("replaced by %s", filepath.Base(backupPath)))
+	}
+}
+
+// useBackupTarget makes bm keep backups in the target named by --to or
+// --from, if any
+func useBackupTarget(cfg *config.Config, bm *backup.BackupManager, target string) error {
+	if target == "" {
+		return nil
+	}
+	storage, err := bm.OpenTarget(cfg, target)
+	if err != nil {
+		return err
+	}
+	bm.SetStorage(storage)
+	return nil
+}
+
+// backupFilePath returns the path of the backup given on the command line.
+// With --from, the backup is downloaded from the target first; the returned
+// func removes the download.
+func backupFilePath(cfg *config.Config, bm *backup.BackupManager, backupFile string) (string, func(), error) {
+	if backupFromFlag == "" {
+		return resolveBackupPath(bm, backupFile), func() {}, nil
+	}
+	if err := useBackupTarget(cfg, bm, backupFromFlag); err != nil {
+		return "", nil, err
+	}
+	return bm.Fetch(backupFile)
+}
+
+// resolveBackupPath returns the path of a backup given as a path or as a
+// filename in the backup directory
+func resolveBackupPath(bm *backup.BackupManager, backupFile string) string {
+	if _, err := os.Stat(backupFile); err == nil || filepath.IsAbs(backupFile) || strings.ContainsRune(backupFile, filepath.Separator) {
+		return backupFile
+	}
+	return filepath.Join(bm.GetBackupDir(), backupFile)
+}
+
+// encryptedLabel marks encrypted backups in messages
+func encryptedLabel(backupPath string) string {
+	if strings.HasSuffix(backupPath, backup.EncryptedExt) {
+		return " (encrypted)"
+	}
+	return ""
+}
+
 func formatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -177,9 +619,36 @@ func formatBytes(bytes int64) string {
 func init() {
 	rootCmd.AddCommand(backupCmd)
 	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupAllCmd)
+	backupCmd.AddCommand(backupPruneCmd)
 	backupCmd.AddCommand(backupListCmd)
 	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupShowCmd)
+	backupCmd.AddCommand(backupVerifyCmd)
 	backupCmd.AddCommand(backupDeleteCmd)
 
+	backupCreateCmd.Flags().StringVar(&noteFlag, "note", "", "Note stored in the backup manifest")
+	addEncryptFlags(backupCreateCmd)
+	backupAllCmd.Flags().StringVar(&noteFlag, "note", "", "Note stored in each backup manifest")
+	addEncryptFlags(backupAllCmd)
+	backupAllCmd.Flags().BoolVar(&backupAllPruneFlag, "prune", false, "Apply the backupRetention policy from config.yaml afterwards")
+	backupPruneCmd.Flags().StringVar(&pruneProfileFlag, "profile", "", "Only prune the backups of this profile")
+	backupPruneCmd.Flags().IntVar(&pruneKeepLastFlag, "keep-last", 0, "Keep the N newest backups of each profile")
+	backupPruneCmd.Flags().IntVar(&pruneKeepDailyFlag, "keep-daily", 0, "Keep the newest backup of each of the last D days with backups")
+	backupPruneCmd.Flags().IntVar(&pruneKeepWeeklyFlag, "keep-weekly", 0, "Keep the newest backup of each of the last W weeks with backups")
+	backupPruneCmd.Flags().BoolVar(&pruneDryRunFlag, "dry-run", false, "Show what would be removed without removing anything")
 	backupRestoreCmd.Flags().BoolVar(&overwriteFlag, "overwrite", false, "Overwrite existing profile if it exists")
+	backupRestoreCmd.Flags().StringVar(&restoreAsFlag, "as", "", "Restore under a different profile name")
+	backupRestoreCmd.Flags().StringSliceVar(&restoreOnlyFlag, "only", nil, "Restore only files matching these patterns into the existing profile")
+	// prune reads encrypted dedup snapshots to find the blobs still in use
+	for _, cmd := range []*cobra.Command{backupListCmd, backupRestoreCmd, backupShowCmd, backupVerifyCmd, backupPruneCmd, backupAllCmd} {
+		addIdentityFlag(cmd)
+	}
+	for _, cmd := range []*cobra.Command{backupCreateCmd, backupAllCmd} {
+		cmd.Flags().StringVar(&backupToFlag, "to", "", "Keep the backup in this target from backupTargets, or directory")
+		cmd.Flags().BoolVar(&dedupFlag, "dedup", false, "Store files once, shared with earlier dedup backups")
+	}
+	for _, cmd := range []*cobra.Command{backupListCmd, backupRestoreCmd, backupShowCmd, backupVerifyCmd, backupDeleteCmd, backupPruneCmd} {
+		cmd.Flags().StringVar(&backupFromFlag, "from", "", "Use the backups in this target from backupTargets, or directory")
+	}
 }
@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tiagokriok/cdp/internal/config"
 	"github.com/tiagokriok/cdp/internal/ui"
 )
 
+var (
+	cloneOnlyFlag           []string
+	cloneExcludeHistoryFlag bool
+	cloneNoCredentialsFlag  bool
+)
+
 // cloneCmd represents the clone command
 var cloneCmd = &cobra.Command{
 	Use:   "clone <source> <destination>",
@@ -15,13 +22,20 @@ var cloneCmd = &cobra.Command{
 	Long: `Creates a copy of an existing profile with a new name.
 
 The cloned profile will have:
-- All configuration files from the source
+- All files and subdirectories from the source, with their permissions
 - Reset usage count and last used timestamp
 - New creation timestamp
 
+Use --only to copy selected components:
+` + describeComponents() + `
+Use --no-credentials to share a setup without sharing a login: the clone
+gets an empty .claude.json and has to log in again.
+
 Example:
   cdp clone work work-backup
-  cdp clone personal personal-test`,
+  cdp clone personal personal-test
+  cdp clone work teammate --only settings,commands,agents --no-credentials
+  cdp clone work work-clean --exclude-history`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
@@ -34,17 +48,39 @@ Example:
 
 		pm := config.NewProfileManager(cfg)
 
-		if err := pm.CloneProfile(source, dest); err != nil {
+		opts := config.CloneOptions{
+			Only:           cloneOnlyFlag,
+			ExcludeHistory: cloneExcludeHistoryFlag,
+			NoCredentials:  cloneNoCredentialsFlag,
+		}
+		copied, err := pm.CloneProfileWithOptions(source, dest, opts)
+		if err != nil {
 			return fmt.Errorf("failed to clone profile: %w", err)
 		}
 
-		ui.Success(fmt.Sprintf("Profile '%s' cloned to '%s'", source, dest))
+		ui.Success(fmt.Sprintf("Profile '%s' cloned to '%s' (%d file(s) copied)", source, dest, len(copied)))
 		fmt.Printf("Location: %s/%s\n", cfg.GetProfilesDir(), dest)
+		if cloneNoCredentialsFlag {
+			ui.Info(fmt.Sprintf("Credentials and secret environment variables were not copied. Log in when you first run 'cdp %s'.", dest))
+		}
 
 		return nil
 	},
 }
 
+// describeComponents lists the profile components for help text
+func describeComponents() string {
+	var b strings.Builder
+	for _, component := range config.ProfileComponents {
+		fmt.Fprintf(&b, "  %-12s %s\n", component.Name, component.Description)
+	}
+	return b.String()
+}
+
 func init() {
 	rootCmd.AddCommand(cloneCmd)
+
+	cloneCmd.Flags().StringSliceVar(&cloneOnlyFlag, "only", nil, "Copy only these components (comma-separated)")
+	cloneCmd.Flags().BoolVar(&cloneExcludeHistoryFlag, "exclude-history", false, "Do not copy conversation history, todos and shell snapshots")
+	cloneCmd.Flags().BoolVar(&cloneNoCredentialsFlag, "no-credentials", false, "Do not copy .claude.json and .credentials.json")
 }
@@ -23,9 +23,16 @@ Create from scratch with optional template:
   cdp create work "Work profile" --template restrictive
   cdp create personal "Personal" --template permissive
 
-Import existing Claude configuration:
+Import existing Claude configuration, including subdirectories such as
+commands/, agents/ and projects/:
   cdp create work --import-from ~/.config/claude-code --description "Work profile"
   cdp create work --import-from ~/backups/claude-2024
+  cdp create work --import-from ~/.claude --only settings,commands,agents
+
+Import without prompts, e.g. from a setup script:
+  cdp create work --import-from ~/.claude --yes
+  cdp create work --import-from ~/.claude --yes --overwrite --move
+  cdp create work --import-from ~/.claude --dry-run --json
 
 Available templates: restrictive, permissive`,
 	Args: cobra.RangeArgs(1, 2), // Expect 1 or 2 arguments
@@ -42,10 +49,17 @@ Available templates: restrictive, permissive`,
 		if importFromFlag != "" && templateFlag != "" {
 			return fmt.Errorf("cannot use --import-from with --template")
 		}
+		if importFromFlag == "" {
+			for _, name := range importFlagNames {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s can only be used with --import-from", name)
+				}
+			}
+		}
 
 		// Route to appropriate handler
 		if importFromFlag != "" {
-			return cli.HandleImport(importFromFlag, profileName, description)
+			return runImport(importFromFlag, profileName, importOptions(description))
 		}
 
 		return cli.HandleCreateWithTemplate(profileName, description, templateFlag)
@@ -57,4 +71,5 @@ func init() {
 	createCmd.Flags().StringVarP(&templateFlag, "template", "t", "", "Template to apply (restrictive, permissive)")
 	createCmd.Flags().StringVar(&importFromFlag, "import-from", "", "Import existing Claude config from directory")
 	createCmd.Flags().StringVarP(&descriptionFlag, "description", "d", "", "Profile description")
+	addImportFlags(createCmd)
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/doctor"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+var (
+	doctorFixFlag  bool
+	doctorJSONFlag bool
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the cdp installation for problems",
+	Long: `Checks everything cdp depends on:
+  - config.yaml parses, has a supported version and its profilesDir exists
+  - the current profile exists
+  - every profile has readable metadata and valid Claude files
+  - the alias block markers in your shell RC file are balanced
+  - the claude executable can be found
+  - backups in ~/.cdp/backups are readable archives
+
+Use --fix to repair what can be repaired safely, such as recreating missing
+placeholder files or clearing a current profile that no longer exists.
+
+Example:
+  cdp doctor
+  cdp doctor --fix
+  cdp doctor --json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report := doctor.Run(doctor.Options{Fix: doctorFixFlag})
+
+		if doctorJSONFlag {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report: %w", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printDoctorReport(report)
+		}
+
+		if report.HasErrors() {
+			return fmt.Errorf("cdp doctor found problems")
+		}
+		return nil
+	},
+}
+
+// printDoctorReport prints the doctor results
+func printDoctorReport(report *doctor.Report) {
+	fixable := 0
+	for _, result := range report.Results {
+		line := fmt.Sprintf("%s: %s", result.Check, result.Message)
+		switch {
+		case result.Fixed:
+			ui.Success(fmt.Sprintf("%s %s", line, ui.DimStyle.Render("(fixed: "+result.Fix+")")))
+		case result.Status == doctor.StatusError:
+			ui.Error(line)
+		case result.Status == doctor.StatusWarning:
+			ui.Warn(line)
+		default:
+			ui.Success(line)
+		}
+
+		if result.Fix != "" && !result.Fixed {
+			fixable++
+			fmt.Printf("    %s\n", ui.DimStyle.Render("fix: "+result.Fix))
+		}
+	}
+
+	if fixable > 0 && !doctorFixFlag {
+		fmt.Println()
+		ui.Info("Run 'cdp doctor --fix' to repair the fixable problems.")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().BoolVar(&doctorFixFlag, "fix", false, "Repair problems that can be fixed safely")
+	doctorCmd.Flags().BoolVar(&doctorJSONFlag, "json", false, "Output the results as JSON")
+}
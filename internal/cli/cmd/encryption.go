@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/backup"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+// passphraseEnv holds the passphrase for scripts and cron jobs
+const passphraseEnv = "CDP_PASSPHRASE"
+
+var (
+	encryptFlag   bool
+	recipientFlag []string
+	identityFlag  []string
+)
+
+// addEncryptFlags adds the flags of commands that write backups or bundles
+func addEncryptFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&encryptFlag, "encrypt", false, "Encrypt with a passphrase, or to the configured recipients")
+	cmd.Flags().StringSliceVar(&recipientFlag, "recipient", nil, "Encrypt to this age public key instead of the configured recipients (repeatable)")
+}
+
+// addIdentityFlag adds the flag of commands that read encrypted backups or
+// bundles
+func addIdentityFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&identityFlag, "identity", nil, "age identity file to decrypt with (repeatable)")
+}
+
+// archiveEncryption combines the encryption section of config.yaml with the
+// --encrypt, --recipient and --identity flags
+func archiveEncryption(cfg *config.Config) (*config.ArchiveEncryption, error) {
+	keys, err := cfg.Encryption.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipientFlag) > 0 {
+		keys.Recipients = nil
+		for _, s := range recipientFlag {
+			recipient, err := encryption.ParseRecipient(s)
+			if err != nil {
+				return nil, err
+			}
+			keys.Recipients = append(keys.Recipients, recipient)
+		}
+	}
+	for _, path := range identityFlag {
+		identities, err := encryption.LoadIdentities(path)
+		if err != nil {
+			return nil, err
+		}
+		keys.Identities = append(keys.Identities, identities...)
+	}
+	keys.Passphrase = readPassphrase
+
+	enc := &config.ArchiveEncryption{
+		Keys:   keys,
+		Always: encryptFlag || len(keys.Recipients) > 0,
+	}
+	if cfg.Encryption != nil {
+		enc.RequireForCredentials = cfg.Encryption.RequireForCredentials
+	}
+	return enc, nil
+}
+
+// newBackupManager returns a backup manager that encrypts and decrypts
+// backups as configured
+func newBackupManager(cfg *config.Config) (*backup.BackupManager, error) {
+	enc, err := archiveEncryption(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	bm, err := backup.NewBackupManager(cfg.GetProfilesDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backup manager: %w", err)
+	}
+	bm.SetEncryption(enc)
+	return bm, nil
+}
+
+// readPassphrase takes the passphrase from CDP_PASSPHRASE, or asks for it
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := os.Stdin.Fd()
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("a passphrase is needed; set %s or run cdp in a terminal", passphraseEnv)
+	}
+
+	passphrase, err := promptPassword(fd, "Passphrase: ")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	again, err := promptPassword(fd, "Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func promptPassword(fd uintptr, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	data, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(data), nil
+}
+
+// decryptHint explains how to decrypt when no key could
+func decryptHint(err error) error {
+	if errors.Is(err, encryption.ErrNoKey) {
+		return fmt.Errorf("%w (pass --identity, set encryption.identityFile in config.yaml, or set %s)", err, passphraseEnv)
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+var envInheritFlag bool
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment variables for a profile",
+	Long: `Manage environment variables that are set when Claude runs with a profile.
+
+Values may reference the parent environment with ${VAR}; $$ is a literal $.
+Any other $ is kept as is. Quote values so your shell does not expand them
+first.
+
+Commands:
+  cdp env set <profile> KEY=VALUE...  - Set variables
+  cdp env unset <profile> KEY...      - Remove variables from Claude's environment
+  cdp env list <profile>              - List variables
+
+Example:
+  cdp env set work HTTPS_PROXY=http://proxy.corp:8080
+  cdp env set work 'NODE_EXTRA_CA_CERTS=${HOME}/certs/corp.pem'
+  cdp env unset work ANTHROPIC_API_KEY`,
+}
+
+// envSetCmd sets profile variables
+var envSetCmd = &cobra.Command{
+	Use:   "set <profile> KEY=VALUE...",
+	Short: "Set environment variables for a profile",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars := make(map[string]string)
+		for _, arg := range args[1:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("invalid assignment '%s', expected KEY=VALUE", arg)
+			}
+			vars[key] = value
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.SetEnv(args[0], vars); err != nil {
+			return fmt.Errorf("failed to set environment: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Set %d variable(s) for '%s'", len(vars), args[0]))
+		return nil
+	},
+}
+
+// envUnsetCmd removes profile variables
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset <profile> KEY...",
+	Short: "Remove environment variables from a profile",
+	Long: `Removes variables from a profile.
+
+By default the variables are also removed from the environment Claude
+inherits from your shell. Use --inherit to only drop the profile's own
+value and let the parent environment pass through again.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.UnsetEnv(args[0], args[1:], envInheritFlag); err != nil {
+			return fmt.Errorf("failed to unset environment: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Unset %s for '%s'", strings.Join(args[1:], ", "), args[0]))
+		return nil
+	},
+}
+
+// envListCmd lists profile variables
+var envListCmd = &cobra.Command{
+	Use:   "list <profile>",
+	Short: "List environment variables of a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		profile, err := pm.GetProfile(args[0])
+		if err != nil {
+			return err
+		}
+
+		env := profile.Metadata.Env
+		unset := profile.Metadata.UnsetEnv
+		if len(env) == 0 && len(unset) == 0 {
+			ui.Info(fmt.Sprintf("Profile '%s' has no environment variables.", args[0]))
+			return nil
+		}
+
+		ui.Header(fmt.Sprintf("Environment for %s:", args[0]))
+		fmt.Println()
+
+		keys := make([]string, 0, len(env))
+		for key := range env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %s=%s\n", key, env[key])
+		}
+		for _, key := range unset {
+			fmt.Printf("  %s %s\n", key, ui.DimStyle.Render("(unset)"))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envSetCmd)
+	envCmd.AddCommand(envUnsetCmd)
+	envCmd.AddCommand(envListCmd)
+
+	envUnsetCmd.Flags().BoolVar(&envInheritFlag, "inherit", false, "Let the variable pass through from the parent environment")
+}
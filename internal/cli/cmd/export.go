@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
+)
+
+var (
+	exportOutputFlag      string
+	exportCredentialsFlag string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <profile>",
+	Short: "Export a profile as a portable bundle",
+	Long: `Writes a profile to a .cdpbundle file that can be shared and imported
+with 'cdp import <file>'.
+
+The bundle contains settings, metadata, CLAUDE.md, custom commands, agents,
+skills and hooks, plus a manifest with the cdp version, the template the
+profile was created from and a hash of every file. Conversation history and
+plugins stay behind.
+
+--credentials controls what happens to credentials:
+  strip   leave out .claude.json and .credentials.json, and remove env values
+          that look like API keys or tokens (default)
+  redact  keep .claude.json, but replace tokens and secret env values
+          with <redacted>; the importer is told what to set again
+  keep    export everything as is (only for moving your own profile)
+
+--encrypt encrypts the bundle with a passphrase, read from CDP_PASSPHRASE or
+asked for, and --recipient encrypts it to an age public key instead. 'cdp
+import' detects encrypted bundles and decrypts them. See the encryption
+section of config.yaml to encrypt every bundle, or every one with credentials.
+
+Example:
+  cdp export work -o work.cdpbundle
+  cdp export work --credentials redact
+  cdp export work --credentials keep --encrypt`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		mode, err := config.ParseCredentialMode(exportCredentialsFlag)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+		enc, err := archiveEncryption(cfg)
+		if err != nil {
+			return err
+		}
+		pm := config.NewProfileManager(cfg)
+
+		output := exportOutputFlag
+		if output == "" {
+			output = name + config.BundleExtension
+		}
+
+		var buf bytes.Buffer
+		manifest, err := pm.ExportBundle(name, &buf, config.ExportOptions{
+			Credentials: mode,
+			CdpVersion:  Version,
+			Encryption:  enc,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Bundles may contain credentials, so only the owner can read them
+		if err := atomicfile.WriteFile(output, buf.Bytes(), 0600); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+
+		label := ""
+		if manifest.Encrypted {
+			label = ", encrypted"
+		}
+		ui.Success(fmt.Sprintf("Exported profile '%s' to %s (%d file(s)%s)", name, output, len(manifest.Files), label))
+		if len(manifest.Redacted) > 0 {
+			action := "Stripped"
+			if mode == config.CredentialsRedact {
+				action = "Redacted"
+			}
+			fmt.Printf("%s:\n", action)
+			for _, value := range manifest.Redacted {
+				fmt.Printf("  - %s\n", value)
+			}
+		}
+		if mode == config.CredentialsKeep && !manifest.Encrypted {
+			ui.Warn("The bundle contains your credentials. Do not share it, or export it with --encrypt.")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportOutputFlag, "output", "o", "", "Bundle file to write (default <profile>.cdpbundle)")
+	exportCmd.Flags().StringVar(&exportCredentialsFlag, "credentials", string(config.CredentialsStrip), "How to handle credentials: strip, redact or keep")
+	addEncryptFlags(exportCmd)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+// flagsCmd represents the flags command
+var flagsCmd = &cobra.Command{
+	Use:   "flags",
+	Short: "Manage default Claude flags for a profile",
+	Long: `Manage the Claude flags that are applied automatically when switching to a profile.
+
+Flags given on the command line take precedence over stored flags with the
+same name. Use --no-profile-flags when switching to skip the stored flags.
+
+Commands:
+  cdp flags set <profile> <flags...>     - Replace the stored flags
+  cdp flags add <profile> <flags...>     - Add flags (replacing ones with the same name)
+  cdp flags remove <profile> <flags...>  - Remove flags by name
+  cdp flags clear <profile>              - Remove all stored flags
+
+Example:
+  cdp flags set work --model opus --permission-mode plan
+  cdp flags remove work --permission-mode`,
+}
+
+// flagsSetCmd replaces the stored flags
+var flagsSetCmd = &cobra.Command{
+	Use:                "set <profile> <flags...>",
+	Short:              "Replace the stored flags of a profile",
+	DisableFlagParsing: true, // Claude flags are passed through unchanged
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cdp flags set <profile> <flags...>")
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.SetCustomFlags(args[0], args[1:]); err != nil {
+			return fmt.Errorf("failed to set flags: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Flags for '%s' set to: %s", args[0], strings.Join(args[1:], " ")))
+		return nil
+	},
+}
+
+// flagsAddCmd adds flags to the stored list
+var flagsAddCmd = &cobra.Command{
+	Use:                "add <profile> <flags...>",
+	Short:              "Add flags to a profile",
+	DisableFlagParsing: true, // Claude flags are passed through unchanged
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cdp flags add <profile> <flags...>")
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.AddCustomFlags(args[0], args[1:]); err != nil {
+			return fmt.Errorf("failed to add flags: %w", err)
+		}
+
+		return printProfileFlags(pm, args[0])
+	},
+}
+
+// flagsRemoveCmd removes flags from the stored list
+var flagsRemoveCmd = &cobra.Command{
+	Use:                "remove <profile> <flags...>",
+	Short:              "Remove flags from a profile by name",
+	DisableFlagParsing: true, // Claude flags are passed through unchanged
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cdp flags remove <profile> <flags...>")
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.RemoveCustomFlags(args[0], args[1:]); err != nil {
+			return fmt.Errorf("failed to remove flags: %w", err)
+		}
+
+		return printProfileFlags(pm, args[0])
+	},
+}
+
+// flagsClearCmd removes all stored flags
+var flagsClearCmd = &cobra.Command{
+	Use:   "clear <profile>",
+	Short: "Remove all stored flags from a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		if err := pm.ClearCustomFlags(args[0]); err != nil {
+			return fmt.Errorf("failed to clear flags: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Flags for '%s' cleared.", args[0]))
+		return nil
+	},
+}
+
+func loadProfileManager() (*config.ProfileManager, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+	}
+	return config.NewProfileManager(cfg), nil
+}
+
+func printProfileFlags(pm *config.ProfileManager, name string) error {
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	if len(profile.Metadata.CustomFlags) == 0 {
+		ui.Success(fmt.Sprintf("Profile '%s' has no stored flags.", name))
+		return nil
+	}
+
+	ui.Success(fmt.Sprintf("Flags for '%s': %s", name, strings.Join(profile.Metadata.CustomFlags, " ")))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(flagsCmd)
+	flagsCmd.AddCommand(flagsSetCmd)
+	flagsCmd.AddCommand(flagsAddCmd)
+	flagsCmd.AddCommand(flagsRemoveCmd)
+	flagsCmd.AddCommand(flagsClearCmd)
+}
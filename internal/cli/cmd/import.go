@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/cli"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+var (
+	importFromDirFlag     string
+	importFromDefaultFlag bool
+	importConvertFlag     bool
+	importNameFlag        string
+
+	importOnlyFlag           []string
+	importExcludeHistoryFlag bool
+	importNoCredentialsFlag  bool
+	importYesFlag            bool
+	importOverwriteFlag      bool
+	importMoveFlag           bool
+	importDryRunFlag         bool
+	importJSONFlag           bool
+)
+
+// importFlagNames are the flags added by addImportFlags
+var importFlagNames = []string{"only", "exclude-history", "no-credentials", "yes", "overwrite", "move", "dry-run", "json"}
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <profile-name|bundle> [description]",
+	Short: "Import a Claude configuration or a profile bundle",
+	Long: `Imports an existing Claude configuration, or a bundle written by
+'cdp export', into a new profile.
+
+A bundle is imported under the profile name stored in it unless --name is
+given. Every file is checked against the bundle manifest first. Values that
+were redacted on export are left out and listed so you can set them again.
+
+--from-default imports Claude's default install: the ~/.claude directory and
+the ~/.claude.json account file next to it. Afterwards cdp offers to convert
+the default install into the profile: the originals are removed and the
+profile becomes the current one. Use --convert to do that without asking.
+
+--from imports any directory, like 'cdp create --import-from'.
+
+Example:
+  cdp import personal --from-default
+  cdp import personal --from-default --yes --convert
+  cdp import work --from ~/backups/claude-2024
+  cdp import personal --from-default --dry-run --json
+  cdp import work.cdpbundle
+  cdp import work.cdpbundle --name work-copy`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := args[0]
+		description := descriptionFlag
+		if description == "" && len(args) > 1 {
+			description = args[1]
+		}
+
+		if importFromDirFlag == "" && !importFromDefaultFlag {
+			if len(args) > 1 {
+				return fmt.Errorf("a bundle takes no description; use --from <directory> or --from-default to import a Claude configuration")
+			}
+			return runBundleImport(cmd, args[0])
+		}
+		if importFromDirFlag != "" && importFromDefaultFlag {
+			return fmt.Errorf("specify either --from <directory> or --from-default")
+		}
+		for _, name := range []string{"name", "identity"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s can only be used when importing a bundle", name)
+			}
+		}
+		if importConvertFlag && !importFromDefaultFlag {
+			return fmt.Errorf("--convert can only be used with --from-default")
+		}
+
+		opts := importOptions(description)
+		if importConvertFlag {
+			opts.Move = true
+			opts.SetCurrent = true
+		}
+
+		source := importFromDirFlag
+		if importFromDefaultFlag {
+			var err error
+			source, opts, err = config.DefaultImportOptions(opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		return runImport(source, profileName, opts)
+	},
+}
+
+// runBundleImport imports a bundle written by 'cdp export'
+func runBundleImport(cmd *cobra.Command, bundlePath string) error {
+	for _, name := range append([]string{"convert", "description"}, importFlagNames...) {
+		if name != "overwrite" && cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s cannot be used when importing a bundle", name)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+	}
+	enc, err := archiveEncryption(cfg)
+	if err != nil {
+		return err
+	}
+
+	pm := config.NewProfileManager(cfg)
+	result, err := pm.ImportBundle(bundlePath, config.BundleImportOptions{
+		Name:      importNameFlag,
+		Overwrite: importOverwriteFlag,
+		Keys:      enc.DecryptionKeys(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import bundle: %w", decryptHint(err))
+	}
+
+	ui.Success(fmt.Sprintf("Profile '%s' imported from %s", result.Profile, bundlePath))
+	if result.Manifest.Template != "" {
+		fmt.Printf("Template: %s\n", result.Manifest.Template)
+	}
+	if len(result.Missing) > 0 {
+		fmt.Println()
+		ui.Warn("These values were redacted in the bundle and need to be set again:")
+		for _, value := range result.Missing {
+			fmt.Printf("  - %s\n", value)
+		}
+	}
+	if result.Manifest.Credentials != config.CredentialsKeep {
+		fmt.Println()
+		ui.Info(fmt.Sprintf("The bundle has no login. Log in when you first run 'cdp %s'.", result.Profile))
+	}
+	fmt.Println("\nSwitch to this profile:")
+	fmt.Printf("  cdp %s\n", result.Profile)
+
+	return nil
+}
+
+// addImportFlags adds the flags shared by 'cdp import' and 'cdp create --import-from'
+func addImportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&importOnlyFlag, "only", nil, "Import only these components (comma-separated, see 'cdp clone --help')")
+	cmd.Flags().BoolVar(&importExcludeHistoryFlag, "exclude-history", false, "Do not import conversation history, todos and shell snapshots")
+	cmd.Flags().BoolVar(&importNoCredentialsFlag, "no-credentials", false, "Do not import .claude.json and .credentials.json")
+	cmd.Flags().BoolVarP(&importYesFlag, "yes", "y", false, "Import without asking for confirmation")
+	cmd.Flags().BoolVar(&importOverwriteFlag, "overwrite", false, "Replace an existing profile with the same name")
+	cmd.Flags().BoolVar(&importMoveFlag, "move", false, "Remove the source after importing")
+	cmd.Flags().BoolVar(&importDryRunFlag, "dry-run", false, "Show what would be imported without importing")
+	cmd.Flags().BoolVar(&importJSONFlag, "json", false, "With --dry-run, print the import plan as JSON")
+}
+
+// importOptions builds import options from the shared import flags
+func importOptions(description string) config.ImportOptions {
+	return config.ImportOptions{
+		CloneOptions: config.CloneOptions{
+			Only:           importOnlyFlag,
+			ExcludeHistory: importExcludeHistoryFlag,
+			NoCredentials:  importNoCredentialsFlag,
+		},
+		Description: description,
+		Yes:         importYesFlag,
+		Overwrite:   importOverwriteFlag,
+		Move:        importMoveFlag,
+	}
+}
+
+// runImport runs or previews an import
+func runImport(source, profileName string, opts config.ImportOptions) error {
+	if importJSONFlag && !importDryRunFlag {
+		return fmt.Errorf("--json can only be used with --dry-run")
+	}
+	if importDryRunFlag {
+		return cli.HandleImportDryRun(source, profileName, opts, importJSONFlag)
+	}
+	return cli.HandleImport(source, profileName, opts)
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVar(&importFromDirFlag, "from", "", "Import from a Claude config directory")
+	importCmd.Flags().BoolVar(&importFromDefaultFlag, "from-default", false, "Import the default install (~/.claude and ~/.claude.json)")
+	importCmd.Flags().BoolVar(&importConvertFlag, "convert", false, "Remove the default install and make the profile current after importing")
+	importCmd.Flags().StringVarP(&descriptionFlag, "description", "d", "", "Profile description")
+	importCmd.Flags().StringVar(&importNameFlag, "name", "", "Profile name for an imported bundle")
+	addIdentityFlag(importCmd)
+	addImportFlags(importCmd)
+}
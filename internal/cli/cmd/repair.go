@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair <profile>",
+	Short: "Rebuild a profile's missing or unreadable metadata",
+	Long: `Repairs a profile that 'cdp list' shows as broken.
+
+Unreadable metadata is moved to .metadata.json.broken and rebuilt from the
+modification times of the profile's files: the oldest is used as the
+creation time and the newest as the last use. Missing placeholder Claude
+files are recreated. Description, template and stored flags cannot be
+recovered and may need to be set again.
+
+Example:
+  cdp repair work`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		repairs, err := pm.RepairProfile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to repair profile: %w", err)
+		}
+
+		if len(repairs) == 0 {
+			ui.Info(fmt.Sprintf("Profile '%s' does not need repair.", args[0]))
+			return nil
+		}
+
+		for _, repair := range repairs {
+			ui.Success(repair)
+		}
+		ui.Success(fmt.Sprintf("Profile '%s' repaired", args[0]))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+}
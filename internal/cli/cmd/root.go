@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/backup"
 	"github.com/tiagokriok/cdp/internal/cli"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
 )
 
-var noRun bool
+var (
+	noRun          bool
+	noProfileFlags bool
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "cdp",
@@ -16,7 +24,17 @@ var rootCmd = &cobra.Command{
 enabling seamless switching between different configurations.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			// No arguments provided, so run the interactive menu.
+			// Launch the profile bound to this directory, if any.
+			if config.Exists() {
+				res, err := cli.ResolveDirectoryProfile()
+				if err != nil {
+					return err
+				}
+				if res != nil {
+					return cli.HandleRun(nil, cli.SwitchOptions{NoRun: noRun, NoProfileFlags: noProfileFlags})
+				}
+			}
+			// Otherwise run the interactive menu.
 			return cli.RunInteractiveMenu()
 		}
 		// If arguments were provided but not handled by a subcommand,
@@ -37,7 +55,22 @@ func Execute() {
 }
 
 func init() {
+	// The backup package depends on config, so config reaches it through a hook
+	config.AutoBackupFunc = func(cfg *config.Config, profile string, op config.BackupOperation, note string) error {
+		enc, err := archiveEncryption(cfg)
+		if err != nil {
+			return err
+		}
+		backupPath, err := backup.AutoBackup(cfg, profile, op, note, Version, enc)
+		if err != nil {
+			return err
+		}
+		ui.Info(fmt.Sprintf("Backed up '%s' to %s%s ('cdp undo' restores it)", profile, filepath.Base(backupPath), encryptedLabel(backupPath)))
+		return nil
+	}
+
 	rootCmd.PersistentFlags().BoolVar(&noRun, "no-run", false, "Switch profile without running Claude")
+	rootCmd.PersistentFlags().BoolVar(&noProfileFlags, "no-profile-flags", false, "Ignore the profile's stored Claude flags")
 }
 
 // GetRootCmd returns the root command for testing purposes
@@ -48,4 +81,5 @@ func GetRootCmd() *cobra.Command {
 // ResetRootCmd resets the root command state for testing
 func ResetRootCmd() {
 	noRun = false
+	noProfileFlags = false
 }
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/cli"
+)
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run [claude-flags...]",
+	Short: "Run Claude with the profile for the current directory",
+	Long: `Runs Claude with the profile resolved for the current directory.
+
+The profile is chosen from, in order:
+  1. The nearest .cdp-profile file in this directory or a parent
+  2. The first matching entry of directoryProfiles in ~/.cdp/config.yaml
+  3. The current profile
+
+Use 'cdp which' to see which profile will be used and why.
+
+Example:
+  cdp run --continue`,
+	DisableFlagParsing: true, // Pass all args through unchanged to support Claude flags
+	RunE: func(cmd *cobra.Command, args []string) error {
+		claudeFlags, opts := parseSwitchArgs(args)
+		return cli.HandleRun(claudeFlags, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
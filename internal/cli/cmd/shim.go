@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/executor"
+	"github.com/tiagokriok/cdp/internal/ui"
+	"github.com/tiagokriok/cdp/pkg/aliases"
+)
+
+var shimDirFlag string
+
+// shimCmd represents the shim command
+var shimCmd = &cobra.Command{
+	Use:   "shim",
+	Short: "Make a bare 'claude' use the current profile",
+	Long: `Manage a 'claude' wrapper script for IDE integrations and scripts that
+call claude directly. The wrapper reads the current profile from
+~/.cdp/config.yaml and runs the real claude with CLAUDE_CONFIG_DIR set to it.
+A CLAUDE_CONFIG_DIR already set, e.g. by 'cdp run' or 'cdp activate', is
+left alone. Profile environment variables and flags are not applied.
+
+Commands:
+  cdp shim install    - Write the wrapper to ~/.local/bin/claude
+  cdp shim uninstall  - Remove the wrapper
+  cdp shim status     - Show whether 'claude' runs the wrapper
+
+The wrapper must come before the real claude in PATH. If the real claude
+lives in ~/.local/bin, install the wrapper elsewhere with --dir.`,
+}
+
+// shimInstallCmd installs the shim
+var shimInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the claude wrapper",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := config.Load(); err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+		dir, err := shimDir()
+		if err != nil {
+			return err
+		}
+
+		// findClaude skips an installed shim, so this is the real claude
+		claudePath, err := executor.NewExecutor().FindClaude()
+		if err != nil {
+			return err
+		}
+		if claudePath, err = filepath.Abs(claudePath); err != nil {
+			return err
+		}
+		configPath, err := config.GetConfigPath()
+		if err != nil {
+			return err
+		}
+
+		shim, err := aliases.InstallShim(dir, claudePath, configPath)
+		if err != nil {
+			return fmt.Errorf("failed to install shim: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Installed claude shim: %s", shim.Path))
+		fmt.Printf("Runs: %s\n", shim.Claude)
+		checkShimInPath(shim.Path)
+		return nil
+	},
+}
+
+// shimUninstallCmd removes the shim
+var shimUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the claude wrapper",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := shimDir()
+		if err != nil {
+			return err
+		}
+
+		err = aliases.UninstallShim(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			ui.Info(fmt.Sprintf("No claude shim is installed in %s.", dir))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to uninstall shim: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Removed claude shim: %s", aliases.ShimPath(dir)))
+		return nil
+	},
+}
+
+// shimStatusCmd shows the shim status
+var shimStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the claude wrapper is installed and used",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := shimDir()
+		if err != nil {
+			return err
+		}
+
+		shim, err := aliases.ReadShim(aliases.ShimPath(dir))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			ui.Info(fmt.Sprintf("No claude shim is installed in %s.", dir))
+			fmt.Println("\nInstall it with:")
+			fmt.Println("  cdp shim install")
+			return nil
+		case errors.Is(err, aliases.ErrNotShim):
+			ui.Info(fmt.Sprintf("%s is not a cdp shim.", aliases.ShimPath(dir)))
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to read shim: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Claude shim installed: %s", shim.Path))
+		fmt.Printf("Runs: %s\n", shim.Claude)
+		if _, err := os.Stat(shim.Claude); err != nil {
+			ui.Warn(fmt.Sprintf("%s no longer exists; run 'cdp shim install' again", shim.Claude))
+		}
+		if cfg, err := config.Load(); err == nil {
+			if current := cfg.GetCurrentProfile(); current != "" {
+				fmt.Printf("Current profile: %s\n", current)
+			} else {
+				fmt.Printf("Current profile: %s\n", ui.DimStyle.Render("none (claude runs with its default config)"))
+			}
+		}
+		checkShimInPath(shim.Path)
+		return nil
+	},
+}
+
+// shimDir returns the directory from --dir, or ~/.local/bin
+func shimDir() (string, error) {
+	if shimDirFlag != "" {
+		return filepath.Abs(shimDirFlag)
+	}
+	return aliases.DefaultShimDir()
+}
+
+// checkShimInPath warns when a bare 'claude' does not run the shim
+func checkShimInPath(shimPath string) {
+	found, err := exec.LookPath(aliases.ShimName)
+	if err == nil && filepath.Clean(found) == shimPath {
+		ui.Info("A bare 'claude' now uses the current profile.")
+		return
+	}
+
+	dir := filepath.Dir(shimPath)
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if err == nil && filepath.Clean(entry) == dir {
+			ui.Warn(fmt.Sprintf("%s comes first in PATH; move %s before it", found, dir))
+			return
+		}
+	}
+	ui.Warn(fmt.Sprintf("%s is not in PATH; add it first:", dir))
+	fmt.Printf("  export PATH=\"%s:$PATH\"\n", dir)
+}
+
+func init() {
+	rootCmd.AddCommand(shimCmd)
+	shimCmd.AddCommand(shimInstallCmd)
+	shimCmd.AddCommand(shimUninstallCmd)
+	shimCmd.AddCommand(shimStatusCmd)
+
+	shimCmd.PersistentFlags().StringVar(&shimDirFlag, "dir", "", "Directory of the wrapper (default ~/.local/bin)")
+}
@@ -11,20 +11,15 @@ var switchCmd = &cobra.Command{
 	Use:   "switch <profile-name> [claude-flags...]",
 	Short: "Switch to a different profile (internal use)",
 	Long: `Switches the active profile and executes Claude.
-This command is intended for internal use and is hidden from the help menu.`,
+This command is intended for internal use and is hidden from the help menu.
+
+The profile's stored custom flags (see 'cdp flags') are added to the
+Claude command line. Flags given on the command line take precedence,
+and --no-profile-flags skips the stored flags entirely.`,
 	Hidden:             true,
 	DisableFlagParsing: true, // Pass all args through unchanged to support Claude flags
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Manually extract --no-run flag since DisableFlagParsing is true
-		var filteredArgs []string
-		noRunFlag := false
-		for _, arg := range args {
-			if arg == "--no-run" {
-				noRunFlag = true
-			} else {
-				filteredArgs = append(filteredArgs, arg)
-			}
-		}
+		filteredArgs, opts := parseSwitchArgs(args)
 
 		if len(filteredArgs) == 0 {
 			return fmt.Errorf("profile name is required")
@@ -32,10 +27,27 @@ This command is intended for internal use and is hidden from the help menu.`,
 
 		profileName := filteredArgs[0]
 		claudeFlags := filteredArgs[1:]
-		return cli.HandleSwitch(profileName, claudeFlags, noRunFlag)
+		return cli.HandleSwitchWithOptions(profileName, claudeFlags, opts)
 	},
 }
 
+// parseSwitchArgs manually extracts cdp flags since DisableFlagParsing is true
+func parseSwitchArgs(args []string) ([]string, cli.SwitchOptions) {
+	var filteredArgs []string
+	var opts cli.SwitchOptions
+	for _, arg := range args {
+		switch arg {
+		case "--no-run":
+			opts.NoRun = true
+		case "--no-profile-flags":
+			opts.NoProfileFlags = true
+		default:
+			filteredArgs = append(filteredArgs, arg)
+		}
+	}
+	return filteredArgs, opts
+}
+
 func init() {
 	rootCmd.AddCommand(switchCmd)
 }
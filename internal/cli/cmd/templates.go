@@ -1,41 +1,563 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tiagokriok/cdp/internal/config"
 	"github.com/tiagokriok/cdp/internal/ui"
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
 )
 
 // templatesCmd represents the templates command
 var templatesCmd = &cobra.Command{
-	Use:   "templates",
-	Short: "List available profile templates",
-	Long:  `Lists all built-in and custom profile templates that can be used with 'cdp create --template'.`,
+	Use:     "templates",
+	Aliases: []string{"template"},
+	Short:   "Manage profile templates",
+	Long: `Lists all built-in and custom profile templates that can be used with 'cdp create --template'.
+
+Custom templates live in ~/.cdp/templates and take precedence over
+built-in templates with the same name.
+
+Commands:
+  cdp templates list                                 - List available templates
+  cdp templates show <name>                          - Show a template and its origin
+  cdp templates create <name> --from-profile <p>     - Snapshot a profile's settings as a template
+  cdp templates edit <name>                          - Edit a template in $EDITOR
+  cdp templates delete <name>                        - Delete a custom template
+  cdp templates export <name> [-o file]              - Export a template as JSON
+  cdp template apply <profile> <template>            - Merge a template into a profile's settings
+  cdp template status [profile]                      - Show profiles that drifted from their template
+  cdp template sync [profile|--all]                  - Re-apply changed templates, keeping local edits`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listTemplates()
+	},
+}
+
+var (
+	templateFromProfileFlag string
+	templateOutputFlag      string
+	templateResolvedFlag    bool
+)
+
+// templatesListCmd lists templates
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available templates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listTemplates()
+	},
+}
+
+// templatesShowCmd shows a template
+var templatesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a template's content and origin",
+	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		tm := config.NewTemplateManager()
-		templates, err := tm.ListTemplates()
+		data, info, err := tm.ReadTemplateFile(args[0])
 		if err != nil {
-			return fmt.Errorf("failed to list templates: %w", err)
+			return err
+		}
+
+		ui.Header(fmt.Sprintf("Template: %s", info.Name))
+		fmt.Println()
+		fmt.Printf("Origin:       %s\n", describeOrigin(info))
+		if info.Path != "" {
+			fmt.Printf("Location:     %s\n", ui.DimStyle.Render(info.Path))
+		}
+		if template, err := tm.LoadTemplate(info.Name); err == nil {
+			if template.Description != "" {
+				fmt.Printf("Description:  %s\n", ui.DescriptionStyle.Render(template.Description))
+			}
+			if len(template.Extends) > 0 {
+				fmt.Printf("Extends:      %s\n", strings.Join(template.Extends, ", "))
+			}
+		} else {
+			ui.Warn(fmt.Sprintf("Template is invalid: %v", err))
 		}
+		fmt.Println()
+		fmt.Println(strings.TrimRight(string(data), "\n"))
+
+		return nil
+	},
+}
+
+// templatesCreateCmd creates a template from a profile
+var templatesCreateCmd = &cobra.Command{
+	Use:   "create <name> --from-profile <profile> [description]",
+	Short: "Create a template from a profile's settings",
+	Long: `Snapshots a profile's settings.json as a custom template.
+
+Example:
+  cdp templates create team-policy --from-profile work "Team policy"`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if templateFromProfileFlag == "" {
+			return fmt.Errorf("--from-profile is required")
+		}
+
+		description := ""
+		if len(args) > 1 {
+			description = args[1]
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		profile, err := pm.GetProfile(templateFromProfileFlag)
+		if err != nil {
+			return fmt.Errorf("profile '%s' does not exist", templateFromProfileFlag)
+		}
+
+		tm := config.NewTemplateManager()
+		if err := tm.CreateTemplateFromProfile(name, profile.Path, description); err != nil {
+			return fmt.Errorf("failed to create template: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Template '%s' created from profile '%s'", name, profile.Name))
+		if tm.IsBuiltIn(name) {
+			ui.Warn(fmt.Sprintf("This template shadows the built-in template '%s'", name))
+		}
+		return nil
+	},
+}
 
-		if len(templates) == 0 {
-			ui.Info("No templates available.")
+// templatesEditCmd edits a template in $EDITOR
+var templatesEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit a template in $EDITOR",
+	Long: `Opens a template in $VISUAL or $EDITOR and validates it on save.
+
+Editing a built-in template saves a custom copy that shadows it.
+Editing a name that does not exist creates a new custom template.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateName(name); err != nil {
+			return fmt.Errorf("invalid template name: %w", err)
+		}
+
+		tm := config.NewTemplateManager()
+		data, _, err := tm.ReadTemplateFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			data = []byte("{\n  \"description\": \"\"\n}\n")
+		} else if err != nil {
+			return err
+		}
+
+		for {
+			data, err = editInEditor(name+".json", data)
+			if err != nil {
+				return err
+			}
+
+			err = tm.SaveTemplate(name, data)
+			if err == nil {
+				break
+			}
+
+			ui.Error(err.Error())
+			if !confirm("Re-open the editor?", true) {
+				return fmt.Errorf("template '%s' not saved", name)
+			}
+		}
+
+		ui.Success(fmt.Sprintf("Template '%s' saved", name))
+		if tm.IsBuiltIn(name) {
+			ui.Info(fmt.Sprintf("The custom template shadows the built-in '%s'", name))
+		}
+		return nil
+	},
+}
+
+// templatesDeleteCmd deletes a custom template
+var templatesDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a custom template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tm := config.NewTemplateManager()
+		if err := tm.DeleteTemplate(args[0]); err != nil {
+			return fmt.Errorf("failed to delete template: %w", err)
+		}
+
+		ui.Success(fmt.Sprintf("Template '%s' deleted.", args[0]))
+		if tm.IsBuiltIn(args[0]) {
+			ui.Info(fmt.Sprintf("The built-in template '%s' is active again", args[0]))
+		}
+		return nil
+	},
+}
+
+// templatesExportCmd exports a template as JSON
+var templatesExportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Export a template as JSON",
+	Long: `Writes a template's JSON to stdout or to a file.
+
+Use --resolved to merge in the templates it extends so the result does
+not depend on other templates.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tm := config.NewTemplateManager()
+		data, err := tm.ExportTemplate(args[0], templateResolvedFlag)
+		if err != nil {
+			return fmt.Errorf("failed to export template: %w", err)
+		}
+
+		if templateOutputFlag == "" {
+			fmt.Println(strings.TrimRight(string(data), "\n"))
 			return nil
 		}
 
-		ui.Header("Available templates:")
+		if err := atomicfile.WriteFile(templateOutputFlag, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", templateOutputFlag, err)
+		}
+
+		ui.Success(fmt.Sprintf("Template '%s' exported to %s", args[0], templateOutputFlag))
+		return nil
+	},
+}
+
+var (
+	templateSyncAllFlag    bool
+	templateSyncDryRunFlag bool
+)
+
+// templateStatusCmd reports template drift
+var templateStatusCmd = &cobra.Command{
+	Use:   "status [profile]",
+	Short: "Show which profiles have drifted from their template",
+	Long: `Reports, for every profile created from a template, whether the template
+changed since it was applied and whether the profile's settings were
+edited locally. Use 'cdp template sync' to bring profiles up to date.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		var statuses []config.TemplateStatus
+		if len(args) == 1 {
+			status, err := pm.GetTemplateStatus(args[0])
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, *status)
+		} else {
+			statuses, err = pm.ListTemplateStatus()
+			if err != nil {
+				return fmt.Errorf("failed to get template status: %w", err)
+			}
+		}
+
+		if len(statuses) == 0 {
+			ui.Info("No profiles use a template.")
+			return nil
+		}
+
+		ui.Header("Template status:")
 		fmt.Println()
-		for _, name := range templates {
-			fmt.Printf("  - %s\n", name)
+		for _, status := range statuses {
+			fmt.Printf("  %s %s %s\n", ui.ProfileStyle.Render(status.Profile),
+				ui.DimStyle.Render("("+status.Template+")"), describeTemplateStatus(&status))
 		}
 		fmt.Println()
-		fmt.Println("Use with: cdp create <name> --template <template-name>")
 		return nil
 	},
 }
 
+// templateSyncCmd re-applies templates
+var templateSyncCmd = &cobra.Command{
+	Use:   "sync [profile|--all]",
+	Short: "Re-apply a changed template while keeping local edits",
+	Long: `Re-applies a profile's template using a three-way merge between the template
+as it was applied, the profile's current settings and the current template.
+
+Template changes are applied, local edits are kept, and where both changed
+the same setting differently the local value wins and is reported.
+
+Example:
+  cdp template sync work --dry-run
+  cdp template sync --all`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if templateSyncAllFlag == (len(args) == 1) {
+			return fmt.Errorf("specify a profile or --all")
+		}
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		if templateSyncAllFlag {
+			statuses, err := pm.ListTemplateStatus()
+			if err != nil {
+				return fmt.Errorf("failed to get template status: %w", err)
+			}
+			for _, status := range statuses {
+				// Local edits alone leave nothing to pull from the template
+				if (status.TemplateChanged || status.Untracked) && !status.Missing {
+					names = append(names, status.Profile)
+				}
+			}
+			if len(names) == 0 {
+				ui.Success("All profiles are up to date with their templates.")
+				return nil
+			}
+		} else {
+			names = args
+		}
+
+		failed := 0
+		for _, name := range names {
+			result, err := pm.SyncTemplate(name, templateSyncDryRunFlag)
+			if err != nil {
+				ui.Error(fmt.Sprintf("%s: %v", name, err))
+				failed++
+				continue
+			}
+
+			ui.Header(fmt.Sprintf("%s (%s):", result.Profile, result.Template))
+			printSettingsChanges(result.Changes)
+			for _, path := range result.Conflicts {
+				ui.Warn(fmt.Sprintf("Kept local value for %s (also changed in template)", path))
+			}
+			if !templateSyncDryRunFlag {
+				ui.Success(fmt.Sprintf("Profile '%s' synced", name))
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d profile(s) failed to sync", failed)
+		}
+		return nil
+	},
+}
+
+func describeTemplateStatus(status *config.TemplateStatus) string {
+	switch {
+	case status.Missing:
+		return ui.ErrorStyle.Render("template not found")
+	case status.Untracked:
+		return ui.WarnStyle.Render("unknown (applied before tracking, sync to start tracking)")
+	case status.TemplateChanged && status.LocallyModified:
+		return ui.WarnStyle.Render("template changed, edited locally")
+	case status.TemplateChanged:
+		return ui.WarnStyle.Render("template changed")
+	case status.LocallyModified:
+		return ui.WarnStyle.Render("edited locally")
+	default:
+		return ui.SuccessStyle.Render("in sync")
+	}
+}
+
+func listTemplates() error {
+	tm := config.NewTemplateManager()
+	templates, err := tm.ListTemplates()
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	if len(templates) == 0 {
+		ui.Info("No templates available.")
+		return nil
+	}
+
+	ui.Header("Available templates:")
+	fmt.Println()
+	for _, info := range templates {
+		fmt.Printf("  - %s %s\n", info.Name, ui.DimStyle.Render("("+describeOrigin(&info)+")"))
+		if info.Description != "" {
+			fmt.Printf("    %s\n", ui.DescriptionStyle.Render(info.Description))
+		}
+	}
+	fmt.Println()
+	fmt.Println("Use with: cdp create <name> --template <template-name>")
+	return nil
+}
+
+func describeOrigin(info *config.TemplateInfo) string {
+	if info.ShadowsBuiltIn {
+		return "custom, shadows built-in"
+	}
+	return string(info.Origin)
+}
+
+// editInEditor writes data to a temp file, opens it in the user's editor and
+// returns the saved content
+func editInEditor(fileName string, data []byte) ([]byte, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	tmpDir, err := os.MkdirTemp("", "cdp-edit-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, fileName)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	// $EDITOR may include arguments, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	editorCmd := exec.Command(parts[0], append(parts[1:], path)...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	if err := editorCmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+
+	return os.ReadFile(path)
+}
+
+// confirm prompts the user for a yes/no answer
+func confirm(question string, defaultYes bool) bool {
+	choice := "y/N"
+	if defaultYes {
+		choice = "Y/n"
+	}
+	fmt.Printf("%s [%s]: ", question, choice)
+
+	response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response == "" {
+		return defaultYes
+	}
+	return response == "y" || response == "yes"
+}
+
+var templateDryRunFlag bool
+
+// templateApplyCmd applies a template to an existing profile
+var templateApplyCmd = &cobra.Command{
+	Use:   "apply <profile> <template>",
+	Short: "Merge a template into a profile's settings",
+	Long: `Deep-merges a template into a profile's settings.json.
+
+Objects are merged recursively. Arrays are merged as a union by default;
+templates can choose "replace" or "prepend" per settings path with an
+"arrayMerge" key, and compose other templates with "extends".
+
+Use --dry-run to show the resulting changes without writing them.
+
+Example:
+  cdp template apply work restrictive --dry-run
+  cdp template apply work restrictive`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := args[0]
+		templateName := args[1]
+
+		pm, err := loadProfileManager()
+		if err != nil {
+			return err
+		}
+
+		profile, err := pm.GetProfile(profileName)
+		if err != nil {
+			return fmt.Errorf("profile '%s' does not exist", profileName)
+		}
+
+		tm := config.NewTemplateManager()
+		before, after, err := tm.PreviewTemplate(profile.Path, templateName)
+		if err != nil {
+			return fmt.Errorf("failed to apply template: %w", err)
+		}
+
+		changes := config.DiffSettings(before, after)
+		if templateDryRunFlag {
+			ui.Header(fmt.Sprintf("Applying '%s' to '%s' would change:", templateName, profileName))
+			fmt.Println()
+			printSettingsChanges(changes)
+			return nil
+		}
+
+		if err := pm.ApplyTemplate(profileName, templateName); err != nil {
+			return fmt.Errorf("failed to apply template: %w", err)
+		}
+
+		printSettingsChanges(changes)
+		ui.Success(fmt.Sprintf("Template '%s' applied to '%s'", templateName, profileName))
+		return nil
+	},
+}
+
+func printSettingsChanges(changes []config.SettingsChange) {
+	if len(changes) == 0 {
+		fmt.Println("  " + ui.DimStyle.Render("No changes"))
+		fmt.Println()
+		return
+	}
+
+	for _, change := range changes {
+		switch change.Kind {
+		case "added":
+			fmt.Printf("  %s %s: %s\n", ui.SuccessStyle.Render("+"), change.Path, formatJSONValue(change.New))
+		case "removed":
+			fmt.Printf("  %s %s: %s\n", ui.ErrorStyle.Render("-"), change.Path, formatJSONValue(change.Old))
+		default:
+			fmt.Printf("  %s %s: %s -> %s\n", ui.WarnStyle.Render("~"), change.Path,
+				formatJSONValue(change.Old), formatJSONValue(change.New))
+		}
+	}
+	fmt.Println()
+}
+
+func formatJSONValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
 func init() {
 	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+	templatesCmd.AddCommand(templatesCreateCmd)
+	templatesCmd.AddCommand(templatesEditCmd)
+	templatesCmd.AddCommand(templatesDeleteCmd)
+	templatesCmd.AddCommand(templatesExportCmd)
+	templatesCmd.AddCommand(templateApplyCmd)
+	templatesCmd.AddCommand(templateStatusCmd)
+	templatesCmd.AddCommand(templateSyncCmd)
+
+	templatesCreateCmd.Flags().StringVar(&templateFromProfileFlag, "from-profile", "", "Profile whose settings.json becomes the template")
+	templatesExportCmd.Flags().StringVarP(&templateOutputFlag, "output", "o", "", "Write to a file instead of stdout")
+	templatesExportCmd.Flags().BoolVar(&templateResolvedFlag, "resolved", false, "Merge in extended templates")
+
+	templateSyncCmd.Flags().BoolVar(&templateSyncAllFlag, "all", false, "Sync every profile whose template changed")
+	templateSyncCmd.Flags().BoolVar(&templateSyncDryRunFlag, "dry-run", false, "Show the resulting changes without writing them")
+	templateApplyCmd.Flags().BoolVar(&templateDryRunFlag, "dry-run", false, "Show the resulting changes without writing them")
 }
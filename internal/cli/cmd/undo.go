@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/backup"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+var undoYesFlag bool
+
+// undoCmd restores the most recent automatic backup
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Restore the most recent automatic backup",
+	Long: `Restores the profile saved by the most recent automatic backup, undoing the
+delete, rename, import, restore or template change that triggered it.
+
+Automatic backups are taken when the autoBackup policy is enabled in
+~/.cdp/config.yaml:
+
+  autoBackup:
+    enabled: true
+    operations: [delete, rename, import, restore, template]  # optional, default all
+
+If the profile still exists it is replaced, and backed up first when the policy
+covers restore, so running 'cdp undo' again redoes the change.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+
+		bm, err := newBackupManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		last, err := bm.LastAutomatic()
+		if err != nil {
+			return fmt.Errorf("failed to list backups: %w", decryptHint(err))
+		}
+		if last == nil {
+			ui.Info("No automatic backups found.")
+			if cfg.AutoBackup == nil || !cfg.AutoBackup.Enabled {
+				fmt.Println("\nEnable them in ~/.cdp/config.yaml:")
+				fmt.Println("  autoBackup:")
+				fmt.Println("    enabled: true")
+			}
+			return nil
+		}
+
+		fmt.Printf("Last automatic backup: %s\n", ui.ProfileStyle.Render(last.Name))
+		fmt.Printf("  Profile: %s\n", last.ProfileName)
+		fmt.Printf("  Taken before: %s\n", last.Operation)
+		if last.Note != "" {
+			fmt.Printf("  Note: %s\n", last.Note)
+		}
+		fmt.Printf("  Created: %s\n", last.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Println()
+
+		if !undoYesFlag && !confirm(fmt.Sprintf("Restore profile '%s' from this backup?", last.ProfileName), false) {
+			ui.Info("Undo cancelled.")
+			return nil
+		}
+
+		result, err := bm.RestoreWithOptions(last.Path, backup.RestoreOptions{
+			Overwrite:       true,
+			BeforeOverwrite: backupBeforeRestore(cfg, last.Path),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restore backup: %w", decryptHint(err))
+		}
+
+		ui.Success(fmt.Sprintf("Profile '%s' restored as it was before %s.", result.Profile, last.Operation))
+		if last.Operation == string(config.BackupBeforeRename) {
+			ui.Info("The renamed profile was kept; delete it if you no longer need it.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolVarP(&undoYesFlag, "yes", "y", false, "Restore without asking for confirmation")
+	addIdentityFlag(undoCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/ui"
+)
+
+var validateAllFlag bool
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate [profile|--all]",
+	Short: "Check profile files and settings for errors",
+	Long: `Checks that a profile's files exist and are valid JSON, and that
+settings.json matches the known Claude settings: value types, permission
+rule syntax such as Bash(git push:*) and Read(**/secrets/**), and hooks.
+
+Unknown settings are reported as warnings. Without arguments the current
+profile is checked.
+
+Example:
+  cdp validate work
+  cdp validate --all`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if validateAllFlag && len(args) == 1 {
+			return fmt.Errorf("specify a profile or --all, not both")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("CDP not initialized. Run 'cdp init' first")
+		}
+		pm := config.NewProfileManager(cfg)
+
+		var profiles []config.Profile
+		switch {
+		case validateAllFlag:
+			profiles, err = pm.ListProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to list profiles: %w", err)
+			}
+		default:
+			name := cfg.GetCurrentProfile()
+			if len(args) == 1 {
+				name = args[0]
+			}
+			if name == "" {
+				return fmt.Errorf("no profile is currently active; specify a profile or --all")
+			}
+			profile, err := pm.GetProfile(name)
+			if err != nil {
+				return err
+			}
+			profiles = append(profiles, *profile)
+		}
+
+		if len(profiles) == 0 {
+			ui.Info("No profiles found.")
+			return nil
+		}
+
+		invalid := 0
+		for _, profile := range profiles {
+			issues := pm.CheckProfile(&profile)
+			if issues.HasErrors() {
+				invalid++
+			}
+			printValidationIssues(profile.Name, issues)
+		}
+
+		if invalid > 0 {
+			return fmt.Errorf("%d of %d profile(s) have errors", invalid, len(profiles))
+		}
+		return nil
+	},
+}
+
+// printValidationIssues prints a profile's validation result
+func printValidationIssues(name string, issues config.ValidationIssues) {
+	if len(issues) == 0 {
+		ui.Success(fmt.Sprintf("%s: valid", name))
+		return
+	}
+
+	if issues.HasErrors() {
+		ui.Error(fmt.Sprintf("%s: %d problem(s)", name, len(issues)))
+	} else {
+		ui.Warn(fmt.Sprintf("%s: %d warning(s)", name, len(issues)))
+	}
+
+	for _, issue := range issues {
+		label := ui.ErrorStyle.Render(string(issue.Severity))
+		if issue.Severity == config.SeverityWarning {
+			label = ui.WarnStyle.Render(string(issue.Severity))
+		}
+		fmt.Printf("  %s %s\n", label, issue)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().BoolVar(&validateAllFlag, "all", false, "Validate every profile")
+}
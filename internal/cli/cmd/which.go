@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/tiagokriok/cdp/internal/cli"
+)
+
+// whichCmd represents the which command
+var whichCmd = &cobra.Command{
+	Use:   "which",
+	Short: "Show the profile resolved for the current directory",
+	Long: `Prints the profile that 'cdp run' would use in the current directory
+and why it was chosen.
+
+Bind a directory tree to a profile with a .cdp-profile file:
+  echo work > ~/code/acme/.cdp-profile
+
+or with a directoryProfiles entry in ~/.cdp/config.yaml:
+  directoryProfiles:
+    - path: ~/code/acme
+      profile: work
+    - path: ~/code/clients/*
+      profile: clients`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cli.HandleWhich()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whichCmd)
+}
@@ -2,12 +2,14 @@ package cli
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/tiagokriok/cdp/internal/config"
 	"github.com/tiagokriok/cdp/internal/executor"
+	"github.com/tiagokriok/cdp/internal/shellenv"
 	"github.com/tiagokriok/cdp/internal/ui"
 )
 
@@ -66,7 +68,7 @@ func HandleCreateWithTemplate(name, description, template string) error {
 }
 
 // HandleImport imports an existing Claude configuration into a new profile
-func HandleImport(sourcePath, name, description string) error {
+func HandleImport(sourcePath, name string, opts config.ImportOptions) error {
 	cfg, err := loadConfig()
 	if err != nil {
 		return err
@@ -74,13 +76,13 @@ func HandleImport(sourcePath, name, description string) error {
 
 	pm := config.NewProfileManager(cfg)
 
-	if err := pm.ImportProfile(sourcePath, name, description); err != nil {
+	if err := pm.ImportProfileWithOptions(sourcePath, name, opts); err != nil {
 		return fmt.Errorf("failed to import profile: %w", err)
 	}
 
 	ui.Success(fmt.Sprintf("Profile '%s' imported successfully!", name))
-	if description != "" {
-		fmt.Printf("Description: %s\n", description)
+	if opts.Description != "" {
+		fmt.Printf("Description: %s\n", opts.Description)
 	}
 	fmt.Printf("Location: %s\n", cfg.GetProfilesDir()+"/"+name)
 	fmt.Println("\nSwitch to this profile:")
@@ -89,6 +91,36 @@ func HandleImport(sourcePath, name, description string) error {
 	return nil
 }
 
+// HandleImportDryRun shows what importing a Claude configuration would do,
+// as a preview or as JSON
+func HandleImportDryRun(sourcePath, name string, opts config.ImportOptions, jsonOutput bool) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	pm := config.NewProfileManager(cfg)
+
+	plan, err := pm.PlanImport(sourcePath, name, opts)
+	if err != nil {
+		return fmt.Errorf("failed to plan import: %w", err)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal import plan: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	config.PrintImportPlan(plan)
+	fmt.Println()
+	ui.Info("Dry run: nothing was imported.")
+	return nil
+}
+
 // HandleList lists all profiles
 func HandleList() error {
 	cfg, err := loadConfig()
@@ -164,6 +196,10 @@ func HandleCurrent() error {
 	pm := config.NewProfileManager(cfg)
 	profile, err := pm.GetProfile(currentProfile)
 	if err != nil {
+		if pm.ProfileExists(currentProfile) {
+			ui.Warn(fmt.Sprintf("Profile '%s' is broken: %v", currentProfile, err))
+			return nil
+		}
 		// Profile might have been deleted
 		ui.Warn("Profile directory not found")
 		return nil
@@ -184,7 +220,10 @@ func HandleInfo(name string) error {
 	pm := config.NewProfileManager(cfg)
 	profile, err := pm.GetProfile(name)
 	if err != nil {
-		return fmt.Errorf("profile '%s' does not exist", name)
+		if !pm.ProfileExists(name) {
+			return fmt.Errorf("profile '%s' does not exist", name)
+		}
+		return err
 	}
 
 	currentProfile := cfg.GetCurrentProfile()
@@ -195,53 +234,191 @@ func HandleInfo(name string) error {
 	return nil
 }
 
+// SwitchOptions controls how HandleSwitchWithOptions behaves
+type SwitchOptions struct {
+	// NoRun switches the profile without running Claude
+	NoRun bool
+	// NoProfileFlags skips the profile's stored custom flags
+	NoProfileFlags bool
+}
+
 // HandleSwitch switches to a profile and optionally runs Claude
 func HandleSwitch(name string, claudeFlags []string, noRun bool) error {
-	cfg, err := loadConfig()
+	return HandleSwitchWithOptions(name, claudeFlags, SwitchOptions{NoRun: noRun})
+}
+
+// HandleSwitchWithOptions switches to a profile and optionally runs Claude.
+// The profile's stored custom flags are merged with claudeFlags, with
+// command-line flags taking precedence.
+func HandleSwitchWithOptions(name string, claudeFlags []string, opts SwitchOptions) error {
+	profile, err := switchProfile(name, ui.Warn)
 	if err != nil {
 		return err
 	}
 
+	ui.Success(fmt.Sprintf("Switched to profile: %s", name))
+
+	if opts.NoRun {
+		// With the shell hook, the shell itself switches too
+		if hookActive() {
+			if err := writeActivation(profile, shellenv.Detect()); err != nil {
+				return err
+			}
+			ui.Info("Activated in this shell; 'claude' now uses this profile.")
+			return nil
+		}
+		ui.Info(fmt.Sprintf("Use 'cdp %s' to start Claude Code with this profile, or 'eval \"$(cdp activate %s)\"' so plain 'claude' in this shell uses it.", name, name))
+		return nil
+	}
+
+	return launchProfile(profile, claudeFlags, opts)
+}
+
+// launchProfile runs Claude with profile. The profile's stored custom flags
+// are merged with claudeFlags, with command-line flags taking precedence.
+func launchProfile(profile *config.Profile, claudeFlags []string, opts SwitchOptions) error {
+	// Merge stored profile flags (command-line flags win)
+	flags := claudeFlags
+	if !opts.NoProfileFlags {
+		flags = config.MergeFlags(profile.Metadata.CustomFlags, claudeFlags)
+	}
+
+	// Run Claude Code
+	ui.Info("Starting Claude Code...")
+	exec := executor.NewExecutor()
+	exec.SetProfileEnv(profile.Metadata.Env, profile.Metadata.UnsetEnv)
+	return exec.Run(profile.Path, flags)
+}
+
+// switchProfile makes a profile the current one, after checking it is
+// intact, and returns it. warn reports non-fatal problems.
+func switchProfile(name string, warn func(string)) (*config.Profile, error) {
+	return useProfile(name, true, warn)
+}
+
+// useProfile checks that a profile is intact, records that it was used and
+// returns it. Only with makeCurrent does it become the current profile.
+func useProfile(name string, makeCurrent bool, warn func(string)) (*config.Profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	pm := config.NewProfileManager(cfg)
 
 	// Check if profile exists
 	profile, err := pm.GetProfile(name)
 	if err != nil {
-		return fmt.Errorf("profile '%s' does not exist", name)
+		if !pm.ProfileExists(name) {
+			return nil, fmt.Errorf("profile '%s' does not exist", name)
+		}
+		return nil, err
 	}
 
-	// Validate profile structure
-	if err := pm.ValidateProfile(profile); err != nil {
-		return fmt.Errorf("profile '%s' is corrupted: %w", name, err)
+	// Validate profile files and settings before Claude sees them
+	if issues := pm.CheckProfile(profile); issues.HasErrors() {
+		return nil, fmt.Errorf("profile '%s' is corrupted: %w\nRun 'cdp validate %s' for details", name, issues.Err(), name)
 	}
 
-	// Update current profile by setting field and saving explicitly
-	cfg.CurrentProfile = name
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config with new profile: %w", err)
+	// Update current profile, keeping changes made by concurrent cdp runs
+	if makeCurrent {
+		if err := cfg.SetCurrentProfile(name); err != nil {
+			return nil, fmt.Errorf("failed to save config with new profile: %w", err)
+		}
 	}
 
 	// Update last used timestamp
 	if err := pm.UpdateLastUsed(name); err != nil {
 		// Non-fatal error, just log it
-		ui.Warn(fmt.Sprintf("Failed to update last used timestamp: %v", err))
+		warn(fmt.Sprintf("Failed to update last used timestamp: %v", err))
 	}
 
-	ui.Success(fmt.Sprintf("Switched to profile: %s", name))
+	return profile, nil
+}
+
+// HandleRun runs Claude with the profile resolved for the working directory.
+// A profile bound to the directory is used for this run only and does not
+// become the current profile.
+func HandleRun(claudeFlags []string, opts SwitchOptions) error {
+	res, err := resolveProfile()
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return fmt.Errorf("no profile found for this directory and no profile is currently active")
+	}
+
+	if !res.IsDirectoryBound() {
+		return HandleSwitchWithOptions(res.Profile, claudeFlags, opts)
+	}
+
+	ui.Info(fmt.Sprintf("Using profile '%s' (%s)", res.Profile, res.Reason()))
+	if opts.NoRun {
+		return HandleSwitchWithOptions(res.Profile, claudeFlags, opts)
+	}
+
+	// Other terminals, a bare 'cdp' and the claude shim keep the current profile
+	profile, err := useProfile(res.Profile, false, ui.Warn)
+	if err != nil {
+		return err
+	}
+	return launchProfile(profile, claudeFlags, opts)
+}
 
-	if noRun {
-		ui.Info("Use 'claude' to start Claude Code with this profile.")
+// HandleWhich prints the profile resolved for the working directory and why
+func HandleWhich() error {
+	res, err := resolveProfile()
+	if err != nil {
+		return err
+	}
+
+	if res == nil {
+		ui.Info("No profile found for this directory and no profile is currently active.")
+		fmt.Println("\nPin a profile to this directory:")
+		fmt.Printf("  echo <profile-name> > %s\n", config.ProfileFileName)
 		return nil
 	}
 
-	// Run Claude Code
-	ui.Info("Starting Claude Code...")
-	exec := executor.NewExecutor()
-	return exec.Run(profile.Path, claudeFlags)
+	fmt.Println(res.Profile)
+	ui.Info(fmt.Sprintf("Reason: %s", res.Reason()))
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if !config.NewProfileManager(cfg).ProfileExists(res.Profile) {
+		ui.Warn(fmt.Sprintf("Profile '%s' does not exist", res.Profile))
+	}
+
+	return nil
+}
+
+// ResolveDirectoryProfile returns the profile bound to the working directory,
+// or nil if the directory has no binding. The current profile is not considered.
+func ResolveDirectoryProfile() (*config.Resolution, error) {
+	res, err := resolveProfile()
+	if err != nil || res == nil || !res.IsDirectoryBound() {
+		return nil, err
+	}
+	return res, nil
 }
 
 // Helper functions
 
+func resolveProfile() (*config.Resolution, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	return cfg.ResolveProfile(wd)
+}
+
 func loadConfig() (*config.Config, error) {
 	if !config.Exists() {
 		return nil, fmt.Errorf("CDP is not initialized. Run 'cdp init' first")
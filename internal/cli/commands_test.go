@@ -349,6 +349,46 @@ func TestHandleSwitch_ClaudeFlags(t *testing.T) {
 	}
 }
 
+func TestHandleRun_DirectoryBoundKeepsCurrent(t *testing.T) {
+	_, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := config.Init(); err != nil {
+		t.Fatalf("config.Init() failed: %v", err)
+	}
+	cfg, _ := config.Load()
+	pm := config.NewProfileManager(cfg)
+	pm.CreateProfile("personal", "Current profile")
+	pm.CreateProfile("work", "Bound profile")
+	cfg.SetCurrentProfile("personal")
+
+	// A claude that succeeds without doing anything
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, config.ProfileFileName), []byte("work\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(repo)
+
+	if err := HandleRun(nil, SwitchOptions{}); err != nil {
+		t.Fatalf("HandleRun() failed: %v", err)
+	}
+
+	cfg, _ = config.Load()
+	if cfg.GetCurrentProfile() != "personal" {
+		t.Errorf("Current profile = %q, want personal", cfg.GetCurrentProfile())
+	}
+	profile, _ := config.NewProfileManager(cfg).GetProfile("work")
+	if profile.Metadata.LastUsed.IsZero() {
+		t.Error("LastUsed of the bound profile was not updated")
+	}
+}
+
 func TestHandleCurrent_WithProfile(t *testing.T) {
 	_, cleanup := setupTestEnv(t)
 	defer cleanup()
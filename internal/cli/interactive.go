@@ -66,6 +66,9 @@ func (m model) View() string {
 		if profile.Name == m.currentProfile {
 			name = ui.CurrentProfileStyle.Render(name + " (current)")
 		}
+		if profile.IsBroken() {
+			name += " " + ui.ErrorStyle.Render("(broken, run 'cdp repair "+profile.Name+"')")
+		}
 
 		row := fmt.Sprintf("%s%s", cursor, name)
 		s += row + "\n"
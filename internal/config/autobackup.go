@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BackupOperation names an operation that changes or removes profile data
+type BackupOperation string
+
+const (
+	BackupBeforeDelete   BackupOperation = "delete"
+	BackupBeforeRename   BackupOperation = "rename"
+	BackupBeforeImport   BackupOperation = "import"
+	BackupBeforeRestore  BackupOperation = "restore"
+	BackupBeforeTemplate BackupOperation = "template"
+)
+
+// BackupOperations lists the operations the autoBackup policy can cover
+var BackupOperations = []BackupOperation{
+	BackupBeforeDelete,
+	BackupBeforeRename,
+	BackupBeforeImport,
+	BackupBeforeRestore,
+	BackupBeforeTemplate,
+}
+
+// AutoBackupPolicy is the autoBackup section of config.yaml
+type AutoBackupPolicy struct {
+	Enabled bool `yaml:"enabled"`
+	// Operations limits automatic backups to these operations; empty covers all
+	Operations []BackupOperation `yaml:"operations,omitempty"`
+}
+
+// AutoBackupFunc backs up a profile before op changes it. It is set by the
+// CLI, since the backup package depends on config.
+var AutoBackupFunc func(cfg *Config, profile string, op BackupOperation, note string) error
+
+// Covers reports whether the policy asks for a backup before op
+func (p *AutoBackupPolicy) Covers(op BackupOperation) bool {
+	if p == nil || !p.Enabled {
+		return false
+	}
+	if len(p.Operations) == 0 {
+		return true
+	}
+	for _, covered := range p.Operations {
+		if covered == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports operations that are not known, which would otherwise
+// silently go without a backup
+func (p *AutoBackupPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, op := range p.Operations {
+		if !isBackupOperation(op) {
+			names := make([]string, len(BackupOperations))
+			for i, known := range BackupOperations {
+				names[i] = string(known)
+			}
+			return fmt.Errorf("unknown autoBackup operation '%s' (use %s)", op, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+func isBackupOperation(op BackupOperation) bool {
+	for _, known := range BackupOperations {
+		if known == op {
+			return true
+		}
+	}
+	return false
+}
+
+// BackupBefore backs up a profile before op changes it, if the autoBackup
+// policy covers op. The operation must not go ahead when this fails.
+func (c *Config) BackupBefore(profile string, op BackupOperation, note string) error {
+	if AutoBackupFunc == nil || !c.AutoBackup.Covers(op) {
+		return nil
+	}
+	if err := AutoBackupFunc(c, profile, op, note); err != nil {
+		return fmt.Errorf("automatic backup before %s failed: %w", op, err)
+	}
+	return nil
+}
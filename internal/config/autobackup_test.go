@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// recordBackups installs an AutoBackupFunc that records its calls and checks
+// the profile still exists when it is called
+func recordBackups(t *testing.T, fail error) *[]string {
+	t.Helper()
+
+	var calls []string
+	AutoBackupFunc = func(cfg *Config, profile string, op BackupOperation, note string) error {
+		if _, err := os.Stat(filepath.Join(cfg.ProfilesDir, profile)); err != nil {
+			t.Errorf("backup of '%s' before %s ran after the profile changed: %v", profile, op, err)
+		}
+		calls = append(calls, string(op)+" "+profile)
+		return fail
+	}
+	t.Cleanup(func() { AutoBackupFunc = nil })
+	return &calls
+}
+
+func TestAutoBackupPolicy_Covers(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *AutoBackupPolicy
+		op     BackupOperation
+		want   bool
+	}{
+		{"no policy", nil, BackupBeforeDelete, false},
+		{"disabled", &AutoBackupPolicy{Operations: []BackupOperation{BackupBeforeDelete}}, BackupBeforeDelete, false},
+		{"all operations", &AutoBackupPolicy{Enabled: true}, BackupBeforeTemplate, true},
+		{"listed", &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{BackupBeforeDelete, BackupBeforeRename}}, BackupBeforeRename, true},
+		{"not listed", &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{BackupBeforeDelete}}, BackupBeforeImport, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Covers(tt.op); got != tt.want {
+				t.Errorf("Covers(%s) = %v, want %v", tt.op, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoBackupPolicy_Validate(t *testing.T) {
+	valid := &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{BackupBeforeDelete, BackupBeforeRestore}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	invalid := &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{"remove"}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() should reject unknown operations")
+	}
+}
+
+func TestAutoBackup_ConfigRoundTrip(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	err := cfg.Update(func(c *Config) {
+		c.AutoBackup = &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{BackupBeforeDelete}}
+	})
+	if err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.AutoBackup, cfg.AutoBackup) {
+		t.Errorf("AutoBackup = %+v, want %+v", loaded.AutoBackup, cfg.AutoBackup)
+	}
+}
+
+func TestAutoBackup_BeforeDestructiveOperations(t *testing.T) {
+	cfg, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	cfg.AutoBackup = &AutoBackupPolicy{Enabled: true}
+	calls := recordBackups(t, nil)
+
+	for _, name := range []string{"work", "old", "doomed"} {
+		if err := pm.CreateProfile(name, ""); err != nil {
+			t.Fatalf("CreateProfile(%s) failed: %v", name, err)
+		}
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("creating profiles should not back up: %v", *calls)
+	}
+
+	if err := pm.ApplyTemplate("work", "restrictive"); err != nil {
+		t.Fatalf("ApplyTemplate() failed: %v", err)
+	}
+	if err := pm.RenameProfile("old", "new"); err != nil {
+		t.Fatalf("RenameProfile() failed: %v", err)
+	}
+	if err := pm.DeleteProfile("doomed"); err != nil {
+		t.Fatalf("DeleteProfile() failed: %v", err)
+	}
+
+	source := setupImportSource(t)
+	if err := pm.ImportProfileWithOptions(source, "work", ImportOptions{Yes: true, Overwrite: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+	// A new profile has nothing to lose
+	if err := pm.ImportProfileWithOptions(source, "fresh", ImportOptions{Yes: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+
+	want := []string{"template work", "rename old", "delete doomed", "import work"}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("backups = %v, want %v", *calls, want)
+	}
+}
+
+func TestAutoBackup_OnlyCoveredOperations(t *testing.T) {
+	cfg, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	calls := recordBackups(t, nil)
+
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.CreateProfile("other", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opt-in: nothing happens without a policy
+	if err := pm.DeleteProfile("other"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.AutoBackup = &AutoBackupPolicy{Enabled: true, Operations: []BackupOperation{BackupBeforeDelete}}
+	if err := pm.RenameProfile("work", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.DeleteProfile("renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"delete renamed"}; !reflect.DeepEqual(*calls, want) {
+		t.Errorf("backups = %v, want %v", *calls, want)
+	}
+}
+
+func TestAutoBackup_FailureStopsOperation(t *testing.T) {
+	cfg, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	cfg.AutoBackup = &AutoBackupPolicy{Enabled: true}
+	recordBackups(t, errors.New("disk full"))
+
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pm.DeleteProfile("work"); err == nil {
+		t.Fatal("DeleteProfile() should fail when the backup fails")
+	}
+	if !pm.ProfileExists("work") {
+		t.Error("the profile should survive a failed backup")
+	}
+
+	if err := pm.RenameProfile("work", "other"); err == nil {
+		t.Fatal("RenameProfile() should fail when the backup fails")
+	}
+	if !pm.ProfileExists("work") || pm.ProfileExists("other") {
+		t.Error("the profile should not be renamed after a failed backup")
+	}
+}
@@ -0,0 +1,682 @@
+package config
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+const (
+	// BundleExtension is the file extension of exported profile bundles
+	BundleExtension = ".cdpbundle"
+	// BundleFormat identifies cdp bundles in their manifest
+	BundleFormat = "cdp-bundle"
+	// BundleFormatVersion is the bundle format written by this version of cdp
+	BundleFormatVersion = 1
+
+	bundleManifestName = "manifest.json"
+	bundleProfileDir   = "profile"
+
+	// maxBundleManifestSize bounds the manifest, which is read into memory
+	maxBundleManifestSize = 64 << 20
+)
+
+// Limits applied when importing, so a crafted bundle cannot exhaust memory
+// or fill the disk
+var (
+	// MaxBundleSize is the total size of the files extracted from a bundle
+	MaxBundleSize int64 = 1 << 30
+	// MaxBundleEntries is the number of files extracted from a bundle
+	MaxBundleEntries = 100000
+)
+
+// BundleComponents are the profile components included in a bundle. History
+// and plugins are machine specific and stay behind; credentials depend on
+// the CredentialMode.
+var BundleComponents = []string{"settings", "memory", "commands", "agents", "skills", "hooks"}
+
+// BundleManifest describes the content of a bundle
+type BundleManifest struct {
+	Format        string `json:"format"`
+	FormatVersion int    `json:"formatVersion"`
+	// CdpVersion is the version of cdp that wrote the bundle
+	CdpVersion  string    `json:"cdpVersion,omitempty"`
+	Profile     string    `json:"profile"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Template and TemplateHash record the template the profile was created from
+	Template     string         `json:"template,omitempty"`
+	TemplateHash string         `json:"templateHash,omitempty"`
+	Credentials  CredentialMode `json:"credentials"`
+	// Redacted lists the values that were stripped or redacted, e.g. "env.GITHUB_TOKEN"
+	Redacted []string     `json:"redacted,omitempty"`
+	Files    []BundleFile `json:"files"`
+
+	// Encrypted reports whether the bundle file is encrypted
+	Encrypted bool `json:"-"`
+}
+
+// BundleFile is a file in a bundle
+type BundleFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// ExportOptions controls ExportBundle
+type ExportOptions struct {
+	// Credentials controls how credentials and secret values are exported
+	Credentials CredentialMode
+	// CdpVersion is recorded in the manifest
+	CdpVersion string
+	// Encryption decides whether the bundle is encrypted. Bundles exported
+	// with credentials are always encrypted when the config requires it.
+	Encryption *ArchiveEncryption
+}
+
+// BundleImportOptions controls ImportBundle
+type BundleImportOptions struct {
+	// Name is the profile to create; defaults to the name in the manifest
+	Name string
+	// Overwrite replaces an existing profile with the same name
+	Overwrite bool
+	// Keys decrypt an encrypted bundle
+	Keys *encryption.Keys
+}
+
+// BundleImportResult describes an imported bundle
+type BundleImportResult struct {
+	Profile  string
+	Manifest *BundleManifest
+	// Missing lists redacted values that were left out and must be set again
+	Missing []string
+}
+
+// bundleEntry is a file prepared for a bundle
+type bundleEntry struct {
+	path string
+	mode fs.FileMode
+	data []byte
+}
+
+// ExportBundle writes a profile as a portable bundle to w: its settings,
+// metadata, memory, custom commands, agents, skills and hooks, plus a
+// manifest with file hashes. Secret values are handled according to
+// opts.Credentials.
+func (pm *ProfileManager) ExportBundle(name string, w io.Writer, opts ExportOptions) (*BundleManifest, error) {
+	if opts.Credentials == "" {
+		opts.Credentials = CredentialsStrip
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BundleManifest{
+		Format:        BundleFormat,
+		FormatVersion: BundleFormatVersion,
+		CdpVersion:    opts.CdpVersion,
+		Profile:       name,
+		Description:   profile.Metadata.Description,
+		CreatedAt:     time.Now(),
+		Template:      profile.Metadata.Template,
+		TemplateHash:  profile.Metadata.TemplateHash,
+		Credentials:   opts.Credentials,
+	}
+
+	entries, redacted, err := collectBundleEntries(profile, opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Redacted = redacted
+
+	for _, entry := range entries {
+		sum := sha256.Sum256(entry.data)
+		manifest.Files = append(manifest.Files, BundleFile{
+			Path:   entry.path,
+			Size:   int64(len(entry.data)),
+			Mode:   entry.mode,
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	hasCredentials := false
+	if opts.Credentials == CredentialsKeep {
+		for _, entry := range entries {
+			hasCredentials = hasCredentials || IsCredentialFile(entry.path)
+		}
+	}
+	enc := &ArchiveEncryption{}
+	if opts.Encryption != nil {
+		*enc = *opts.Encryption
+	}
+	if pm.config.Encryption != nil && pm.config.Encryption.RequireForCredentials {
+		enc.RequireForCredentials = true
+	}
+	encWriter, encrypted, err := enc.Wrap(w, hasCredentials)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Encrypted = encrypted
+
+	gzWriter := gzip.NewWriter(encWriter)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	// The manifest comes first so it can be read without extracting the bundle
+	files := append([]bundleEntry{{path: bundleManifestName, mode: 0644, data: manifestData}}, prefixEntries(entries)...)
+	for _, entry := range files {
+		header := &tar.Header{
+			Name:     entry.path,
+			Mode:     int64(entry.mode),
+			Size:     int64(len(entry.data)),
+			ModTime:  manifest.CreatedAt,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if _, err := tarWriter.Write(entry.data); err != nil {
+			return nil, fmt.Errorf("failed to write bundle: %w", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := encWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// collectBundleEntries reads the files of a profile that go into a bundle,
+// stripping or redacting secrets. Returns the entries and the redacted values.
+func collectBundleEntries(profile *Profile, mode CredentialMode) ([]bundleEntry, []string, error) {
+	only := append([]string(nil), BundleComponents...)
+	if mode != CredentialsStrip {
+		only = append(only, "credentials")
+	}
+	include, err := CloneOptions{Only: only}.filter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []bundleEntry
+	var redacted []string
+	err = filepath.WalkDir(profile.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(profile.Path, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !include(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		// Symlinks are followed: their targets rarely exist on another machine
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// OAuth tokens are useless once redacted
+		if rel == ClaudeCredentialsFile && mode == CredentialsRedact {
+			redacted = append(redacted, ClaudeCredentialsFile)
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		switch rel {
+		case ClaudeSettingsFile:
+			var paths []string
+			data, paths, err = redactSettingsEnv(data, mode)
+			if err != nil {
+				return fmt.Errorf("failed to redact %s: %w", rel, err)
+			}
+			redacted = append(redacted, prefixPaths(ClaudeSettingsFile, paths)...)
+		case ClaudeConfigFile:
+			if mode == CredentialsRedact {
+				var paths []string
+				data, paths, err = redactJSONFile(data)
+				if err != nil {
+					return fmt.Errorf("failed to redact %s: %w", rel, err)
+				}
+				redacted = append(redacted, prefixPaths(ClaudeConfigFile, paths)...)
+			}
+		}
+
+		entries = append(entries, bundleEntry{path: filepath.ToSlash(rel), mode: info.Mode().Perm(), data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	// Metadata is rebuilt for sharing: usage statistics stay behind
+	metadata := ProfileMetadata{
+		Description:  profile.Metadata.Description,
+		Template:     profile.Metadata.Template,
+		TemplateHash: profile.Metadata.TemplateHash,
+		SettingsHash: profile.Metadata.SettingsHash,
+		CustomFlags:  profile.Metadata.CustomFlags,
+		UnsetEnv:     profile.Metadata.UnsetEnv,
+	}
+	if len(profile.Metadata.Env) > 0 {
+		metadata.Env = make(map[string]string, len(profile.Metadata.Env))
+		for key, value := range profile.Metadata.Env {
+			metadata.Env[key] = value
+		}
+		for _, key := range redactEnv(metadata.Env, mode) {
+			redacted = append(redacted, "env."+key)
+		}
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	entries = append(entries, bundleEntry{path: MetadataFileName, mode: 0644, data: data})
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+	return entries, redacted, nil
+}
+
+// redactSettingsEnv strips or redacts secret values in the env block of settings.json
+func redactSettingsEnv(data []byte, mode CredentialMode) ([]byte, []string, error) {
+	if mode == CredentialsKeep {
+		return data, nil, nil
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, nil, err
+	}
+	env, ok := settings["env"].(map[string]interface{})
+	if !ok {
+		return data, nil, nil
+	}
+
+	paths := redactJSON(env, "env")
+	if len(paths) == 0 {
+		return data, nil, nil
+	}
+	if mode == CredentialsStrip {
+		dropRedacted(env, "env")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	return data, paths, err
+}
+
+// redactJSONFile redacts every secret-looking value of a JSON file
+func redactJSONFile(data []byte) ([]byte, []string, error) {
+	var content interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, nil, err
+	}
+
+	paths := redactJSON(content, "")
+	if len(paths) == 0 {
+		return data, nil, nil
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	return data, paths, err
+}
+
+// ReadBundleManifest reads the manifest of a bundle without extracting it.
+// keys decrypt an encrypted bundle.
+func ReadBundleManifest(bundlePath string, keys *encryption.Keys) (*BundleManifest, error) {
+	tarReader, closeBundle, encrypted, err := openBundle(bundlePath, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBundle()
+
+	manifest, err := readManifest(tarReader, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Encrypted = encrypted
+	return manifest, nil
+}
+
+// openBundle opens a bundle for reading, decrypting it if it is encrypted
+func openBundle(bundlePath string, keys *encryption.Keys) (*tar.Reader, func(), bool, error) {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	r, encrypted, err := encryption.NewReader(file, keys)
+	if err != nil {
+		file.Close()
+		return nil, nil, encrypted, fmt.Errorf("failed to decrypt bundle '%s': %w", bundlePath, err)
+	}
+
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		file.Close()
+		return nil, nil, encrypted, fmt.Errorf("'%s' is not a cdp bundle: %w", bundlePath, err)
+	}
+
+	return tar.NewReader(gzReader), func() {
+		gzReader.Close()
+		file.Close()
+	}, encrypted, nil
+}
+
+func readManifest(tarReader *tar.Reader, bundlePath string) (*BundleManifest, error) {
+	header, err := tarReader.Next()
+	if err != nil || header.Name != bundleManifestName {
+		return nil, fmt.Errorf("'%s' is not a cdp bundle: missing manifest", bundlePath)
+	}
+
+	if header.Size > maxBundleManifestSize {
+		return nil, fmt.Errorf("bundle manifest is larger than %d bytes", maxBundleManifestSize)
+	}
+
+	var manifest BundleManifest
+	if err := json.NewDecoder(io.LimitReader(tarReader, maxBundleManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+	}
+	if manifest.Format != BundleFormat {
+		return nil, fmt.Errorf("'%s' is not a cdp bundle", bundlePath)
+	}
+	if manifest.FormatVersion > BundleFormatVersion {
+		return nil, fmt.Errorf("bundle format version %d is newer than this cdp supports (%d); upgrade cdp", manifest.FormatVersion, BundleFormatVersion)
+	}
+
+	return &manifest, nil
+}
+
+// ImportBundle creates a profile from a bundle. Every file is checked against
+// the manifest hashes before the profile is created. Redacted values are
+// left out and reported in the result.
+func (pm *ProfileManager) ImportBundle(bundlePath string, opts BundleImportOptions) (*BundleImportResult, error) {
+	tarReader, closeBundle, encrypted, err := openBundle(bundlePath, opts.Keys)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBundle()
+
+	manifest, err := readManifest(tarReader, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Encrypted = encrypted
+
+	name := opts.Name
+	if name == "" {
+		name = manifest.Profile
+	}
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid profile name: %w", err)
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	destPath := filepath.Join(pm.config.ProfilesDir, name)
+	if _, err := os.Stat(destPath); err == nil && !opts.Overwrite {
+		return nil, fmt.Errorf("profile '%s' already exists (use --overwrite to replace it, or --name to import under another name)", name)
+	}
+
+	staging, err := os.MkdirTemp(pm.config.ProfilesDir, ImportStagingPrefix+name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	stagedPath := filepath.Join(staging, name)
+
+	if err := extractBundle(tarReader, manifest, stagedPath); err != nil {
+		return nil, err
+	}
+
+	result := &BundleImportResult{Profile: name, Manifest: manifest}
+
+	metadata, err := pm.loadMetadata(stagedPath)
+	if err != nil {
+		return nil, fmt.Errorf("bundle has invalid metadata: %w", err)
+	}
+	// Names end up in shell code through 'cdp activate'
+	for _, key := range append(sortedStringKeys(metadata.Env), metadata.UnsetEnv...) {
+		if err := ValidateEnvName(key); err != nil {
+			return nil, fmt.Errorf("bundle has invalid metadata: %w", err)
+		}
+	}
+	metadata.CreatedAt = time.Now()
+	metadata.LastUsed = time.Time{}
+	metadata.UsageCount = 0
+	for _, key := range sortedStringKeys(metadata.Env) {
+		if metadata.Env[key] == RedactedValue {
+			delete(metadata.Env, key)
+			result.Missing = append(result.Missing, "env."+key)
+		}
+	}
+	if err := pm.saveMetadata(stagedPath, metadata); err != nil {
+		return nil, err
+	}
+
+	// Placeholders must never reach Claude
+	for _, name := range []string{ClaudeSettingsFile, ClaudeConfigFile} {
+		dropped, err := dropRedactedFromFile(filepath.Join(stagedPath, name))
+		if err != nil {
+			return nil, err
+		}
+		result.Missing = append(result.Missing, prefixPaths(name, dropped)...)
+	}
+
+	for _, file := range []string{ClaudeConfigFile, ClaudeSettingsFile} {
+		filePath := filepath.Join(stagedPath, file)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			if err := os.WriteFile(filePath, []byte("{}"), 0644); err != nil {
+				return nil, fmt.Errorf("failed to create %s: %w", file, err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(destPath); err == nil {
+		if err := pm.config.BackupBefore(name, BackupBeforeImport, fmt.Sprintf("replaced by bundle %s", filepath.Base(bundlePath))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := InstallStaged(stagedPath, destPath); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// extractBundle writes the files of a bundle to dir, checking them against
+// the manifest. The manifest totals are checked against MaxBundleSize and
+// MaxBundleEntries first, and files are hashed as they are written.
+func extractBundle(tarReader *tar.Reader, manifest *BundleManifest, dir string) error {
+	if len(manifest.Files) > MaxBundleEntries {
+		return fmt.Errorf("bundle has more than %d files", MaxBundleEntries)
+	}
+	var total int64
+	expected := make(map[string]BundleFile, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if file.Size < 0 || file.Size > MaxBundleSize-total {
+			return fmt.Errorf("bundle is larger than the import limit of %d bytes", MaxBundleSize)
+		}
+		total += file.Size
+		expected[file.Path] = file
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+
+		rel, ok := strings.CutPrefix(header.Name, bundleProfileDir+"/")
+		if !ok || header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("bundle contains unexpected entry '%s'", header.Name)
+		}
+		rel = path.Clean(rel)
+		if !fs.ValidPath(rel) {
+			return fmt.Errorf("bundle contains unsafe path '%s'", header.Name)
+		}
+
+		want, ok := expected[rel]
+		if !ok {
+			return fmt.Errorf("bundle contains '%s', which is not in its manifest", rel)
+		}
+		delete(expected, rel)
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		match, err := extractBundleFile(tarReader, target, want)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		if !match {
+			return fmt.Errorf("%s does not match the bundle manifest; the bundle is corrupted or was modified", rel)
+		}
+	}
+
+	if len(expected) > 0 {
+		missing := make([]string, 0, len(expected))
+		for rel := range expected {
+			missing = append(missing, rel)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("bundle is incomplete: missing %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// extractBundleFile streams a bundle entry to target, hashing it on the way,
+// and reports whether it matches the manifest. A file that does not is left
+// for the caller to discard with the staging directory.
+func extractBundleFile(r io.Reader, target string, want BundleFile) (bool, error) {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, want.Mode.Perm())
+	if err != nil {
+		return false, err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(r, want.Size+1))
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+	if err := file.Close(); err != nil {
+		return false, err
+	}
+	if n != want.Size || hex.EncodeToString(hash.Sum(nil)) != want.SHA256 {
+		return false, nil
+	}
+
+	// OpenFile applies the umask
+	return true, os.Chmod(target, want.Mode.Perm())
+}
+
+// dropRedactedFromFile removes redacted values from a JSON file, if it exists
+func dropRedactedFromFile(filePath string) ([]string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var content interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("bundle has invalid %s: %w", filepath.Base(filePath), err)
+	}
+
+	dropped := dropRedacted(content, "")
+	if len(dropped) == 0 {
+		return nil, nil
+	}
+
+	data, err = json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return dropped, os.WriteFile(filePath, data, info.Mode().Perm())
+}
+
+// prefixEntries places bundle entries under the profile directory of the archive
+func prefixEntries(entries []bundleEntry) []bundleEntry {
+	prefixed := make([]bundleEntry, len(entries))
+	for i, entry := range entries {
+		entry.path = bundleProfileDir + "/" + entry.path
+		prefixed[i] = entry
+	}
+	return prefixed
+}
+
+// prefixPaths qualifies redacted paths with the file they were found in
+func prefixPaths(prefix string, paths []string) []string {
+	prefixed := make([]string, len(paths))
+	for i, p := range paths {
+		prefixed[i] = prefix + ": " + p
+	}
+	return prefixed
+}
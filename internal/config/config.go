@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,9 +18,37 @@ const (
 
 // Config represents the global CDP configuration
 type Config struct {
-	Version        string `yaml:"version"`
-	ProfilesDir    string `yaml:"profilesDir"`
-	CurrentProfile string `yaml:"currentProfile,omitempty"`
+	Version           string                  `yaml:"version"`
+	ProfilesDir       string                  `yaml:"profilesDir"`
+	CurrentProfile    string                  `yaml:"currentProfile,omitempty"`
+	DirectoryProfiles []DirectoryBinding      `yaml:"directoryProfiles,omitempty"`
+	AutoBackup        *AutoBackupPolicy       `yaml:"autoBackup,omitempty"`
+	BackupRetention   *RetentionPolicy        `yaml:"backupRetention,omitempty"`
+	Encryption        *EncryptionPolicy       `yaml:"encryption,omitempty"`
+	BackupTargets     map[string]BackupTarget `yaml:"backupTargets,omitempty"`
+	BackupDedup       bool                    `yaml:"backupDedup,omitempty"`
+}
+
+// DirectoryBinding maps a directory glob to the profile used inside it
+type DirectoryBinding struct {
+	Path    string `yaml:"path"`
+	Profile string `yaml:"profile"`
+}
+
+// RetentionPolicy selects the backups 'cdp backup prune' keeps for each
+// profile. A backup is kept when any rule keeps it.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest backups
+	KeepLast int `yaml:"keepLast,omitempty"`
+	// KeepDaily keeps the newest backup of each of the last days with backups
+	KeepDaily int `yaml:"keepDaily,omitempty"`
+	// KeepWeekly keeps the newest backup of each of the last weeks with backups
+	KeepWeekly int `yaml:"keepWeekly,omitempty"`
+}
+
+// IsZero reports whether the policy has no rules, and so would keep nothing
+func (p RetentionPolicy) IsZero() bool {
+	return p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0
 }
 
 // GetConfigDir returns the CDP configuration directory path
@@ -120,12 +149,18 @@ func (c *Config) Save() error {
 		return err
 	}
 
+	unlock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := atomicfile.WriteFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -139,8 +174,35 @@ func (c *Config) GetProfilesDir() string {
 
 // SetCurrentProfile sets the current active profile
 func (c *Config) SetCurrentProfile(name string) error {
-	c.CurrentProfile = name
-	return c.Save()
+	return c.Update(func(latest *Config) {
+		latest.CurrentProfile = name
+	})
+}
+
+// Update applies fn to the configuration on disk and saves it while holding
+// the config lock, so changes made by other cdp processes since c was loaded
+// are not lost. c is refreshed with the saved configuration.
+func (c *Config) Update(fn func(*Config)) error {
+	unlock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	latest := c
+	if Exists() {
+		if latest, err = Load(); err != nil {
+			return err
+		}
+	}
+
+	fn(latest)
+	if err := latest.Save(); err != nil {
+		return err
+	}
+
+	*c = *latest
+	return nil
 }
 
 // GetCurrentProfile returns the current active profile name
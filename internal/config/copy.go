@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ClaudeCredentialsFile holds the OAuth tokens on systems without a keychain
+const ClaudeCredentialsFile = ".credentials.json"
+
+// ProfileComponent is a named part of a profile that clone can select
+type ProfileComponent struct {
+	Name        string
+	Description string
+	// Paths are the files and directories of the component, relative to the profile
+	Paths []string
+}
+
+// ProfileComponents lists the parts of a Claude config directory that can be
+// selected with --only. Files outside every component are copied unless
+// --only is given.
+var ProfileComponents = []ProfileComponent{
+	{Name: "settings", Description: "settings.json and template provenance", Paths: []string{ClaudeSettingsFile, "settings.local.json", TemplateBaseFile}},
+	{Name: "credentials", Description: "OAuth login", Paths: []string{ClaudeConfigFile, ClaudeCredentialsFile}},
+	{Name: "memory", Description: "CLAUDE.md", Paths: []string{"CLAUDE.md"}},
+	{Name: "commands", Description: "custom slash commands", Paths: []string{"commands"}},
+	{Name: "agents", Description: "custom agents", Paths: []string{"agents"}},
+	{Name: "skills", Description: "skills", Paths: []string{"skills"}},
+	{Name: "hooks", Description: "hook scripts", Paths: []string{"hooks"}},
+	{Name: "plugins", Description: "installed plugins", Paths: []string{"plugins"}},
+	{Name: "history", Description: "conversations, todos and shell snapshots", Paths: []string{"projects", "todos", "shell-snapshots", "history.jsonl", "statsig"}},
+}
+
+// CloneOptions selects what CloneProfileWithOptions copies
+type CloneOptions struct {
+	// Only limits the copy to these components; empty copies everything
+	Only []string
+	// ExcludeHistory skips the history component
+	ExcludeHistory bool
+	// NoCredentials skips the credentials component, so the copy is logged out
+	NoCredentials bool
+}
+
+// ComponentNames returns the names of the profile components
+func ComponentNames() []string {
+	names := make([]string, len(ProfileComponents))
+	for i, component := range ProfileComponents {
+		names[i] = component.Name
+	}
+	return names
+}
+
+// findComponent returns the component a profile-relative path belongs to, if any
+func findComponent(rel string) (ProfileComponent, bool) {
+	top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+	for _, component := range ProfileComponents {
+		for _, path := range component.Paths {
+			if path == top {
+				return component, true
+			}
+		}
+	}
+	return ProfileComponent{}, false
+}
+
+// filter returns a function reporting whether a profile-relative path is copied
+func (opts CloneOptions) filter() (func(rel string) bool, error) {
+	only := make(map[string]bool)
+	for _, name := range opts.Only {
+		name = strings.TrimSpace(name)
+		if _, ok := lookupComponent(name); !ok {
+			return nil, fmt.Errorf("unknown component '%s' (use %s)", name, strings.Join(ComponentNames(), ", "))
+		}
+		only[name] = true
+	}
+
+	return func(rel string) bool {
+		if filepath.Base(rel) == MetadataFileName && filepath.Dir(rel) == "." {
+			return false
+		}
+
+		component, ok := findComponent(rel)
+		switch {
+		case ok && component.Name == "history" && opts.ExcludeHistory:
+			return false
+		case ok && component.Name == "credentials" && opts.NoCredentials:
+			return false
+		case len(only) > 0:
+			return ok && only[component.Name]
+		default:
+			return true
+		}
+	}, nil
+}
+
+func lookupComponent(name string) (ProfileComponent, bool) {
+	for _, component := range ProfileComponents {
+		if component.Name == name {
+			return component, true
+		}
+	}
+	return ProfileComponent{}, false
+}
+
+// copyTree recursively copies src into dst, preserving file modes and
+// symlinks. include is called with each path relative to src; directories it
+// rejects are skipped entirely. Returns the relative paths of copied files.
+func copyTree(src, dst string, include func(rel string) bool) ([]string, error) {
+	var copied []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if rel == "." {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		if !include(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case info.IsDir():
+			if err := os.Mkdir(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			// Mkdir is subject to the umask
+			return os.Chmod(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			// Sockets, pipes and devices are not configuration
+			return nil
+		}
+
+		copied = append(copied, rel)
+		return nil
+	})
+	if err != nil {
+		return copied, fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+
+	sort.Strings(copied)
+	return copied, nil
+}
+
+// copyFile copies a regular file, creating dst with the given permissions
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile is subject to the umask
+	return os.Chmod(dst, perm)
+}
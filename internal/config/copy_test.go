@@ -0,0 +1,221 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupRichProfile creates a profile with the subdirectories of a real
+// Claude config directory
+func setupRichProfile(t *testing.T, pm *ProfileManager, name string) string {
+	t.Helper()
+	if err := pm.CreateProfile(name, ""); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	profilePath := filepath.Join(pm.config.ProfilesDir, name)
+	files := map[string]string{
+		ClaudeCredentialsFile:              `{"token": "secret"}`,
+		"CLAUDE.md":                        "# Notes",
+		"commands/review.md":               "Review the diff",
+		"commands/git/commit.md":           "Write a commit",
+		"agents/tester.md":                 "You test things",
+		"projects/-home-me-app/chat.jsonl": "{}",
+		"todos/list.json":                  "[]",
+	}
+	for rel, content := range files {
+		path := filepath.Join(profilePath, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", rel, err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(profilePath, ClaudeCredentialsFile), 0600); err != nil {
+		t.Fatalf("failed to chmod credentials: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(profilePath, ClaudeConfigFile), 0600); err != nil {
+		t.Fatalf("failed to chmod .claude.json: %v", err)
+	}
+	if err := os.Symlink("review.md", filepath.Join(profilePath, "commands", "r.md")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	return profilePath
+}
+
+func TestCloneProfile_Recursive(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRichProfile(t, pm, "source")
+
+	if err := pm.CloneProfile("source", "dest"); err != nil {
+		t.Fatalf("CloneProfile() failed: %v", err)
+	}
+	destPath := filepath.Join(pm.config.ProfilesDir, "dest")
+
+	for _, rel := range []string{"commands/git/commit.md", "agents/tester.md", "projects/-home-me-app/chat.jsonl", ClaudeCredentialsFile} {
+		if _, err := os.Stat(filepath.Join(destPath, rel)); err != nil {
+			t.Errorf("%s was not copied: %v", rel, err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(destPath, ClaudeCredentialsFile))
+	if err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("credentials mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	link, err := os.Readlink(filepath.Join(destPath, "commands", "r.md"))
+	if err != nil {
+		t.Errorf("symlink was not preserved: %v", err)
+	} else if link != "review.md" {
+		t.Errorf("symlink target = %q, want %q", link, "review.md")
+	}
+}
+
+func TestCloneProfileWithOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CloneOptions
+		wantSome []string
+		wantNone []string
+	}{
+		{
+			name:     "only",
+			opts:     CloneOptions{Only: []string{"settings", "commands", "agents"}},
+			wantSome: []string{ClaudeSettingsFile, "commands/review.md", "agents/tester.md"},
+			wantNone: []string{"CLAUDE.md", "todos", ClaudeCredentialsFile},
+		},
+		{
+			name:     "exclude history",
+			opts:     CloneOptions{ExcludeHistory: true},
+			wantSome: []string{"CLAUDE.md", ClaudeCredentialsFile},
+			wantNone: []string{"projects", "todos"},
+		},
+		{
+			name:     "no credentials",
+			opts:     CloneOptions{NoCredentials: true},
+			wantSome: []string{"commands/review.md", "projects"},
+			wantNone: []string{ClaudeCredentialsFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, pm, cleanup := setupTestEnv(t)
+			defer cleanup()
+			setupRichProfile(t, pm, "source")
+
+			if _, err := pm.CloneProfileWithOptions("source", "dest", tt.opts); err != nil {
+				t.Fatalf("CloneProfileWithOptions() failed: %v", err)
+			}
+			destPath := filepath.Join(pm.config.ProfilesDir, "dest")
+
+			for _, rel := range tt.wantSome {
+				if _, err := os.Stat(filepath.Join(destPath, rel)); err != nil {
+					t.Errorf("%s should have been copied", rel)
+				}
+			}
+			for _, rel := range tt.wantNone {
+				if _, err := os.Stat(filepath.Join(destPath, rel)); err == nil {
+					t.Errorf("%s should not have been copied", rel)
+				}
+			}
+
+			// The clone is always a valid profile
+			profile, err := pm.GetProfile("dest")
+			if err != nil {
+				t.Fatalf("GetProfile() failed: %v", err)
+			}
+			if err := pm.ValidateProfile(profile); err != nil {
+				t.Errorf("clone is not a valid profile: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloneProfileWithOptions_NoCredentialsPlaceholder(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourcePath := setupRichProfile(t, pm, "source")
+	if err := os.WriteFile(filepath.Join(sourcePath, ClaudeConfigFile), []byte(`{"oauthAccount": {"email": "me@example.com"}}`), 0600); err != nil {
+		t.Fatalf("failed to write .claude.json: %v", err)
+	}
+
+	if _, err := pm.CloneProfileWithOptions("source", "dest", CloneOptions{NoCredentials: true}); err != nil {
+		t.Fatalf("CloneProfileWithOptions() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(pm.config.ProfilesDir, "dest", ClaudeConfigFile))
+	if err != nil {
+		t.Fatalf("failed to read .claude.json: %v", err)
+	}
+	if string(data) != "{}" {
+		t.Errorf(".claude.json = %s, want an empty placeholder", data)
+	}
+}
+
+func TestCloneProfileWithOptions_NoCredentialsEnv(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRichProfile(t, pm, "source")
+	env := map[string]string{"ANTHROPIC_API_KEY": "sk-ant-REDACTED", "HTTPS_PROXY": "http://proxy:8080"}
+	if err := pm.SetEnv("source", env); err != nil {
+		t.Fatalf("SetEnv() failed: %v", err)
+	}
+
+	if _, err := pm.CloneProfileWithOptions("source", "dest", CloneOptions{NoCredentials: true}); err != nil {
+		t.Fatalf("CloneProfileWithOptions() failed: %v", err)
+	}
+
+	dest, err := pm.GetProfile("dest")
+	if err != nil {
+		t.Fatalf("GetProfile() failed: %v", err)
+	}
+	if !reflect.DeepEqual(dest.Metadata.Env, map[string]string{"HTTPS_PROXY": "http://proxy:8080"}) {
+		t.Errorf("clone env = %v, want only HTTPS_PROXY", dest.Metadata.Env)
+	}
+	source, _ := pm.GetProfile("source")
+	if !reflect.DeepEqual(source.Metadata.Env, env) {
+		t.Errorf("source env = %v, want it unchanged", source.Metadata.Env)
+	}
+}
+
+func TestCloneProfileWithOptions_UnknownComponent(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setupRichProfile(t, pm, "source")
+
+	if _, err := pm.CloneProfileWithOptions("source", "dest", CloneOptions{Only: []string{"secrets"}}); err == nil {
+		t.Error("CloneProfileWithOptions() should reject unknown components")
+	}
+	if pm.ProfileExists("dest") {
+		t.Error("nothing should be created when the options are invalid")
+	}
+}
+
+func TestCopyTree_Filter(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "copy")
+	for _, rel := range []string{"keep/a.txt", "skip/b.txt", "c.txt"} {
+		path := filepath.Join(src, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(rel), 0640)
+	}
+
+	copied, err := copyTree(src, dst, func(rel string) bool { return rel != "skip" })
+	if err != nil {
+		t.Fatalf("copyTree() failed: %v", err)
+	}
+
+	want := []string{"c.txt", filepath.Join("keep", "a.txt")}
+	if !reflect.DeepEqual(copied, want) {
+		t.Errorf("copied = %v, want %v", copied, want)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "c.txt")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("c.txt mode not preserved: %v, %v", info, err)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+// CredentialFiles are the profile files that hold login tokens
+var CredentialFiles = []string{ClaudeConfigFile, ClaudeCredentialsFile}
+
+// ErrEncryptionRequired is returned when an archive with credential files
+// would be written unencrypted while encryption.requireForCredentials is set
+var ErrEncryptionRequired = errors.New("the archive contains credential files and encryption.requireForCredentials is set, but there is no recipient or passphrase to encrypt it with")
+
+// EncryptionPolicy is the encryption section of config.yaml
+type EncryptionPolicy struct {
+	// Recipients are age public keys (age1...) every backup and bundle is
+	// encrypted to
+	Recipients []string `yaml:"recipients,omitempty"`
+	// IdentityFile holds the age private keys used to decrypt them
+	IdentityFile string `yaml:"identityFile,omitempty"`
+	// RequireForCredentials encrypts every archive that contains credential
+	// files, and refuses to write one when there is no way to encrypt it
+	RequireForCredentials bool `yaml:"requireForCredentials,omitempty"`
+}
+
+// Keys parses the configured recipients and loads the identity file
+func (p *EncryptionPolicy) Keys() (*encryption.Keys, error) {
+	keys := &encryption.Keys{}
+	if p == nil {
+		return keys, nil
+	}
+
+	for _, s := range p.Recipients {
+		recipient, err := encryption.ParseRecipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("encryption.recipients: %w", err)
+		}
+		keys.Recipients = append(keys.Recipients, recipient)
+	}
+
+	if p.IdentityFile != "" {
+		identities, err := encryption.LoadIdentities(expandHome(p.IdentityFile))
+		if err != nil {
+			return nil, fmt.Errorf("encryption.identityFile: %w", err)
+		}
+		keys.Identities = identities
+	}
+
+	return keys, nil
+}
+
+// ArchiveEncryption decides whether a backup or bundle is encrypted, and
+// holds the keys to encrypt and decrypt it
+type ArchiveEncryption struct {
+	Keys *encryption.Keys
+	// Always encrypts every archive
+	Always bool
+	// RequireForCredentials encrypts archives that contain credential files
+	RequireForCredentials bool
+}
+
+// IsCredentialFile reports whether a path relative to the profile is one of
+// the CredentialFiles
+func IsCredentialFile(rel string) bool {
+	for _, name := range CredentialFiles {
+		if path.Clean(rel) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypts reports whether an archive has to be encrypted. hasCredentials
+// reports whether it contains credential files.
+func (e *ArchiveEncryption) Encrypts(hasCredentials bool) bool {
+	return e != nil && (e.Always || (e.RequireForCredentials && hasCredentials))
+}
+
+// Wrap returns a writer to w that encrypts when the archive has to be
+// encrypted, and reports whether it does. Closing the writer flushes the
+// encryption but does not close w.
+func (e *ArchiveEncryption) Wrap(w io.Writer, hasCredentials bool) (io.WriteCloser, bool, error) {
+	if !e.Encrypts(hasCredentials) {
+		return nopCloser{w}, false, nil
+	}
+
+	if !e.Keys.CanEncrypt() {
+		if !e.Always {
+			return nil, false, ErrEncryptionRequired
+		}
+		return nil, false, errors.New("no recipient or passphrase to encrypt with")
+	}
+
+	writer, err := encryption.NewWriter(w, e.Keys)
+	if err != nil {
+		return nil, false, err
+	}
+	return writer, true, nil
+}
+
+// DecryptionKeys returns the keys used to read encrypted archives
+func (e *ArchiveEncryption) DecryptionKeys() *encryption.Keys {
+	if e == nil {
+		return nil
+	}
+	return e.Keys
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+func TestEncryptionPolicy_Keys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(home, "cdp-key.txt"), []byte(identity.String()+"\n"), 0600)
+
+	policy := &EncryptionPolicy{
+		Recipients:   []string{identity.Recipient().String()},
+		IdentityFile: "~/cdp-key.txt",
+	}
+	keys, err := policy.Keys()
+	if err != nil {
+		t.Fatalf("Keys() failed: %v", err)
+	}
+	if len(keys.Recipients) != 1 || len(keys.Identities) != 1 {
+		t.Errorf("Keys() = %d recipient(s), %d identities; want 1 and 1", len(keys.Recipients), len(keys.Identities))
+	}
+
+	if keys, err := (*EncryptionPolicy)(nil).Keys(); err != nil || keys.CanEncrypt() {
+		t.Errorf("Keys() without a policy = %+v, %v", keys, err)
+	}
+
+	policy.Recipients = []string{"age1invalid"}
+	if _, err := policy.Keys(); err == nil {
+		t.Error("Keys() should reject an invalid recipient")
+	}
+	policy.Recipients = nil
+	policy.IdentityFile = "~/missing.txt"
+	if _, err := policy.Keys(); err == nil {
+		t.Error("Keys() should fail on a missing identity file")
+	}
+}
+
+func TestArchiveEncryption_Wrap(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	keys := &encryption.Keys{Recipients: []age.Recipient{identity.Recipient()}}
+
+	tests := []struct {
+		name           string
+		enc            *ArchiveEncryption
+		hasCredentials bool
+		wantEncrypted  bool
+		wantErr        error
+	}{
+		{"no policy", nil, true, false, nil},
+		{"not required", &ArchiveEncryption{Keys: keys}, true, false, nil},
+		{"always", &ArchiveEncryption{Keys: keys, Always: true}, false, true, nil},
+		{"required for credentials", &ArchiveEncryption{Keys: keys, RequireForCredentials: true}, true, true, nil},
+		{"no credentials", &ArchiveEncryption{RequireForCredentials: true}, false, false, nil},
+		{"required without keys", &ArchiveEncryption{RequireForCredentials: true}, true, false, ErrEncryptionRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, encrypted, err := tt.enc.Wrap(&buf, tt.hasCredentials)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Wrap() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wrap() failed: %v", err)
+			}
+			w.Write([]byte("archive"))
+			w.Close()
+
+			if encrypted != tt.wantEncrypted {
+				t.Errorf("encrypted = %v, want %v", encrypted, tt.wantEncrypted)
+			}
+			if got := bytes.HasPrefix(buf.Bytes(), []byte(encryption.Magic)); got != tt.wantEncrypted {
+				t.Errorf("output encrypted = %v, want %v", got, tt.wantEncrypted)
+			}
+		})
+	}
+}
+
+func TestIsCredentialFile(t *testing.T) {
+	for path, want := range map[string]bool{
+		ClaudeConfigFile:             true,
+		"./" + ClaudeCredentialsFile: true,
+		ClaudeSettingsFile:           false,
+		"projects/.claude.json":      false,
+	} {
+		if got := IsCredentialFile(path); got != want {
+			t.Errorf("IsCredentialFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
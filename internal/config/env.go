@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// Valid environment variable name pattern
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// Variables managed by cdp itself that profiles cannot override
+	reservedEnvVars = map[string]bool{
+		"CLAUDE_CONFIG_DIR": true,
+		"CLAUDE_PROFILE":    true,
+	}
+)
+
+// ValidateEnvName checks if an environment variable name can be stored in a profile
+func ValidateEnvName(name string) error {
+	if !envNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name '%s'", name)
+	}
+	if reservedEnvVars[name] {
+		return fmt.Errorf("'%s' is managed by cdp and cannot be overridden", name)
+	}
+	return nil
+}
+
+// SetEnv stores environment variables for a profile.
+// Values may reference the parent environment with ${VAR}, and $$ is a
+// literal $.
+func (pm *ProfileManager) SetEnv(name string, vars map[string]string) error {
+	for key := range vars {
+		if err := ValidateEnvName(key); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	if profile.Metadata.Env == nil {
+		profile.Metadata.Env = make(map[string]string)
+	}
+	for key, value := range vars {
+		profile.Metadata.Env[key] = value
+		profile.Metadata.UnsetEnv = removeString(profile.Metadata.UnsetEnv, key)
+	}
+
+	return pm.saveMetadata(profile.Path, profile.Metadata)
+}
+
+// UnsetEnv removes stored environment variables from a profile.
+// If inherit is false, the variables are also added to the profile's unset
+// list so they are removed from the environment Claude inherits.
+func (pm *ProfileManager) UnsetEnv(name string, keys []string, inherit bool) error {
+	for _, key := range keys {
+		if err := ValidateEnvName(key); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		delete(profile.Metadata.Env, key)
+		profile.Metadata.UnsetEnv = removeString(profile.Metadata.UnsetEnv, key)
+		if !inherit {
+			profile.Metadata.UnsetEnv = append(profile.Metadata.UnsetEnv, key)
+		}
+	}
+
+	return pm.saveMetadata(profile.Path, profile.Metadata)
+}
+
+// removeString returns list without any occurrence of s
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
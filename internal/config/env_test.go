@@ -0,0 +1,93 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateEnvName(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"HTTPS_PROXY", false},
+		{"_private", false},
+		{"lower_case1", false},
+		{"1INVALID", true},
+		{"WITH-DASH", true},
+		{"", true},
+		{"CLAUDE_CONFIG_DIR", true},
+		{"CLAUDE_PROFILE", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateEnvName(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateEnvName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetAndUnsetEnv(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	err := pm.SetEnv("work", map[string]string{
+		"HTTPS_PROXY":        "http://proxy:8080",
+		"ANTHROPIC_BASE_URL": "https://gateway.corp",
+	})
+	if err != nil {
+		t.Fatalf("SetEnv() failed: %v", err)
+	}
+
+	// Unset without inherit removes the value and blocks the parent variable
+	if err := pm.UnsetEnv("work", []string{"HTTPS_PROXY"}, false); err != nil {
+		t.Fatalf("UnsetEnv() failed: %v", err)
+	}
+
+	profile, _ := pm.GetProfile("work")
+	wantEnv := map[string]string{"ANTHROPIC_BASE_URL": "https://gateway.corp"}
+	if !reflect.DeepEqual(profile.Metadata.Env, wantEnv) {
+		t.Errorf("Env = %v, want %v", profile.Metadata.Env, wantEnv)
+	}
+	if !reflect.DeepEqual(profile.Metadata.UnsetEnv, []string{"HTTPS_PROXY"}) {
+		t.Errorf("UnsetEnv = %v, want [HTTPS_PROXY]", profile.Metadata.UnsetEnv)
+	}
+
+	// Setting the variable again removes it from the unset list
+	if err := pm.SetEnv("work", map[string]string{"HTTPS_PROXY": "http://other"}); err != nil {
+		t.Fatalf("SetEnv() failed: %v", err)
+	}
+	profile, _ = pm.GetProfile("work")
+	if len(profile.Metadata.UnsetEnv) != 0 {
+		t.Errorf("UnsetEnv = %v, want empty", profile.Metadata.UnsetEnv)
+	}
+
+	// Unset with inherit only forgets the profile value
+	if err := pm.UnsetEnv("work", []string{"HTTPS_PROXY"}, true); err != nil {
+		t.Fatalf("UnsetEnv() failed: %v", err)
+	}
+	profile, _ = pm.GetProfile("work")
+	if _, ok := profile.Metadata.Env["HTTPS_PROXY"]; ok || len(profile.Metadata.UnsetEnv) != 0 {
+		t.Errorf("HTTPS_PROXY should be fully removed, got env=%v unset=%v",
+			profile.Metadata.Env, profile.Metadata.UnsetEnv)
+	}
+}
+
+func TestSetEnv_InvalidName(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+
+	if err := pm.SetEnv("work", map[string]string{"CLAUDE_CONFIG_DIR": "/tmp"}); err == nil {
+		t.Error("SetEnv() should reject reserved variables")
+	}
+	if err := pm.SetEnv("work", map[string]string{"BAD-NAME": "x"}); err == nil {
+		t.Error("SetEnv() should reject invalid names")
+	}
+}
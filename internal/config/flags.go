@@ -0,0 +1,138 @@
+package config
+
+import (
+	"strings"
+)
+
+// SetCustomFlags replaces the stored Claude flags of a profile
+func (pm *ProfileManager) SetCustomFlags(name string, flags []string) error {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	profile.Metadata.CustomFlags = flags
+	return pm.saveMetadata(profile.Path, profile.Metadata)
+}
+
+// AddCustomFlags adds flags to a profile, replacing stored flags with the same name
+func (pm *ProfileManager) AddCustomFlags(name string, flags []string) error {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	profile.Metadata.CustomFlags = MergeFlags(profile.Metadata.CustomFlags, flags)
+	return pm.saveMetadata(profile.Path, profile.Metadata)
+}
+
+// RemoveCustomFlags removes stored flags (and their values) by flag name
+func (pm *ProfileManager) RemoveCustomFlags(name string, flagNames []string) error {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool)
+	for _, flagName := range flagNames {
+		remove[FlagName(flagName)] = true
+	}
+
+	var kept []string
+	for _, group := range groupFlags(profile.Metadata.CustomFlags) {
+		if remove[FlagName(group[0])] {
+			continue
+		}
+		kept = append(kept, group...)
+	}
+
+	profile.Metadata.CustomFlags = kept
+	return pm.saveMetadata(profile.Path, profile.Metadata)
+}
+
+// ClearCustomFlags removes all stored flags from a profile
+func (pm *ProfileManager) ClearCustomFlags(name string) error {
+	return pm.SetCustomFlags(name, nil)
+}
+
+// MergeFlags combines stored profile flags with command-line flags.
+// Command-line flags win: any stored flag whose name also appears on the
+// command line is dropped together with its value. Stored flags come first
+// so that the command line can still append positional arguments.
+//
+// Example:
+//
+//	stored:  --model opus --verbose
+//	cli:     --model=sonnet --continue
+//	result:  --verbose --model=sonnet --continue
+func MergeFlags(stored, cli []string) []string {
+	overridden := make(map[string]bool)
+	for _, group := range groupFlags(cli) {
+		if name := FlagName(group[0]); name != "" {
+			overridden[name] = true
+		}
+	}
+
+	merged := []string{}
+	for _, group := range groupFlags(stored) {
+		if overridden[FlagName(group[0])] {
+			continue
+		}
+		merged = append(merged, group...)
+	}
+
+	return append(merged, cli...)
+}
+
+// FlagName returns the name of a flag token without its value,
+// e.g. "--model=opus" -> "--model". Non-flag tokens return "".
+func FlagName(token string) string {
+	if !strings.HasPrefix(token, "-") || token == "-" || token == "--" {
+		return ""
+	}
+	if idx := strings.Index(token, "="); idx != -1 {
+		return token[:idx]
+	}
+	return token
+}
+
+// groupFlags splits a flag list into groups of a flag followed by its values.
+// Tokens before the first flag, and everything after "--", form groups
+// without a name so they are never treated as overridable flags.
+func groupFlags(flags []string) [][]string {
+	var groups [][]string
+	for i, token := range flags {
+		if token == "--" {
+			groups = append(groups, flags[i:])
+			break
+		}
+
+		if FlagName(token) != "" || len(groups) == 0 {
+			groups = append(groups, []string{token})
+			continue
+		}
+
+		// Value for the preceding flag
+		last := len(groups) - 1
+		groups[last] = append(groups[last], token)
+	}
+	return groups
+}
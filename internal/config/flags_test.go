@@ -0,0 +1,129 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored []string
+		cli    []string
+		want   []string
+	}{
+		{"no flags", nil, nil, []string{}},
+		{"stored only", []string{"--model", "opus"}, nil, []string{"--model", "opus"}},
+		{"cli only", nil, []string{"--continue"}, []string{"--continue"}},
+		{
+			"cli adds to stored",
+			[]string{"--model", "opus"},
+			[]string{"--continue"},
+			[]string{"--model", "opus", "--continue"},
+		},
+		{
+			"cli overrides stored value",
+			[]string{"--model", "opus", "--verbose"},
+			[]string{"--model", "sonnet"},
+			[]string{"--verbose", "--model", "sonnet"},
+		},
+		{
+			"cli equals form overrides stored",
+			[]string{"--model", "opus"},
+			[]string{"--model=sonnet"},
+			[]string{"--model=sonnet"},
+		},
+		{
+			"stored equals form overridden",
+			[]string{"--permission-mode=plan", "--verbose"},
+			[]string{"--permission-mode", "default"},
+			[]string{"--verbose", "--permission-mode", "default"},
+		},
+		{
+			"arguments after -- are not flags",
+			[]string{"--verbose"},
+			[]string{"--", "--verbose"},
+			[]string{"--verbose", "--", "--verbose"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeFlags(tt.stored, tt.cli)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeFlags(%v, %v) = %v, want %v", tt.stored, tt.cli, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"--model", "--model"},
+		{"--model=opus", "--model"},
+		{"-p", "-p"},
+		{"opus", ""},
+		{"--", ""},
+		{"-", ""},
+	}
+
+	for _, tt := range tests {
+		if got := FlagName(tt.input); got != tt.want {
+			t.Errorf("FlagName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCustomFlagsLifecycle(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	if err := pm.SetCustomFlags("work", []string{"--model", "opus", "--verbose"}); err != nil {
+		t.Fatalf("SetCustomFlags() failed: %v", err)
+	}
+
+	if err := pm.AddCustomFlags("work", []string{"--model", "sonnet", "--permission-mode", "plan"}); err != nil {
+		t.Fatalf("AddCustomFlags() failed: %v", err)
+	}
+
+	profile, _ := pm.GetProfile("work")
+	want := []string{"--verbose", "--model", "sonnet", "--permission-mode", "plan"}
+	if !reflect.DeepEqual(profile.Metadata.CustomFlags, want) {
+		t.Errorf("CustomFlags = %v, want %v", profile.Metadata.CustomFlags, want)
+	}
+
+	if err := pm.RemoveCustomFlags("work", []string{"--model"}); err != nil {
+		t.Fatalf("RemoveCustomFlags() failed: %v", err)
+	}
+
+	profile, _ = pm.GetProfile("work")
+	want = []string{"--verbose", "--permission-mode", "plan"}
+	if !reflect.DeepEqual(profile.Metadata.CustomFlags, want) {
+		t.Errorf("CustomFlags = %v, want %v", profile.Metadata.CustomFlags, want)
+	}
+
+	if err := pm.ClearCustomFlags("work"); err != nil {
+		t.Fatalf("ClearCustomFlags() failed: %v", err)
+	}
+
+	profile, _ = pm.GetProfile("work")
+	if len(profile.Metadata.CustomFlags) != 0 {
+		t.Errorf("CustomFlags = %v, want empty", profile.Metadata.CustomFlags)
+	}
+}
+
+func TestCustomFlags_NonExistentProfile(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := pm.SetCustomFlags("missing", []string{"--verbose"}); err == nil {
+		t.Error("SetCustomFlags() should fail for a non-existent profile")
+	}
+}
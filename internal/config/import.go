@@ -0,0 +1,492 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportStagingPrefix starts the name of the directory an import is
+// assembled in, inside the profiles directory
+const ImportStagingPrefix = ".import-"
+
+// ImportOptions controls ImportProfileWithOptions. The embedded CloneOptions
+// select which components are imported, as for clone.
+type ImportOptions struct {
+	CloneOptions
+	Description string
+	// Yes imports without asking for confirmation. An existing profile is
+	// then only replaced with Overwrite, and the source is only removed with Move.
+	Yes bool
+	// Overwrite replaces an existing profile with the same name
+	Overwrite bool
+	// Move removes the source directory after a successful import
+	Move bool
+	// ExternalConfig is a .claude.json kept outside the source directory, as
+	// in Claude's default layout. It takes precedence over one inside the source.
+	ExternalConfig string
+	// SetCurrent makes the imported profile the current one
+	SetCurrent bool
+}
+
+// DefaultClaudeDir returns the directory Claude uses without cdp (~/.claude)
+func DefaultClaudeDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".claude"), nil
+}
+
+// DefaultClaudeConfigPath returns the account file Claude uses without cdp
+// (~/.claude.json), which lives next to ~/.claude rather than inside it
+func DefaultClaudeConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ClaudeConfigFile), nil
+}
+
+// DefaultImportOptions returns import options for Claude's default layout:
+// ~/.claude plus ~/.claude.json if it exists. Returns the source directory.
+func DefaultImportOptions(opts ImportOptions) (string, ImportOptions, error) {
+	sourceDir, err := DefaultClaudeDir()
+	if err != nil {
+		return "", opts, err
+	}
+	configPath, err := DefaultClaudeConfigPath()
+	if err != nil {
+		return "", opts, err
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		opts.ExternalConfig = configPath
+	}
+	return sourceDir, opts, nil
+}
+
+// ImportEntry is a top-level file or directory in the import source
+type ImportEntry struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+	// Files is the number of files below a directory
+	Files int `json:"files,omitempty"`
+	// From is set when the entry is copied from outside the source directory
+	From string `json:"from,omitempty"`
+}
+
+// ImportPlan describes what an import will do
+type ImportPlan struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Profile     string `json:"profile"`
+	Description string `json:"description,omitempty"`
+	// ExternalConfig is the .claude.json imported from outside the source
+	ExternalConfig string `json:"externalConfig,omitempty"`
+	// Entries are the top-level files and directories that will be copied
+	Entries []ImportEntry `json:"entries"`
+	// Skipped are the top-level entries left out by the component selection
+	Skipped []string `json:"skipped,omitempty"`
+	// Placeholders are required Claude files that will be created empty
+	Placeholders []string `json:"placeholders,omitempty"`
+	// FileCount is the total number of files that will be copied
+	FileCount int `json:"fileCount"`
+	// HasClaudeConfig is false when the source has no .claude.json and is
+	// probably not a Claude configuration directory
+	HasClaudeConfig bool `json:"hasClaudeConfig"`
+	// ReplacesMetadata is true when the source has its own cdp metadata,
+	// whose template and custom flags are kept
+	ReplacesMetadata bool `json:"replacesMetadata,omitempty"`
+	// Exists is true when a profile with the same name already exists
+	Exists bool `json:"exists"`
+}
+
+// ImportProfile interactively imports an existing Claude configuration into a new profile
+func (pm *ProfileManager) ImportProfile(sourcePath, name, description string) error {
+	return pm.ImportProfileWithOptions(sourcePath, name, ImportOptions{Description: description})
+}
+
+// PlanImport checks an import and describes what it would do, without
+// changing anything
+func (pm *ProfileManager) PlanImport(sourcePath, name string, opts ImportOptions) (*ImportPlan, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid profile name: %w", err)
+	}
+
+	include, err := opts.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	absSourcePath, err := filepath.Abs(expandHome(sourcePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+
+	// Validate source exists and is a directory
+	sourceInfo, err := os.Stat(absSourcePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("source path '%s' does not exist", sourcePath)
+		}
+		return nil, fmt.Errorf("failed to access source path: %w", err)
+	}
+	if !sourceInfo.IsDir() {
+		return nil, fmt.Errorf("source path '%s' is not a directory", sourcePath)
+	}
+
+	profilesDir, err := filepath.Abs(pm.config.ProfilesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve profiles directory: %w", err)
+	}
+	if isWithin(profilesDir, absSourcePath) || isWithin(absSourcePath, profilesDir) {
+		return nil, fmt.Errorf("cannot import '%s': it overlaps the profiles directory %s", sourcePath, profilesDir)
+	}
+
+	destPath := filepath.Join(pm.config.ProfilesDir, name)
+	plan := &ImportPlan{
+		Source:      absSourcePath,
+		Destination: destPath,
+		Profile:     name,
+		Description: opts.Description,
+	}
+	if _, err := os.Stat(destPath); err == nil {
+		plan.Exists = true
+	}
+
+	entries, err := os.ReadDir(absSourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source directory: %w", err)
+	}
+
+	external := false
+	if opts.ExternalConfig != "" && include(ClaudeConfigFile) {
+		info, err := os.Stat(opts.ExternalConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access %s: %w", opts.ExternalConfig, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a file", opts.ExternalConfig)
+		}
+		external = true
+		plan.ExternalConfig = opts.ExternalConfig
+		plan.HasClaudeConfig = true
+		plan.Entries = append(plan.Entries, ImportEntry{Path: ClaudeConfigFile, From: opts.ExternalConfig})
+		plan.FileCount++
+	}
+
+	for _, entry := range entries {
+		switch entry.Name() {
+		case MetadataFileName:
+			plan.ReplacesMetadata = true
+			continue
+		case ClaudeConfigFile:
+			if external {
+				// Replaced by the external file
+				continue
+			}
+			plan.HasClaudeConfig = include(entry.Name())
+		}
+
+		if !include(entry.Name()) {
+			plan.Skipped = append(plan.Skipped, entry.Name())
+			continue
+		}
+
+		importEntry := ImportEntry{Path: entry.Name(), Dir: entry.IsDir()}
+		if entry.IsDir() {
+			importEntry.Files, err = countFiles(filepath.Join(absSourcePath, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+			}
+			plan.FileCount += importEntry.Files
+		} else {
+			plan.FileCount++
+		}
+		plan.Entries = append(plan.Entries, importEntry)
+	}
+
+	for _, file := range []string{ClaudeConfigFile, ClaudeSettingsFile} {
+		if file == ClaudeConfigFile && external {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(absSourcePath, file)); err != nil || !include(file) {
+			plan.Placeholders = append(plan.Placeholders, file)
+		}
+	}
+
+	return plan, nil
+}
+
+// ImportProfileWithOptions imports an existing Claude configuration,
+// including its subdirectories, into a new profile. It prints a preview and,
+// unless opts.Yes is set, asks for confirmation on stdin.
+func (pm *ProfileManager) ImportProfileWithOptions(sourcePath, name string, opts ImportOptions) error {
+	if err := ValidateName(name); err != nil {
+		return fmt.Errorf("invalid profile name: %w", err)
+	}
+
+	// The source would lose whatever was left out of the import
+	partial := len(opts.Only) > 0 || opts.ExcludeHistory || opts.NoCredentials
+	if opts.Move && partial {
+		return fmt.Errorf("cannot move the source when importing only some components")
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	plan, err := pm.PlanImport(sourcePath, name, opts)
+	if err != nil {
+		return err
+	}
+
+	PrintImportPlan(plan)
+
+	if plan.Exists {
+		fmt.Printf("\n⚠ Profile '%s' already exists!\n", name)
+		switch {
+		case opts.Overwrite:
+		case opts.Yes:
+			return fmt.Errorf("profile '%s' already exists (use --overwrite to replace it)", name)
+		case !promptYesNo("Overwrite existing profile?", false):
+			return fmt.Errorf("import cancelled by user")
+		}
+	}
+
+	if !opts.Yes && !promptYesNo("\nProceed with import?", true) {
+		return fmt.Errorf("import cancelled by user")
+	}
+
+	fmt.Println("\nImporting files...")
+	if err := pm.importInto(plan, opts); err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ Copied %d file(s)\n", plan.FileCount)
+	for _, file := range plan.Placeholders {
+		fmt.Printf("  + Created empty %s\n", file)
+	}
+	fmt.Printf("  ✓ Created %s\n", MetadataFileName)
+
+	move, setCurrent := opts.Move, opts.SetCurrent
+	if !move && !opts.Yes && !partial {
+		if plan.ExternalConfig != "" {
+			// Converting the default install leaves cdp as the only way to run Claude
+			fmt.Printf("\nℹ The default Claude install is still in: %s and %s\n", plan.Source, plan.ExternalConfig)
+			move = promptYesNo(fmt.Sprintf("Convert it into profile '%s'? This removes the originals and makes '%s' the current profile", name, name), false)
+			setCurrent = setCurrent || move
+		} else {
+			fmt.Printf("\nℹ Original files are still in: %s\n", plan.Source)
+			move = promptYesNo("Remove original files?", false)
+		}
+	}
+	if move {
+		removed := []string{plan.Source}
+		if plan.ExternalConfig != "" {
+			removed = append(removed, plan.ExternalConfig)
+		}
+		for _, path := range removed {
+			if err := os.RemoveAll(path); err != nil {
+				fmt.Printf("⚠ Failed to remove original files: %v\n", err)
+				fmt.Println("You can manually delete them later")
+			} else {
+				fmt.Printf("  ✓ Removed original files from %s\n", path)
+			}
+		}
+	}
+
+	if setCurrent {
+		if err := pm.config.SetCurrentProfile(name); err != nil {
+			return fmt.Errorf("failed to set current profile: %w", err)
+		}
+		fmt.Printf("  ✓ '%s' is now the current profile\n", name)
+	}
+
+	return nil
+}
+
+// importInto copies the source into a staging directory and then moves it in
+// place, so a failed import never leaves a half-copied or half-replaced profile
+func (pm *ProfileManager) importInto(plan *ImportPlan, opts ImportOptions) error {
+	include, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	staging, err := os.MkdirTemp(pm.config.ProfilesDir, ImportStagingPrefix+plan.Profile+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	stagedPath := filepath.Join(staging, plan.Profile)
+	if _, err := copyTree(plan.Source, stagedPath, include); err != nil {
+		return err
+	}
+
+	if plan.ExternalConfig != "" {
+		info, err := os.Stat(plan.ExternalConfig)
+		if err != nil {
+			return fmt.Errorf("failed to access %s: %w", plan.ExternalConfig, err)
+		}
+		target := filepath.Join(stagedPath, ClaudeConfigFile)
+		os.Remove(target)
+		if err := copyFile(plan.ExternalConfig, target, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", plan.ExternalConfig, err)
+		}
+	}
+
+	for _, file := range plan.Placeholders {
+		if err := os.WriteFile(filepath.Join(stagedPath, file), []byte("{}"), 0644); err != nil {
+			return fmt.Errorf("failed to create %s: %w", file, err)
+		}
+	}
+
+	metadata := ProfileMetadata{
+		CreatedAt:   time.Now(),
+		Description: plan.Description,
+		UsageCount:  0,
+		Template:    "", // No template for imported profiles
+	}
+
+	// Preserve template/customFlags if metadata was imported
+	if plan.ReplacesMetadata {
+		importedMetadata, err := pm.loadMetadata(plan.Source)
+		if err == nil {
+			metadata.Template = importedMetadata.Template
+			metadata.CustomFlags = importedMetadata.CustomFlags
+		}
+	}
+
+	if err := pm.saveMetadata(stagedPath, metadata); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	if _, err := os.Stat(plan.Destination); err == nil {
+		if err := pm.config.BackupBefore(plan.Profile, BackupBeforeImport, fmt.Sprintf("replaced by import from %s", plan.Source)); err != nil {
+			return err
+		}
+	}
+
+	return InstallStaged(stagedPath, plan.Destination)
+}
+
+// InstallStaged moves a profile prepared in a staging directory to its
+// destination. An existing profile is only removed once the new one is in place.
+func InstallStaged(stagedPath, destPath string) error {
+	if _, err := os.Stat(destPath); err != nil {
+		if err := os.Rename(stagedPath, destPath); err != nil {
+			return fmt.Errorf("failed to create profile: %w", err)
+		}
+		return nil
+	}
+
+	oldPath := stagedPath + ".old"
+	if err := os.Rename(destPath, oldPath); err != nil {
+		return fmt.Errorf("failed to replace existing profile: %w", err)
+	}
+	if err := os.Rename(stagedPath, destPath); err != nil {
+		os.Rename(oldPath, destPath)
+		return fmt.Errorf("failed to replace existing profile: %w", err)
+	}
+	return os.RemoveAll(oldPath)
+}
+
+// PrintImportPlan prints the import preview
+func PrintImportPlan(plan *ImportPlan) {
+	fmt.Println()
+	fmt.Println("ℹ Import Preview")
+	fmt.Println(strings.Repeat("─", 60))
+	fmt.Printf("Source:      %s\n", plan.Source)
+	fmt.Printf("Destination: %s\n", plan.Destination)
+	fmt.Printf("Profile:     %s\n", plan.Profile)
+	if plan.Description != "" {
+		fmt.Printf("Description: %s\n", plan.Description)
+	}
+	fmt.Println(strings.Repeat("─", 60))
+
+	fmt.Println()
+	fmt.Println("Files to import:")
+	for _, entry := range plan.Entries {
+		switch {
+		case entry.From != "":
+			fmt.Printf("  ✓ %s (OAuth credentials, from %s)\n", entry.Path, entry.From)
+		case entry.Dir:
+			fmt.Printf("  ✓ %s/ (%d files)\n", entry.Path, entry.Files)
+		case entry.Path == ClaudeConfigFile:
+			fmt.Printf("  ✓ %s (OAuth credentials)\n", entry.Path)
+		case entry.Path == ClaudeSettingsFile:
+			fmt.Printf("  ✓ %s (Claude settings)\n", entry.Path)
+		default:
+			fmt.Printf("  ✓ %s\n", entry.Path)
+		}
+	}
+	for _, file := range plan.Placeholders {
+		fmt.Printf("  ✗ %s (will create empty placeholder)\n", file)
+	}
+	if plan.ReplacesMetadata {
+		fmt.Printf("  ~ %s (will overwrite with new CDP metadata)\n", MetadataFileName)
+	}
+
+	if len(plan.Skipped) > 0 {
+		fmt.Printf("\nNot selected: %s\n", strings.Join(plan.Skipped, ", "))
+	}
+
+	fmt.Printf("\nTotal files to copy: %d\n", plan.FileCount)
+
+	// Warn if no Claude config found
+	if !plan.HasClaudeConfig {
+		fmt.Println("\n⚠ Warning: No .claude.json found - this may not be a valid Claude configuration directory")
+	}
+}
+
+// countFiles counts the files and symlinks below a directory
+func countFiles(dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// promptYesNo prompts the user for a yes/no response
+func promptYesNo(question string, defaultYes bool) bool {
+	defaultChoice := "y/N"
+	if defaultYes {
+		defaultChoice = "Y/n"
+	}
+
+	fmt.Printf("%s [%s]: ", question, defaultChoice)
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+
+	if input == "" {
+		return defaultYes
+	}
+
+	return input == "y" || input == "yes"
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupImportSource creates a Claude config directory to import from
+func setupImportSource(t *testing.T) string {
+	t.Helper()
+	sourceDir := filepath.Join(t.TempDir(), ".claude")
+	files := map[string]string{
+		ClaudeConfigFile:         `{"token":"test123"}`,
+		ClaudeSettingsFile:       `{"model":"opus"}`,
+		ClaudeCredentialsFile:    `{"token":"secret"}`,
+		"commands/review.md":     "Review the diff",
+		"agents/tester.md":       "You test things",
+		"projects/app/chat.json": "{}",
+	}
+	for rel, content := range files {
+		path := filepath.Join(sourceDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", rel, err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(sourceDir, ClaudeCredentialsFile), 0600); err != nil {
+		t.Fatalf("failed to chmod credentials: %v", err)
+	}
+	return sourceDir
+}
+
+func TestImportProfileWithOptions_Recursive(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourceDir := setupImportSource(t)
+
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", ImportOptions{Description: "Work", Yes: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+
+	profile, err := pm.GetProfile("work")
+	if err != nil {
+		t.Fatalf("GetProfile() failed: %v", err)
+	}
+	if profile.Metadata.Description != "Work" {
+		t.Errorf("Description = %q, want %q", profile.Metadata.Description, "Work")
+	}
+
+	for _, rel := range []string{"commands/review.md", "agents/tester.md", "projects/app/chat.json"} {
+		if _, err := os.Stat(filepath.Join(profile.Path, rel)); err != nil {
+			t.Errorf("%s was not imported", rel)
+		}
+	}
+	info, err := os.Stat(filepath.Join(profile.Path, ClaudeCredentialsFile))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("credentials were not imported with mode 0600: %v, %v", info, err)
+	}
+
+	// The source is kept without --move
+	if _, err := os.Stat(sourceDir); err != nil {
+		t.Error("source should be kept without Move")
+	}
+
+	// No staging directory is left behind
+	entries, _ := os.ReadDir(pm.config.ProfilesDir)
+	if len(entries) != 1 {
+		t.Errorf("profiles directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestImportProfileWithOptions_PreservesImportedMetadata(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourceDir := setupImportSource(t)
+	if err := pm.saveMetadata(sourceDir, ProfileMetadata{Template: "restrictive", CustomFlags: []string{"--verbose"}, UsageCount: 9}); err != nil {
+		t.Fatalf("saveMetadata() failed: %v", err)
+	}
+
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", ImportOptions{Yes: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+
+	profile, err := pm.GetProfile("work")
+	if err != nil {
+		t.Fatalf("GetProfile() failed: %v", err)
+	}
+	if profile.Metadata.Template != "restrictive" || !reflect.DeepEqual(profile.Metadata.CustomFlags, []string{"--verbose"}) {
+		t.Errorf("template and custom flags were not preserved: %+v", profile.Metadata)
+	}
+	if profile.Metadata.UsageCount != 0 {
+		t.Errorf("UsageCount = %d, want 0", profile.Metadata.UsageCount)
+	}
+}
+
+func TestImportProfileWithOptions_Existing(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourceDir := setupImportSource(t)
+	if err := pm.CreateProfile("work", "Old"); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", ImportOptions{Yes: true}); err == nil {
+		t.Fatal("ImportProfileWithOptions() should not replace a profile without Overwrite")
+	}
+	profile, _ := pm.GetProfile("work")
+	if profile.Metadata.Description != "Old" {
+		t.Error("existing profile was changed")
+	}
+
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", ImportOptions{Description: "New", Yes: true, Overwrite: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() with Overwrite failed: %v", err)
+	}
+	profile, _ = pm.GetProfile("work")
+	if profile.Metadata.Description != "New" {
+		t.Errorf("Description = %q, want %q", profile.Metadata.Description, "New")
+	}
+	if _, err := os.Stat(filepath.Join(profile.Path, "commands", "review.md")); err != nil {
+		t.Error("overwritten profile is missing imported files")
+	}
+}
+
+func TestImportProfileWithOptions_Move(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourceDir := setupImportSource(t)
+
+	partial := ImportOptions{CloneOptions: CloneOptions{ExcludeHistory: true}, Yes: true, Move: true}
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", partial); err == nil {
+		t.Error("Move should be rejected when only some components are imported")
+	}
+
+	if err := pm.ImportProfileWithOptions(sourceDir, "work", ImportOptions{Yes: true, Move: true}); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+	if _, err := os.Stat(sourceDir); !os.IsNotExist(err) {
+		t.Error("source should be removed with Move")
+	}
+	if !pm.ProfileExists("work") {
+		t.Error("profile was not imported")
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	sourceDir := setupImportSource(t)
+
+	opts := ImportOptions{CloneOptions: CloneOptions{Only: []string{"settings", "commands"}}}
+	plan, err := pm.PlanImport(sourceDir, "work", opts)
+	if err != nil {
+		t.Fatalf("PlanImport() failed: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range plan.Entries {
+		paths = append(paths, entry.Path)
+	}
+	if want := []string{"commands", ClaudeSettingsFile}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("entries = %v, want %v", paths, want)
+	}
+	if want := []string{ClaudeConfigFile, ClaudeCredentialsFile, "agents", "projects"}; !reflect.DeepEqual(plan.Skipped, want) {
+		t.Errorf("skipped = %v, want %v", plan.Skipped, want)
+	}
+	if want := []string{ClaudeConfigFile}; !reflect.DeepEqual(plan.Placeholders, want) {
+		t.Errorf("placeholders = %v, want %v", plan.Placeholders, want)
+	}
+	if plan.FileCount != 2 {
+		t.Errorf("FileCount = %d, want 2", plan.FileCount)
+	}
+
+	// Planning changes nothing
+	if pm.ProfileExists("work") {
+		t.Error("PlanImport() created the profile")
+	}
+}
+
+func TestPlanImport_RejectsProfilesDir(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	for _, source := range []string{pm.config.ProfilesDir, filepath.Join(pm.config.ProfilesDir, "work"), filepath.Dir(pm.config.ProfilesDir)} {
+		if _, err := pm.PlanImport(source, "copy", ImportOptions{}); err == nil {
+			t.Errorf("PlanImport(%s) should be rejected", source)
+		}
+	}
+}
+
+func TestImportProfileWithOptions_DefaultLayout(t *testing.T) {
+	cfg, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	claudeDir, _ := DefaultClaudeDir()
+	configPath, _ := DefaultClaudeConfigPath()
+	if err := os.MkdirAll(filepath.Join(claudeDir, "agents"), 0755); err != nil {
+		t.Fatalf("failed to create ~/.claude: %v", err)
+	}
+	os.WriteFile(filepath.Join(claudeDir, ClaudeSettingsFile), []byte(`{"model":"opus"}`), 0644)
+	os.WriteFile(filepath.Join(claudeDir, "agents", "tester.md"), []byte("You test things"), 0644)
+	if err := os.WriteFile(configPath, []byte(`{"oauthAccount":{"emailAddress":"me@example.com"}}`), 0600); err != nil {
+		t.Fatalf("failed to write ~/.claude.json: %v", err)
+	}
+
+	source, opts, err := DefaultImportOptions(ImportOptions{Yes: true})
+	if err != nil {
+		t.Fatalf("DefaultImportOptions() failed: %v", err)
+	}
+	if source != claudeDir || opts.ExternalConfig != configPath {
+		t.Fatalf("DefaultImportOptions() = %s, %s", source, opts.ExternalConfig)
+	}
+
+	plan, err := pm.PlanImport(source, "personal", opts)
+	if err != nil {
+		t.Fatalf("PlanImport() failed: %v", err)
+	}
+	if !plan.HasClaudeConfig || len(plan.Placeholders) != 0 {
+		t.Errorf("plan should use ~/.claude.json: %+v", plan)
+	}
+
+	opts.Move = true
+	opts.SetCurrent = true
+	if err := pm.ImportProfileWithOptions(source, "personal", opts); err != nil {
+		t.Fatalf("ImportProfileWithOptions() failed: %v", err)
+	}
+
+	profilePath := filepath.Join(pm.config.ProfilesDir, "personal")
+	data, err := os.ReadFile(filepath.Join(profilePath, ClaudeConfigFile))
+	if err != nil || string(data) != `{"oauthAccount":{"emailAddress":"me@example.com"}}` {
+		t.Errorf(".claude.json = %s, %v; want the content of ~/.claude.json", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(profilePath, ClaudeConfigFile)); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf(".claude.json mode = %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(profilePath, "agents", "tester.md")); err != nil {
+		t.Error("agents were not imported")
+	}
+
+	for _, path := range []string{claudeDir, configPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed after converting", path)
+		}
+	}
+
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if reloaded.CurrentProfile != "personal" || cfg.CurrentProfile != "personal" {
+		t.Errorf("CurrentProfile = %q, want %q", reloaded.CurrentProfile, "personal")
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tiagokriok/cdp/pkg/filelock"
+)
+
+const (
+	// ConfigLockFileName guards config.yaml
+	ConfigLockFileName = "lock"
+	// ProfileLocksDirName holds one lock file per profile
+	ProfileLocksDirName = "locks"
+)
+
+// LockTimeout is how long cdp waits for another cdp process to release a lock
+var LockTimeout = 10 * time.Second
+
+// BusyError is returned when a lock is held by another cdp process for
+// longer than LockTimeout
+type BusyError struct {
+	// Resource describes what is locked, e.g. "profile 'work'"
+	Resource string
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s is busy: another cdp process is using it (waited %s)", e.Resource, LockTimeout)
+}
+
+// LockConfig takes the lock guarding config.yaml and returns a function that
+// releases it. When profile locks are also needed, take them first.
+func LockConfig() (func(), error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return acquire(filepath.Join(configDir, ConfigLockFileName), "cdp configuration")
+}
+
+// LockProfile takes the locks of one or more profiles and returns a function
+// that releases them. Every mutating profile operation holds its profile's
+// lock, so concurrent cdp processes do not overwrite each other's changes.
+func LockProfile(names ...string) (func(), error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// A fixed order prevents deadlocks between processes locking the same profiles
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	var releases []func()
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, name := range sorted {
+		if err := ValidateName(name); err != nil {
+			releaseAll()
+			return nil, fmt.Errorf("invalid profile name: %w", err)
+		}
+
+		release, err := acquire(filepath.Join(configDir, ProfileLocksDirName, name+".lock"), fmt.Sprintf("profile '%s'", name))
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	return releaseAll, nil
+}
+
+func acquire(path, resource string) (func(), error) {
+	lock, err := filelock.Acquire(path, LockTimeout)
+	if err != nil {
+		if errors.Is(err, filelock.ErrTimeout) {
+			return nil, &BusyError{Resource: resource}
+		}
+		return nil, err
+	}
+
+	return func() { lock.Release() }, nil
+}
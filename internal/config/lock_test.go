@@ -0,0 +1,127 @@
+//go:build unix
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// holdLockFile locks path through its own file descriptor, the way another
+// cdp process would, bypassing the in-process reentrancy of filelock
+func holdLockFile(t *testing.T, path string) func() {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create lock directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("failed to open lock file: %v", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("failed to lock %s: %v", path, err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+}
+
+func setShortLockTimeout(t *testing.T) {
+	original := LockTimeout
+	LockTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { LockTimeout = original })
+}
+
+func TestLockProfile_Busy(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setShortLockTimeout(t)
+
+	if err := pm.CreateProfile("work", ""); err != nil {
+		t.Fatalf("CreateProfile() failed: %v", err)
+	}
+
+	configDir, _ := GetConfigDir()
+	release := holdLockFile(t, filepath.Join(configDir, ProfileLocksDirName, "work.lock"))
+
+	err := pm.UpdateLastUsed("work")
+	var busy *BusyError
+	if !errors.As(err, &busy) {
+		t.Fatalf("UpdateLastUsed() error = %v, want BusyError", err)
+	}
+	if busy.Resource != "profile 'work'" {
+		t.Errorf("Resource = %q, want %q", busy.Resource, "profile 'work'")
+	}
+
+	// Other profiles are not affected
+	if err := pm.CreateProfile("personal", ""); err != nil {
+		t.Errorf("CreateProfile() of another profile failed: %v", err)
+	}
+
+	release()
+	if err := pm.UpdateLastUsed("work"); err != nil {
+		t.Errorf("UpdateLastUsed() after release failed: %v", err)
+	}
+}
+
+func TestLockProfile_InvalidName(t *testing.T) {
+	_, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if _, err := LockProfile("../escape"); err == nil {
+		t.Error("LockProfile() should reject invalid profile names")
+	}
+}
+
+func TestLockConfig_Busy(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+	setShortLockTimeout(t)
+
+	configDir, _ := GetConfigDir()
+	release := holdLockFile(t, filepath.Join(configDir, ConfigLockFileName))
+	defer release()
+
+	var busy *BusyError
+	if err := cfg.Save(); !errors.As(err, &busy) {
+		t.Errorf("Save() error = %v, want BusyError", err)
+	}
+}
+
+func TestConfigUpdate_KeepsOtherChanges(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// Another process changes the config after cfg was loaded
+	other, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	other.DirectoryProfiles = append(other.DirectoryProfiles, DirectoryBinding{Path: "~/work/**", Profile: "work"})
+	if err := other.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if err := cfg.SetCurrentProfile("work"); err != nil {
+		t.Fatalf("SetCurrentProfile() failed: %v", err)
+	}
+
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if reloaded.CurrentProfile != "work" {
+		t.Errorf("CurrentProfile = %q, want %q", reloaded.CurrentProfile, "work")
+	}
+	if len(reloaded.DirectoryProfiles) != 1 {
+		t.Error("SetCurrentProfile() overwrote a change made by another process")
+	}
+	if len(cfg.DirectoryProfiles) != 1 {
+		t.Error("cfg was not refreshed with the latest config")
+	}
+}
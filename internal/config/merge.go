@@ -0,0 +1,286 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ArrayStrategy controls how arrays are combined when merging settings
+type ArrayStrategy string
+
+const (
+	// ArrayUnion keeps existing items and appends new ones that are not present
+	ArrayUnion ArrayStrategy = "union"
+	// ArrayReplace replaces the existing array
+	ArrayReplace ArrayStrategy = "replace"
+	// ArrayPrepend puts new items first, followed by existing items not present
+	ArrayPrepend ArrayStrategy = "prepend"
+)
+
+// DefaultArrayStrategy is used when no strategy is configured for a path
+const DefaultArrayStrategy = ArrayUnion
+
+// ParseArrayStrategy validates an array strategy name
+func ParseArrayStrategy(s string) (ArrayStrategy, error) {
+	switch ArrayStrategy(s) {
+	case ArrayUnion, ArrayReplace, ArrayPrepend:
+		return ArrayStrategy(s), nil
+	}
+	return "", fmt.Errorf("invalid array merge strategy '%s' (use union, replace or prepend)", s)
+}
+
+// ArrayStrategies maps dotted settings paths (e.g. "permissions.allow") to
+// array strategies. The "*" key sets the default for all other paths.
+type ArrayStrategies map[string]ArrayStrategy
+
+// For returns the strategy for a dotted settings path
+func (s ArrayStrategies) For(path string) ArrayStrategy {
+	if strategy, ok := s[path]; ok {
+		return strategy
+	}
+	if strategy, ok := s["*"]; ok {
+		return strategy
+	}
+	return DefaultArrayStrategy
+}
+
+// DeepMerge merges src into dst and returns the result without modifying either.
+// Objects are merged recursively, arrays are combined according to strategies
+// and any other value in src replaces the one in dst.
+func DeepMerge(dst, src map[string]interface{}, strategies ArrayStrategies) map[string]interface{} {
+	return mergeObjects(dst, src, strategies, "")
+}
+
+func mergeObjects(dst, src map[string]interface{}, strategies ArrayStrategies, prefix string) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst)+len(src))
+	for key, value := range dst {
+		result[key] = deepCopy(value)
+	}
+
+	for key, srcValue := range src {
+		path := joinPath(prefix, key)
+		dstValue, exists := result[key]
+		if !exists {
+			result[key] = deepCopy(srcValue)
+			continue
+		}
+
+		switch s := srcValue.(type) {
+		case map[string]interface{}:
+			if d, ok := dstValue.(map[string]interface{}); ok {
+				result[key] = mergeObjects(d, s, strategies, path)
+				continue
+			}
+		case []interface{}:
+			if d, ok := dstValue.([]interface{}); ok {
+				result[key] = mergeArrays(d, s, strategies.For(path))
+				continue
+			}
+		}
+
+		result[key] = deepCopy(srcValue)
+	}
+
+	return result
+}
+
+func mergeArrays(dst, src []interface{}, strategy ArrayStrategy) []interface{} {
+	switch strategy {
+	case ArrayReplace:
+		return deepCopy(src).([]interface{})
+	case ArrayPrepend:
+		result := deepCopy(src).([]interface{})
+		for _, item := range dst {
+			if !containsValue(result, item) {
+				result = append(result, deepCopy(item))
+			}
+		}
+		return result
+	default:
+		result := deepCopy(dst).([]interface{})
+		for _, item := range src {
+			if !containsValue(result, item) {
+				result = append(result, deepCopy(item))
+			}
+		}
+		return result
+	}
+}
+
+// ThreeWayMerge applies the changes between two versions of a template
+// (base -> next) to local settings while keeping local edits. Where both
+// sides changed the same value differently, the local value is kept and the
+// path is reported as a conflict.
+func ThreeWayMerge(base, local, next map[string]interface{}, strategies ArrayStrategies) (map[string]interface{}, []string) {
+	var conflicts []string
+	merged := mergeThreeWay(base, local, next, strategies, "", &conflicts)
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+func mergeThreeWay(base, local, next map[string]interface{}, strategies ArrayStrategies, prefix string, conflicts *[]string) map[string]interface{} {
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{base, local, next} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	result := make(map[string]interface{})
+	for key := range keys {
+		path := joinPath(prefix, key)
+		b, hasBase := base[key]
+		l, hasLocal := local[key]
+		n, hasNext := next[key]
+
+		switch {
+		case sameValue(l, hasLocal, b, hasBase):
+			// Not edited locally: take the template's version
+			if hasNext {
+				result[key] = deepCopy(n)
+			}
+		case sameValue(n, hasNext, b, hasBase), sameValue(l, hasLocal, n, hasNext):
+			// Template unchanged, or both made the same change
+			if hasLocal {
+				result[key] = deepCopy(l)
+			}
+		default:
+			lm, localIsMap := l.(map[string]interface{})
+			nm, nextIsMap := n.(map[string]interface{})
+			la, localIsArray := l.([]interface{})
+			na, nextIsArray := n.([]interface{})
+
+			switch {
+			case localIsMap && nextIsMap:
+				bm, _ := b.(map[string]interface{})
+				result[key] = mergeThreeWay(bm, lm, nm, strategies, path, conflicts)
+			case localIsArray && nextIsArray:
+				ba, _ := b.([]interface{})
+				result[key] = mergeArraysThreeWay(ba, la, na, strategies.For(path))
+			default:
+				*conflicts = append(*conflicts, path)
+				if hasLocal {
+					result[key] = deepCopy(l)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// mergeArraysThreeWay keeps the local array, drops items the template removed
+// and adds items the template added
+func mergeArraysThreeWay(base, local, next []interface{}, strategy ArrayStrategy) []interface{} {
+	var result []interface{}
+	for _, item := range local {
+		if containsValue(base, item) && !containsValue(next, item) {
+			continue
+		}
+		result = append(result, deepCopy(item))
+	}
+
+	added := []interface{}{}
+	for _, item := range next {
+		if !containsValue(base, item) && !containsValue(result, item) {
+			added = append(added, deepCopy(item))
+		}
+	}
+
+	if strategy == ArrayPrepend {
+		return append(added, result...)
+	}
+	return append(append([]interface{}{}, result...), added...)
+}
+
+func sameValue(a interface{}, hasA bool, b interface{}, hasB bool) bool {
+	if hasA != hasB {
+		return false
+	}
+	return !hasA || reflect.DeepEqual(a, b)
+}
+
+// SettingsChange describes a single difference between two settings documents
+type SettingsChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+	// Kind is "added", "removed" or "changed"
+	Kind string
+}
+
+// DiffSettings returns the leaf-level differences between two settings documents,
+// sorted by path. Arrays are compared as whole values.
+func DiffSettings(before, after map[string]interface{}) []SettingsChange {
+	var changes []SettingsChange
+	diffObjects(before, after, "", &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffObjects(before, after map[string]interface{}, prefix string, changes *[]SettingsChange) {
+	for key, oldValue := range before {
+		path := joinPath(prefix, key)
+		newValue, exists := after[key]
+		if !exists {
+			*changes = append(*changes, SettingsChange{Path: path, Old: oldValue, Kind: "removed"})
+			continue
+		}
+
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			diffObjects(oldMap, newMap, path, changes)
+			continue
+		}
+
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, SettingsChange{Path: path, Old: oldValue, New: newValue, Kind: "changed"})
+		}
+	}
+
+	for key, newValue := range after {
+		if _, exists := before[key]; !exists {
+			*changes = append(*changes, SettingsChange{Path: joinPath(prefix, key), New: newValue, Kind: "added"})
+		}
+	}
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// deepCopy copies decoded JSON values so merged results never share state
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = deepCopy(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = deepCopy(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
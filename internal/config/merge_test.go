@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("invalid test JSON %q: %v", s, err)
+	}
+	return m
+}
+
+func TestDeepMerge(t *testing.T) {
+	tests := []struct {
+		name       string
+		dst        string
+		src        string
+		strategies ArrayStrategies
+		want       string
+	}{
+		{
+			name: "nested objects merge",
+			dst:  `{"permissions":{"allow":["Read"]},"model":"opus"}`,
+			src:  `{"permissions":{"deny":["WebFetch"]}}`,
+			want: `{"permissions":{"allow":["Read"],"deny":["WebFetch"]},"model":"opus"}`,
+		},
+		{
+			name: "arrays union by default",
+			dst:  `{"permissions":{"allow":["Read","Edit"]}}`,
+			src:  `{"permissions":{"allow":["Edit","Bash"]}}`,
+			want: `{"permissions":{"allow":["Read","Edit","Bash"]}}`,
+		},
+		{
+			name:       "arrays replace per path",
+			dst:        `{"permissions":{"allow":["Read"],"deny":["Bash"]}}`,
+			src:        `{"permissions":{"allow":["Edit"],"deny":["WebFetch"]}}`,
+			strategies: ArrayStrategies{"permissions.allow": ArrayReplace},
+			want:       `{"permissions":{"allow":["Edit"],"deny":["Bash","WebFetch"]}}`,
+		},
+		{
+			name:       "arrays prepend",
+			dst:        `{"list":["b","c"]}`,
+			src:        `{"list":["a","c"]}`,
+			strategies: ArrayStrategies{"*": ArrayPrepend},
+			want:       `{"list":["a","c","b"]}`,
+		},
+		{
+			name: "scalars and mismatched types are replaced",
+			dst:  `{"model":"opus","env":"oops"}`,
+			src:  `{"model":"sonnet","env":{"A":"1"}}`,
+			want: `{"model":"sonnet","env":{"A":"1"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := decodeJSON(t, tt.dst)
+			src := decodeJSON(t, tt.src)
+			got := DeepMerge(dst, src, tt.strategies)
+			want := decodeJSON(t, tt.want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("DeepMerge() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(dst, decodeJSON(t, tt.dst)) {
+				t.Error("DeepMerge() modified dst")
+			}
+		})
+	}
+}
+
+func TestParseArrayStrategy(t *testing.T) {
+	for _, s := range []string{"union", "replace", "prepend"} {
+		if _, err := ParseArrayStrategy(s); err != nil {
+			t.Errorf("ParseArrayStrategy(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseArrayStrategy("append"); err == nil {
+		t.Error("ParseArrayStrategy(\"append\") should fail")
+	}
+}
+
+func TestDiffSettings(t *testing.T) {
+	before := decodeJSON(t, `{"model":"opus","permissions":{"allow":["Read"],"ask":["Edit"]}}`)
+	after := decodeJSON(t, `{"model":"sonnet","permissions":{"allow":["Read"],"deny":["Bash"]}}`)
+
+	changes := DiffSettings(before, after)
+
+	want := []struct{ path, kind string }{
+		{"model", "changed"},
+		{"permissions.ask", "removed"},
+		{"permissions.deny", "added"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffSettings() returned %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].Path != w.path || changes[i].Kind != w.kind {
+			t.Errorf("change[%d] = %s %s, want %s %s", i, changes[i].Path, changes[i].Kind, w.path, w.kind)
+		}
+	}
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	base := decodeJSON(t, `{"model":"opus","permissions":{"deny":["WebFetch","Bash(curl:*)"],"ask":["Edit"]},"theme":"dark"}`)
+	local := decodeJSON(t, `{"model":"haiku","permissions":{"deny":["WebFetch","Bash(curl:*)","Read(.env)"],"ask":["Edit"]},"theme":"dark","own":true}`)
+	next := decodeJSON(t, `{"model":"sonnet","permissions":{"deny":["WebFetch","Bash(wget:*)"],"ask":["Edit"]},"theme":"light"}`)
+
+	merged, conflicts := ThreeWayMerge(base, local, next, nil)
+
+	want := decodeJSON(t, `{
+		"model":"haiku",
+		"permissions":{"deny":["WebFetch","Read(.env)","Bash(wget:*)"],"ask":["Edit"]},
+		"theme":"light",
+		"own":true
+	}`)
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("ThreeWayMerge() = %v, want %v", merged, want)
+	}
+	if !reflect.DeepEqual(conflicts, []string{"model"}) {
+		t.Errorf("conflicts = %v, want [model]", conflicts)
+	}
+}
+
+func TestThreeWayMerge_TemplateRemovesKey(t *testing.T) {
+	base := decodeJSON(t, `{"a":1,"b":2}`)
+	local := decodeJSON(t, `{"a":1,"b":3}`)
+	next := decodeJSON(t, `{}`)
+
+	merged, conflicts := ThreeWayMerge(base, local, next, nil)
+
+	// "a" was untouched locally so the removal applies; "b" was edited so it is kept
+	want := decodeJSON(t, `{"b":3}`)
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("ThreeWayMerge() = %v, want %v", merged, want)
+	}
+	if len(conflicts) != 1 || conflicts[0] != "b" {
+		t.Errorf("conflicts = %v, want [b]", conflicts)
+	}
+}
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,6 +9,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
 )
 
 const (
@@ -30,7 +31,13 @@ type ProfileMetadata struct {
 	Description string    `json:"description,omitempty"`
 	UsageCount  int       `json:"usageCount"`
 	Template    string    `json:"template,omitempty"`
-	CustomFlags []string  `json:"customFlags,omitempty"`
+	// TemplateHash and SettingsHash record the template content and the
+	// resulting settings when the template was last applied
+	TemplateHash string            `json:"templateHash,omitempty"`
+	SettingsHash string            `json:"settingsHash,omitempty"`
+	CustomFlags  []string          `json:"customFlags,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	UnsetEnv     []string          `json:"unsetEnv,omitempty"`
 }
 
 // Profile represents a Claude Code profile
@@ -38,6 +45,14 @@ type Profile struct {
 	Name     string
 	Path     string
 	Metadata ProfileMetadata
+	// LoadErr is set when the profile's metadata could not be loaded.
+	// Metadata is empty for such profiles.
+	LoadErr error
+}
+
+// IsBroken reports whether the profile's metadata could not be loaded
+func (p *Profile) IsBroken() bool {
+	return p.LoadErr != nil
 }
 
 // ProfileManager handles profile operations
@@ -75,6 +90,12 @@ func (pm *ProfileManager) CreateProfileWithTemplate(name, description, template
 		return fmt.Errorf("invalid profile name: %w", err)
 	}
 
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	profilePath := filepath.Join(pm.config.ProfilesDir, name)
 
 	// Check if profile already exists
@@ -124,8 +145,7 @@ func (pm *ProfileManager) CreateProfileWithTemplate(name, description, template
 
 	// Apply template if specified
 	if template != "" {
-		tm := NewTemplateManager()
-		if err := tm.ApplyTemplate(profilePath, template); err != nil {
+		if err := pm.applyTemplate(profilePath, &metadata, template); err != nil {
 			os.RemoveAll(profilePath)
 			return fmt.Errorf("failed to apply template: %w", err)
 		}
@@ -140,6 +160,12 @@ func (pm *ProfileManager) DeleteProfile(name string) error {
 		return fmt.Errorf("invalid profile name: %w", err)
 	}
 
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	profilePath := filepath.Join(pm.config.ProfilesDir, name)
 
 	// Check if profile exists
@@ -152,6 +178,10 @@ func (pm *ProfileManager) DeleteProfile(name string) error {
 		return fmt.Errorf("cannot delete the current profile '%s', switch to another profile first", name)
 	}
 
+	if err := pm.config.BackupBefore(name, BackupBeforeDelete, ""); err != nil {
+		return err
+	}
+
 	// Remove the profile directory
 	if err := os.RemoveAll(profilePath); err != nil {
 		return fmt.Errorf("failed to delete profile: %w", err)
@@ -160,7 +190,8 @@ func (pm *ProfileManager) DeleteProfile(name string) error {
 	return nil
 }
 
-// ListProfiles lists all profiles
+// ListProfiles lists all profiles, including broken ones whose metadata
+// cannot be loaded (see Profile.LoadErr)
 func (pm *ProfileManager) ListProfiles() ([]Profile, error) {
 	entries, err := os.ReadDir(pm.config.ProfilesDir)
 	if err != nil {
@@ -177,19 +208,20 @@ func (pm *ProfileManager) ListProfiles() ([]Profile, error) {
 		}
 
 		name := entry.Name()
+		// Hidden directories are staging areas of imports in progress
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
 		profilePath := filepath.Join(pm.config.ProfilesDir, name)
 
-		// Load metadata
+		// Profiles with unreadable metadata are listed as broken so they can be repaired
 		metadata, err := pm.loadMetadata(profilePath)
-		if err != nil {
-			// Skip profiles with invalid metadata
-			continue
-		}
 
 		profiles = append(profiles, Profile{
 			Name:     name,
 			Path:     profilePath,
 			Metadata: metadata,
+			LoadErr:  err,
 		})
 	}
 
@@ -226,7 +258,7 @@ func (pm *ProfileManager) GetProfile(name string) (*Profile, error) {
 	// Load metadata
 	metadata, err := pm.loadMetadata(profilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load profile metadata: %w", err)
+		return nil, fmt.Errorf("failed to load profile metadata: %w (run 'cdp repair %s')", err, name)
 	}
 
 	return &Profile{
@@ -238,6 +270,12 @@ func (pm *ProfileManager) GetProfile(name string) (*Profile, error) {
 
 // UpdateLastUsed updates the last used timestamp for a profile
 func (pm *ProfileManager) UpdateLastUsed(name string) error {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	profile, err := pm.GetProfile(name)
 	if err != nil {
 		return err
@@ -293,7 +331,7 @@ func (pm *ProfileManager) saveMetadata(profilePath string, metadata ProfileMetad
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	if err := os.WriteFile(metadataPath, data, 0644); err != nil {
+	if err := atomicfile.WriteFile(metadataPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write metadata file: %w", err)
 	}
 
@@ -309,53 +347,48 @@ func (pm *ProfileManager) ProfileExists(name string) bool {
 
 // CloneProfile clones an existing profile to a new name
 func (pm *ProfileManager) CloneProfile(source, dest string) error {
+	_, err := pm.CloneProfileWithOptions(source, dest, CloneOptions{})
+	return err
+}
+
+// CloneProfileWithOptions copies an existing profile, including its
+// subdirectories, to a new name. File modes and symlinks are preserved.
+// Missing Claude files, such as credentials left out with NoCredentials, are
+// recreated as empty placeholders. NoCredentials also leaves out
+// secret-looking environment variables. Returns the relative paths that were copied.
+func (pm *ProfileManager) CloneProfileWithOptions(source, dest string, opts CloneOptions) ([]string, error) {
 	if err := ValidateName(dest); err != nil {
-		return fmt.Errorf("invalid destination name: %w", err)
+		return nil, fmt.Errorf("invalid destination name: %w", err)
+	}
+
+	include, err := opts.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := LockProfile(source, dest)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
 	// Check source exists
 	sourceProfile, err := pm.GetProfile(source)
 	if err != nil {
-		return fmt.Errorf("source profile '%s' does not exist", source)
+		return nil, fmt.Errorf("source profile '%s' does not exist", source)
 	}
 
 	destPath := filepath.Join(pm.config.ProfilesDir, dest)
 
 	// Check dest doesn't exist
 	if _, err := os.Stat(destPath); err == nil {
-		return fmt.Errorf("profile '%s' already exists", dest)
-	}
-
-	// Create dest directory
-	if err := os.MkdirAll(destPath, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
+		return nil, fmt.Errorf("profile '%s' already exists", dest)
 	}
 
-	// Copy all files from source to dest
-	entries, err := os.ReadDir(sourceProfile.Path)
+	copied, err := copyTree(sourceProfile.Path, destPath, include)
 	if err != nil {
 		os.RemoveAll(destPath)
-		return fmt.Errorf("failed to read source directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue // Skip subdirectories
-		}
-
-		srcFile := filepath.Join(sourceProfile.Path, entry.Name())
-		dstFile := filepath.Join(destPath, entry.Name())
-
-		data, err := os.ReadFile(srcFile)
-		if err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to read file %s: %w", entry.Name(), err)
-		}
-
-		if err := os.WriteFile(dstFile, data, 0644); err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to write file %s: %w", entry.Name(), err)
-		}
+		return nil, err
 	}
 
 	// Update metadata for the cloned profile
@@ -364,13 +397,33 @@ func (pm *ProfileManager) CloneProfile(source, dest string) error {
 	newMetadata.LastUsed = time.Time{} // Reset last used
 	newMetadata.UsageCount = 0         // Reset usage count
 	newMetadata.Description = fmt.Sprintf("Cloned from %s", source)
+	if len(sourceProfile.Metadata.Env) > 0 {
+		newMetadata.Env = make(map[string]string, len(sourceProfile.Metadata.Env))
+		for key, value := range sourceProfile.Metadata.Env {
+			newMetadata.Env[key] = value
+		}
+		if opts.NoCredentials {
+			redactEnv(newMetadata.Env, CredentialsStrip)
+		}
+	}
+
+	// Template drift cannot be tracked without the template base
+	if _, err := os.Stat(filepath.Join(destPath, TemplateBaseFile)); os.IsNotExist(err) {
+		newMetadata.TemplateHash = ""
+		newMetadata.SettingsHash = ""
+	}
 
 	if err := pm.saveMetadata(destPath, newMetadata); err != nil {
 		os.RemoveAll(destPath)
-		return fmt.Errorf("failed to save metadata: %w", err)
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
 	}
 
-	return nil
+	if _, err := pm.RestoreMissingFiles(dest); err != nil {
+		os.RemoveAll(destPath)
+		return nil, err
+	}
+
+	return copied, nil
 }
 
 // RenameProfile renames an existing profile
@@ -379,6 +432,12 @@ func (pm *ProfileManager) RenameProfile(oldName, newName string) error {
 		return fmt.Errorf("invalid new name: %w", err)
 	}
 
+	unlock, err := LockProfile(oldName, newName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Check old exists
 	if !pm.ProfileExists(oldName) {
 		return fmt.Errorf("profile '%s' does not exist", oldName)
@@ -394,6 +453,10 @@ func (pm *ProfileManager) RenameProfile(oldName, newName string) error {
 		return fmt.Errorf("cannot rename the current profile '%s', switch to another profile first", oldName)
 	}
 
+	if err := pm.config.BackupBefore(oldName, BackupBeforeRename, fmt.Sprintf("renamed to '%s'", newName)); err != nil {
+		return err
+	}
+
 	oldPath := filepath.Join(pm.config.ProfilesDir, oldName)
 	newPath := filepath.Join(pm.config.ProfilesDir, newName)
 
@@ -403,262 +466,3 @@ func (pm *ProfileManager) RenameProfile(oldName, newName string) error {
 
 	return nil
 }
-
-// ImportProfile imports an existing Claude configuration into a new profile
-func (pm *ProfileManager) ImportProfile(sourcePath, name, description string) error {
-	// 1. VALIDATE INPUTS
-	if err := ValidateName(name); err != nil {
-		return fmt.Errorf("invalid profile name: %w", err)
-	}
-
-	// Expand ~ in source path
-	if strings.HasPrefix(sourcePath, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get home directory: %w", err)
-		}
-		sourcePath = filepath.Join(home, sourcePath[2:])
-	} else if sourcePath == "~" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get home directory: %w", err)
-		}
-		sourcePath = home
-	}
-
-	// Convert to absolute path
-	absSourcePath, err := filepath.Abs(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to resolve source path: %w", err)
-	}
-
-	// Validate source exists and is a directory
-	sourceInfo, err := os.Stat(absSourcePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("source path '%s' does not exist", sourcePath)
-		}
-		return fmt.Errorf("failed to access source path: %w", err)
-	}
-	if !sourceInfo.IsDir() {
-		return fmt.Errorf("source path '%s' is not a directory", sourcePath)
-	}
-
-	// 2. CHECK DESTINATION
-	destPath := filepath.Join(pm.config.ProfilesDir, name)
-	profileExists := false
-	if _, err := os.Stat(destPath); err == nil {
-		profileExists = true
-	}
-
-	// 3. SCAN SOURCE DIRECTORY (for preview)
-	entries, err := os.ReadDir(absSourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to read source directory: %w", err)
-	}
-
-	// Categorize files
-	var (
-		foundClaudeConfig bool
-		foundSettings     bool
-		foundMetadata     bool
-		otherFiles        []string
-		skippedDirs       []string
-	)
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			skippedDirs = append(skippedDirs, entry.Name())
-			continue
-		}
-
-		switch entry.Name() {
-		case ClaudeConfigFile:
-			foundClaudeConfig = true
-		case ClaudeSettingsFile:
-			foundSettings = true
-		case MetadataFileName:
-			foundMetadata = true
-		default:
-			otherFiles = append(otherFiles, entry.Name())
-		}
-	}
-
-	// 4. INTERACTIVE VALIDATION PREVIEW
-	fmt.Println()
-	fmt.Println("ℹ Import Preview")
-	fmt.Println(strings.Repeat("─", 60))
-	fmt.Printf("Source:      %s\n", absSourcePath)
-	fmt.Printf("Destination: %s\n", destPath)
-	fmt.Printf("Profile:     %s\n", name)
-	if description != "" {
-		fmt.Printf("Description: %s\n", description)
-	}
-	fmt.Println(strings.Repeat("─", 60))
-
-	fmt.Println()
-	fmt.Println("Files to import:")
-	fileCount := 0
-	if foundClaudeConfig {
-		fmt.Printf("  ✓ %s (OAuth credentials)\n", ClaudeConfigFile)
-		fileCount++
-	} else {
-		fmt.Printf("  ✗ %s (will create empty placeholder)\n", ClaudeConfigFile)
-	}
-	if foundSettings {
-		fmt.Printf("  ✓ %s (Claude settings)\n", ClaudeSettingsFile)
-		fileCount++
-	} else {
-		fmt.Printf("  ✗ %s (will create empty placeholder)\n", ClaudeSettingsFile)
-	}
-	if foundMetadata {
-		fmt.Printf("  ~ %s (will overwrite with new CDP metadata)\n", MetadataFileName)
-	}
-	for _, fileName := range otherFiles {
-		fmt.Printf("  ✓ %s\n", fileName)
-		fileCount++
-	}
-
-	if len(skippedDirs) > 0 {
-		fmt.Printf("\nSkipped subdirectories: %s\n", strings.Join(skippedDirs, ", "))
-	}
-
-	fmt.Printf("\nTotal files to copy: %d\n", fileCount)
-
-	// Warn if no Claude config found
-	if !foundClaudeConfig {
-		fmt.Println("\n⚠ Warning: No .claude.json found - this may not be a valid Claude configuration directory")
-	}
-
-	// 5. OVERWRITE CONFIRMATION
-	if profileExists {
-		fmt.Printf("\n⚠ Profile '%s' already exists!\n", name)
-		if !promptYesNo("Overwrite existing profile?", false) {
-			return fmt.Errorf("import cancelled by user")
-		}
-		// Remove existing profile
-		if err := os.RemoveAll(destPath); err != nil {
-			return fmt.Errorf("failed to remove existing profile: %w", err)
-		}
-	}
-
-	// 6. IMPORT CONFIRMATION
-	if !promptYesNo("\nProceed with import?", true) {
-		return fmt.Errorf("import cancelled by user")
-	}
-
-	// 7. CREATE DESTINATION DIRECTORY
-	if err := os.MkdirAll(destPath, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
-	}
-
-	// 8. COPY FILES
-	fmt.Println("\nImporting files...")
-	copiedCount := 0
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		srcFile := filepath.Join(absSourcePath, entry.Name())
-		dstFile := filepath.Join(destPath, entry.Name())
-
-		// Skip metadata file - we'll create our own
-		if entry.Name() == MetadataFileName {
-			continue
-		}
-
-		data, err := os.ReadFile(srcFile)
-		if err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to read file %s: %w", entry.Name(), err)
-		}
-
-		if err := os.WriteFile(dstFile, data, 0644); err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to write file %s: %w", entry.Name(), err)
-		}
-
-		fmt.Printf("  ✓ Copied %s\n", entry.Name())
-		copiedCount++
-	}
-
-	// 9. CREATE MISSING REQUIRED FILES
-	if !foundClaudeConfig {
-		claudeConfigPath := filepath.Join(destPath, ClaudeConfigFile)
-		if err := os.WriteFile(claudeConfigPath, []byte("{}"), 0644); err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to create Claude config file: %w", err)
-		}
-		fmt.Printf("  + Created empty %s\n", ClaudeConfigFile)
-	}
-
-	if !foundSettings {
-		settingsPath := filepath.Join(destPath, ClaudeSettingsFile)
-		if err := os.WriteFile(settingsPath, []byte("{}"), 0644); err != nil {
-			os.RemoveAll(destPath)
-			return fmt.Errorf("failed to create settings file: %w", err)
-		}
-		fmt.Printf("  + Created empty %s\n", ClaudeSettingsFile)
-	}
-
-	// 10. CREATE/UPDATE METADATA
-	metadata := ProfileMetadata{
-		CreatedAt:   time.Now(),
-		Description: description,
-		UsageCount:  0,
-		Template:    "", // No template for imported profiles
-	}
-
-	// Preserve template/customFlags if metadata was imported
-	if foundMetadata {
-		importedMetadata, err := pm.loadMetadata(destPath)
-		if err == nil {
-			metadata.Template = importedMetadata.Template
-			metadata.CustomFlags = importedMetadata.CustomFlags
-		}
-	}
-
-	if err := pm.saveMetadata(destPath, metadata); err != nil {
-		os.RemoveAll(destPath)
-		return fmt.Errorf("failed to save metadata: %w", err)
-	}
-	fmt.Printf("  ✓ Created %s\n", MetadataFileName)
-
-	// 11. ASK ABOUT REMOVING ORIGINAL
-	fmt.Printf("\nℹ Original files are still in: %s\n", absSourcePath)
-	if promptYesNo("Remove original files?", false) {
-		if err := os.RemoveAll(absSourcePath); err != nil {
-			fmt.Printf("⚠ Failed to remove original files: %v\n", err)
-			fmt.Println("You can manually delete them later")
-		} else {
-			fmt.Printf("  ✓ Removed original files from %s\n", absSourcePath)
-		}
-	}
-
-	return nil
-}
-
-// promptYesNo prompts the user for a yes/no response
-func promptYesNo(question string, defaultYes bool) bool {
-	defaultChoice := "y/N"
-	if defaultYes {
-		defaultChoice = "Y/n"
-	}
-
-	fmt.Printf("%s [%s]: ", question, defaultChoice)
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return false
-	}
-
-	input = strings.TrimSpace(strings.ToLower(input))
-
-	if input == "" {
-		return defaultYes
-	}
-
-	return input == "y" || input == "yes"
-}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
+)
+
+// TemplateBaseFile stores the template content last applied to a profile.
+// It is the common ancestor for three-way merges when the template changes.
+const TemplateBaseFile = ".template-base.json"
+
+// TemplateStatus describes how a profile relates to its template
+type TemplateStatus struct {
+	Profile  string
+	Template string
+	// TemplateChanged is true when the template content differs from what was applied
+	TemplateChanged bool
+	// LocallyModified is true when settings.json was edited since the template was applied
+	LocallyModified bool
+	// Untracked is true when the profile has no recorded provenance
+	Untracked bool
+	// Missing is true when the template no longer exists
+	Missing bool
+}
+
+// InSync reports whether neither the template nor the profile has drifted
+func (s *TemplateStatus) InSync() bool {
+	return !s.TemplateChanged && !s.LocallyModified && !s.Untracked && !s.Missing
+}
+
+// SyncResult describes the outcome of re-applying a template to a profile
+type SyncResult struct {
+	Profile  string
+	Template string
+	Changes  []SettingsChange
+	// Conflicts lists settings paths where local edits were kept over template changes
+	Conflicts []string
+}
+
+// ApplyTemplate applies a template to a profile and records it in the profile metadata
+func (pm *ProfileManager) ApplyTemplate(name, templateName string) error {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	if err := pm.config.BackupBefore(name, BackupBeforeTemplate, fmt.Sprintf("template '%s' applied", templateName)); err != nil {
+		return err
+	}
+
+	return pm.applyTemplate(profile.Path, &profile.Metadata, templateName)
+}
+
+// applyTemplate deep-merges a template into a profile's settings and records its provenance
+func (pm *ProfileManager) applyTemplate(profilePath string, metadata *ProfileMetadata, templateName string) error {
+	tm := NewTemplateManager()
+	template, err := tm.ResolveTemplate(templateName)
+	if err != nil {
+		return err
+	}
+
+	settings, err := loadSettings(profilePath)
+	if err != nil {
+		return err
+	}
+
+	settings = DeepMerge(settings, template.Content, template.ArrayMerge)
+	if err := saveSettings(profilePath, settings); err != nil {
+		return err
+	}
+
+	metadata.Template = templateName
+	return pm.recordTemplate(profilePath, metadata, template.Content, settings)
+}
+
+// recordTemplate stores the applied template content and hashes for drift detection
+func (pm *ProfileManager) recordTemplate(profilePath string, metadata *ProfileMetadata, content, settings map[string]interface{}) error {
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal template base: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(filepath.Join(profilePath, TemplateBaseFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write template base: %w", err)
+	}
+
+	metadata.TemplateHash = hashJSON(content)
+	metadata.SettingsHash = hashJSON(settings)
+	return pm.saveMetadata(profilePath, *metadata)
+}
+
+// GetTemplateStatus reports whether a profile has drifted from its template
+func (pm *ProfileManager) GetTemplateStatus(name string) (*TemplateStatus, error) {
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.Metadata.Template == "" {
+		return nil, fmt.Errorf("profile '%s' was not created from a template", name)
+	}
+
+	status := &TemplateStatus{
+		Profile:  name,
+		Template: profile.Metadata.Template,
+	}
+
+	if profile.Metadata.TemplateHash == "" {
+		status.Untracked = true
+	}
+
+	template, err := NewTemplateManager().ResolveTemplate(profile.Metadata.Template)
+	if err != nil {
+		status.Missing = true
+	} else if !status.Untracked {
+		status.TemplateChanged = hashJSON(template.Content) != profile.Metadata.TemplateHash
+	}
+
+	if !status.Untracked {
+		settings, err := loadSettings(profile.Path)
+		if err != nil {
+			// An unreadable settings file has certainly been changed
+			status.LocallyModified = true
+		} else {
+			status.LocallyModified = hashJSON(settings) != profile.Metadata.SettingsHash
+		}
+	}
+
+	return status, nil
+}
+
+// ListTemplateStatus reports the template status of every profile that uses a template
+func (pm *ProfileManager) ListTemplateStatus() ([]TemplateStatus, error) {
+	profiles, err := pm.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []TemplateStatus
+	for _, profile := range profiles {
+		if profile.Metadata.Template == "" {
+			continue
+		}
+		status, err := pm.GetTemplateStatus(profile.Name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+
+	return statuses, nil
+}
+
+// SyncTemplate re-applies a profile's template with a three-way merge between
+// the previously applied template, the current settings and the current
+// template, so local edits are kept. With dryRun nothing is written.
+func (pm *ProfileManager) SyncTemplate(name string, dryRun bool) (*SyncResult, error) {
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	profile, err := pm.GetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.Metadata.Template == "" {
+		return nil, fmt.Errorf("profile '%s' was not created from a template", name)
+	}
+
+	template, err := NewTemplateManager().ResolveTemplate(profile.Metadata.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := loadSettings(profile.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles without a recorded base are merged as if the template was never applied
+	base, err := loadTemplateBase(profile.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, conflicts := ThreeWayMerge(base, local, template.Content, template.ArrayMerge)
+
+	result := &SyncResult{
+		Profile:   name,
+		Template:  profile.Metadata.Template,
+		Changes:   DiffSettings(local, merged),
+		Conflicts: conflicts,
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	if err := pm.config.BackupBefore(name, BackupBeforeTemplate, fmt.Sprintf("template '%s' synced", profile.Metadata.Template)); err != nil {
+		return nil, err
+	}
+
+	if err := saveSettings(profile.Path, merged); err != nil {
+		return nil, err
+	}
+
+	if err := pm.recordTemplate(profile.Path, &profile.Metadata, template.Content, merged); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// loadTemplateBase reads the recorded template base, returning an empty map if there is none
+func loadTemplateBase(profilePath string) (map[string]interface{}, error) {
+	base := make(map[string]interface{})
+
+	data, err := os.ReadFile(filepath.Join(profilePath, TemplateBaseFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return base, nil
+		}
+		return nil, fmt.Errorf("failed to read template base: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse template base: %w", err)
+	}
+	if base == nil {
+		base = make(map[string]interface{})
+	}
+
+	return base, nil
+}
+
+// hashJSON returns a SHA-256 of a JSON value. Map keys are marshaled in
+// sorted order, so formatting differences do not change the hash.
+func hashJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupCustomTemplate(t *testing.T, name, content string) {
+	t.Helper()
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".cdp", "templates")
+	os.MkdirAll(dir, 0755)
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+}
+
+func TestTemplateProvenance_RecordedOnCreate(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := pm.CreateProfileWithTemplate("work", "", "restrictive"); err != nil {
+		t.Fatalf("CreateProfileWithTemplate() failed: %v", err)
+	}
+
+	profile, _ := pm.GetProfile("work")
+	if profile.Metadata.TemplateHash == "" || profile.Metadata.SettingsHash == "" {
+		t.Errorf("provenance not recorded: %+v", profile.Metadata)
+	}
+	if _, err := os.Stat(filepath.Join(profile.Path, TemplateBaseFile)); err != nil {
+		t.Errorf("template base not written: %v", err)
+	}
+
+	status, err := pm.GetTemplateStatus("work")
+	if err != nil {
+		t.Fatalf("GetTemplateStatus() failed: %v", err)
+	}
+	if !status.InSync() {
+		t.Errorf("status = %+v, want in sync", status)
+	}
+}
+
+func TestTemplateStatus_DetectsDrift(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	setupCustomTemplate(t, "team", `{"permissions":{"deny":["WebFetch"]}}`)
+	pm.CreateProfileWithTemplate("work", "", "team")
+	profile, _ := pm.GetProfile("work")
+
+	// Local edit
+	os.WriteFile(filepath.Join(profile.Path, ClaudeSettingsFile),
+		[]byte(`{"permissions":{"deny":["WebFetch"]},"model":"opus"}`), 0644)
+
+	status, _ := pm.GetTemplateStatus("work")
+	if !status.LocallyModified || status.TemplateChanged {
+		t.Errorf("status = %+v, want locally modified only", status)
+	}
+
+	// Template change
+	setupCustomTemplate(t, "team", `{"permissions":{"deny":["WebFetch","Bash(curl:*)"]}}`)
+
+	status, _ = pm.GetTemplateStatus("work")
+	if !status.LocallyModified || !status.TemplateChanged {
+		t.Errorf("status = %+v, want template changed and locally modified", status)
+	}
+
+	statuses, err := pm.ListTemplateStatus()
+	if err != nil || len(statuses) != 1 {
+		t.Errorf("ListTemplateStatus() = %v, %v; want one status", statuses, err)
+	}
+}
+
+func TestSyncTemplate_KeepsLocalEdits(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	setupCustomTemplate(t, "team", `{"permissions":{"deny":["WebFetch","Bash(curl:*)"]}}`)
+	pm.CreateProfileWithTemplate("work", "", "team")
+	profile, _ := pm.GetProfile("work")
+
+	os.WriteFile(filepath.Join(profile.Path, ClaudeSettingsFile),
+		[]byte(`{"permissions":{"deny":["WebFetch","Bash(curl:*)","Read(.env)"]},"model":"opus"}`), 0644)
+
+	setupCustomTemplate(t, "team", `{"permissions":{"deny":["WebFetch","Bash(wget:*)"]}}`)
+
+	// Dry run leaves the profile untouched
+	result, err := pm.SyncTemplate("work", true)
+	if err != nil {
+		t.Fatalf("SyncTemplate(dryRun) failed: %v", err)
+	}
+	if len(result.Changes) == 0 {
+		t.Error("SyncTemplate(dryRun) should report changes")
+	}
+	if status, _ := pm.GetTemplateStatus("work"); !status.TemplateChanged {
+		t.Error("dry run should not record the new template")
+	}
+
+	if _, err := pm.SyncTemplate("work", false); err != nil {
+		t.Fatalf("SyncTemplate() failed: %v", err)
+	}
+
+	settings, _ := loadSettings(profile.Path)
+	deny := settings["permissions"].(map[string]interface{})["deny"].([]interface{})
+	want := []interface{}{"WebFetch", "Read(.env)", "Bash(wget:*)"}
+	if len(deny) != len(want) {
+		t.Fatalf("deny = %v, want %v", deny, want)
+	}
+	for i := range want {
+		if deny[i] != want[i] {
+			t.Errorf("deny = %v, want %v", deny, want)
+			break
+		}
+	}
+	if settings["model"] != "opus" {
+		t.Errorf("model = %v, local edit should be kept", settings["model"])
+	}
+
+	status, _ := pm.GetTemplateStatus("work")
+	if !status.InSync() {
+		t.Errorf("status after sync = %+v, want in sync", status)
+	}
+}
+
+func TestTemplateStatus_NoTemplate(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("plain", "")
+	if _, err := pm.GetTemplateStatus("plain"); err == nil {
+		t.Error("GetTemplateStatus() should fail for a profile without a template")
+	}
+	if _, err := pm.SyncTemplate("plain", false); err == nil {
+		t.Error("SyncTemplate() should fail for a profile without a template")
+	}
+}
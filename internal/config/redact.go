@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CredentialMode controls how credentials are handled when a profile leaves
+// the machine, e.g. in an exported bundle
+type CredentialMode string
+
+const (
+	// CredentialsStrip leaves out credential files and secret values
+	CredentialsStrip CredentialMode = "strip"
+	// CredentialsRedact keeps .claude.json and replaces secret values with RedactedValue
+	CredentialsRedact CredentialMode = "redact"
+	// CredentialsKeep copies everything as is
+	CredentialsKeep CredentialMode = "keep"
+)
+
+// RedactedValue replaces secret values in redacted files
+const RedactedValue = "<redacted>"
+
+// ParseCredentialMode parses a --credentials flag value
+func ParseCredentialMode(s string) (CredentialMode, error) {
+	switch mode := CredentialMode(s); mode {
+	case CredentialsStrip, CredentialsRedact, CredentialsKeep:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid credentials mode '%s' (use strip, redact or keep)", s)
+	}
+}
+
+var (
+	// Names of variables and JSON keys that usually hold secrets
+	secretKeyPattern = regexp.MustCompile(`(?i)(api[_-]?key|token|secret|passw(or)?d|credential|private[_-]?key|session[_-]?key|access[_-]?key)`)
+
+	// Well-known secret formats, recognised whatever they are stored under
+	secretValuePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^sk-[A-Za-z0-9_-]{20,}$`),                     // Anthropic and OpenAI keys
+		regexp.MustCompile(`^(gh[pousr]_|github_pat_)[A-Za-z0-9_]{20,}$`), // GitHub tokens
+		regexp.MustCompile(`^xox[abposr]-[A-Za-z0-9-]{10,}$`),             // Slack tokens
+		regexp.MustCompile(`^AKIA[0-9A-Z]{16}$`),                          // AWS access keys
+		regexp.MustCompile(`^AIza[0-9A-Za-z_-]{35}$`),                     // Google API keys
+		regexp.MustCompile(`^eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.`),        // JWTs
+	}
+
+	digitsPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// LooksLikeSecret reports whether a value stored under key, such as an
+// environment variable, is probably a credential. References to the parent
+// environment like ${ANTHROPIC_API_KEY} are not secrets themselves.
+func LooksLikeSecret(key, value string) bool {
+	if value == "" || value == RedactedValue || strings.Contains(value, "${") {
+		return false
+	}
+
+	for _, pattern := range secretValuePatterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	// Settings such as CLAUDE_CODE_MAX_OUTPUT_TOKENS=32000 are not secrets
+	return secretKeyPattern.MatchString(key) && len(value) >= 8 && !digitsPattern.MatchString(value)
+}
+
+// redactEnv strips or redacts secret-looking values of an environment map.
+// Returns the keys that were changed.
+func redactEnv(env map[string]string, mode CredentialMode) []string {
+	if mode == CredentialsKeep {
+		return nil
+	}
+
+	var changed []string
+	for _, key := range sortedStringKeys(env) {
+		if !LooksLikeSecret(key, env[key]) {
+			continue
+		}
+		if mode == CredentialsStrip {
+			delete(env, key)
+		} else {
+			env[key] = RedactedValue
+		}
+		changed = append(changed, key)
+	}
+	return changed
+}
+
+// redactJSON replaces secret-looking string values in decoded JSON with
+// RedactedValue. Returns the JSON paths that were redacted.
+func redactJSON(value interface{}, path string) []string {
+	var redacted []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			childPath := joinPath(path, key)
+			if s, ok := v[key].(string); ok {
+				if LooksLikeSecret(key, s) {
+					v[key] = RedactedValue
+					redacted = append(redacted, childPath)
+				}
+				continue
+			}
+			redacted = append(redacted, redactJSON(v[key], childPath)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			redacted = append(redacted, redactJSON(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return redacted
+}
+
+// dropRedacted removes object entries whose value is RedactedValue, so
+// placeholders never reach Claude. Returns the JSON paths that were removed.
+func dropRedacted(value interface{}, path string) []string {
+	var dropped []string
+	if m, ok := value.(map[string]interface{}); ok {
+		for _, key := range sortedKeys(m) {
+			childPath := joinPath(path, key)
+			if m[key] == RedactedValue {
+				delete(m, key)
+				dropped = append(dropped, childPath)
+				continue
+			}
+			dropped = append(dropped, dropRedacted(m[key], childPath)...)
+		}
+	}
+	return dropped
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
+)
+
+// BrokenMetadataFileName keeps unreadable metadata replaced by RepairProfile
+const BrokenMetadataFileName = MetadataFileName + ".broken"
+
+// RepairProfile rebuilds a profile's metadata from filesystem timestamps if it
+// is missing or unreadable, and recreates missing placeholder Claude files.
+// Unreadable metadata is kept as .metadata.json.broken. Returns a description
+// of each repair; a healthy profile is left untouched.
+func (pm *ProfileManager) RepairProfile(name string) ([]string, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid profile name: %w", err)
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	profilePath := filepath.Join(pm.config.ProfilesDir, name)
+	if _, err := os.Stat(profilePath); err != nil {
+		return nil, fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	var repairs []string
+	metadataPath := filepath.Join(profilePath, MetadataFileName)
+	if _, err := pm.loadMetadata(profilePath); err != nil {
+		if _, statErr := os.Stat(metadataPath); statErr == nil {
+			if err := os.Rename(metadataPath, filepath.Join(profilePath, BrokenMetadataFileName)); err != nil {
+				return nil, fmt.Errorf("failed to keep unreadable metadata: %w", err)
+			}
+			repairs = append(repairs, fmt.Sprintf("moved unreadable %s to %s", MetadataFileName, BrokenMetadataFileName))
+		}
+	}
+
+	created, err := pm.RestoreMissingFiles(name)
+	for _, file := range created {
+		if file == MetadataFileName {
+			repairs = append(repairs, fmt.Sprintf("rebuilt %s from file timestamps", MetadataFileName))
+		} else {
+			repairs = append(repairs, fmt.Sprintf("created empty %s", file))
+		}
+	}
+
+	return repairs, err
+}
+
+// RestoreMissingFiles recreates a profile's metadata and placeholder Claude
+// files if they are missing. Existing files are never touched.
+// Returns the names of the files that were created.
+func (pm *ProfileManager) RestoreMissingFiles(name string) ([]string, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid profile name: %w", err)
+	}
+
+	unlock, err := LockProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	profilePath := filepath.Join(pm.config.ProfilesDir, name)
+	if _, err := os.Stat(profilePath); err != nil {
+		return nil, fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	var created []string
+	metadataPath := filepath.Join(profilePath, MetadataFileName)
+	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
+		metadata, err := metadataFromTimestamps(profilePath)
+		if err != nil {
+			return created, err
+		}
+		if err := pm.saveMetadata(profilePath, metadata); err != nil {
+			return created, err
+		}
+		created = append(created, MetadataFileName)
+	}
+
+	for _, file := range []string{ClaudeConfigFile, ClaudeSettingsFile} {
+		filePath := filepath.Join(profilePath, file)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			if err := atomicfile.WriteFile(filePath, []byte("{}"), 0644); err != nil {
+				return created, fmt.Errorf("failed to create %s: %w", file, err)
+			}
+			created = append(created, file)
+		}
+	}
+
+	return created, nil
+}
+
+// metadataFromTimestamps estimates profile metadata from the files in a
+// profile directory: the oldest file modification time is taken as the
+// creation time and the newest as the last use
+func metadataFromTimestamps(profilePath string) (ProfileMetadata, error) {
+	var oldest, newest time.Time
+	err := filepath.Walk(profilePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Directory times change with every file operation, and cdp's own
+		// bookkeeping files say nothing about when Claude used the profile
+		if info.IsDir() || info.Name() == MetadataFileName || info.Name() == BrokenMetadataFileName {
+			return nil
+		}
+
+		modTime := info.ModTime()
+		if oldest.IsZero() || modTime.Before(oldest) {
+			oldest = modTime
+		}
+		if modTime.After(newest) {
+			newest = modTime
+		}
+		return nil
+	})
+	if err != nil {
+		return ProfileMetadata{}, fmt.Errorf("failed to read profile directory: %w", err)
+	}
+
+	if oldest.IsZero() {
+		info, err := os.Stat(profilePath)
+		if err != nil {
+			return ProfileMetadata{}, fmt.Errorf("failed to read profile directory: %w", err)
+		}
+		oldest = info.ModTime()
+	}
+
+	metadata := ProfileMetadata{CreatedAt: oldest}
+	if newest.After(oldest) {
+		metadata.LastUsed = newest
+	}
+	return metadata, nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListProfiles_IncludesBroken(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("good", "")
+	pm.CreateProfile("bad", "")
+	profile, _ := pm.GetProfile("bad")
+	os.WriteFile(filepath.Join(profile.Path, MetadataFileName), []byte("{not json"), 0644)
+
+	profiles, err := pm.ListProfiles()
+	if err != nil {
+		t.Fatalf("ListProfiles() failed: %v", err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("ListProfiles() returned %d profiles, want 2", len(profiles))
+	}
+
+	for _, p := range profiles {
+		if p.IsBroken() != (p.Name == "bad") {
+			t.Errorf("%s: IsBroken() = %v (LoadErr = %v)", p.Name, p.IsBroken(), p.LoadErr)
+		}
+	}
+}
+
+func TestRepairProfile(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+	profile, _ := pm.GetProfile("work")
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	used := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	history := filepath.Join(profile.Path, "history.jsonl")
+	os.WriteFile(history, []byte("{}\n"), 0644)
+	os.Chtimes(filepath.Join(profile.Path, ClaudeConfigFile), created, created)
+	os.Chtimes(filepath.Join(profile.Path, ClaudeSettingsFile), created, created)
+	os.Chtimes(history, used, used)
+	os.Chtimes(profile.Path, created, created)
+
+	os.WriteFile(filepath.Join(profile.Path, MetadataFileName), []byte("{not json"), 0644)
+
+	if _, err := pm.GetProfile("work"); err == nil {
+		t.Fatal("GetProfile() should fail with broken metadata")
+	}
+
+	repairs, err := pm.RepairProfile("work")
+	if err != nil {
+		t.Fatalf("RepairProfile() failed: %v", err)
+	}
+	if len(repairs) != 2 {
+		t.Errorf("repairs = %v, want 2", repairs)
+	}
+
+	repaired, err := pm.GetProfile("work")
+	if err != nil {
+		t.Fatalf("GetProfile() after repair failed: %v", err)
+	}
+	if !repaired.Metadata.CreatedAt.Equal(created) {
+		t.Errorf("CreatedAt = %v, want %v", repaired.Metadata.CreatedAt, created)
+	}
+	if !repaired.Metadata.LastUsed.Equal(used) {
+		t.Errorf("LastUsed = %v, want %v", repaired.Metadata.LastUsed, used)
+	}
+
+	data, err := os.ReadFile(filepath.Join(profile.Path, BrokenMetadataFileName))
+	if err != nil || string(data) != "{not json" {
+		t.Errorf("broken metadata not kept: %q, %v", data, err)
+	}
+
+	// A healthy profile needs no repairs
+	repairs, err = pm.RepairProfile("work")
+	if err != nil || len(repairs) != 0 {
+		t.Errorf("RepairProfile() on healthy profile = %v, %v", repairs, err)
+	}
+
+	if _, err := pm.RepairProfile("missing"); err == nil {
+		t.Error("RepairProfile() should fail for a missing profile")
+	}
+}
+
+func TestRestoreMissingFiles(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+	profile, _ := pm.GetProfile("work")
+	os.WriteFile(filepath.Join(profile.Path, ClaudeSettingsFile), []byte(`{"model":"opus"}`), 0644)
+	os.Remove(filepath.Join(profile.Path, MetadataFileName))
+	os.Remove(filepath.Join(profile.Path, ClaudeConfigFile))
+
+	created, err := pm.RestoreMissingFiles("work")
+	if err != nil {
+		t.Fatalf("RestoreMissingFiles() failed: %v", err)
+	}
+	if len(created) != 2 || created[0] != MetadataFileName || created[1] != ClaudeConfigFile {
+		t.Errorf("created = %v, want [%s %s]", created, MetadataFileName, ClaudeConfigFile)
+	}
+
+	if err := pm.ValidateProfile(profile); err != nil {
+		t.Errorf("profile still invalid: %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(profile.Path, ClaudeSettingsFile))
+	if string(data) != `{"model":"opus"}` {
+		t.Errorf("existing settings were modified: %s", data)
+	}
+
+	if _, err := pm.RestoreMissingFiles("missing"); err == nil {
+		t.Error("RestoreMissingFiles() should fail for a missing profile")
+	}
+}
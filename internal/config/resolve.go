@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProfileFileName is the per-directory file that pins a profile
+const ProfileFileName = ".cdp-profile"
+
+// ResolutionSource describes why a profile was chosen
+type ResolutionSource string
+
+const (
+	SourceProfileFile   ResolutionSource = "profile-file"
+	SourceDirectoryRule ResolutionSource = "directory-rule"
+	SourceCurrent       ResolutionSource = "current"
+)
+
+// Resolution is the result of resolving a profile for a directory
+type Resolution struct {
+	Profile string
+	Source  ResolutionSource
+	// Detail is the .cdp-profile path or the matching directory pattern
+	Detail string
+}
+
+// Reason returns a human-readable explanation of the resolution
+func (r *Resolution) Reason() string {
+	switch r.Source {
+	case SourceProfileFile:
+		return fmt.Sprintf("set by %s", r.Detail)
+	case SourceDirectoryRule:
+		return fmt.Sprintf("directory matches '%s' in config.yaml", r.Detail)
+	default:
+		return "current profile"
+	}
+}
+
+// IsDirectoryBound reports whether the profile was chosen from the directory
+func (r *Resolution) IsDirectoryBound() bool {
+	return r.Source == SourceProfileFile || r.Source == SourceDirectoryRule
+}
+
+// ResolveProfile determines which profile to use in dir.
+// The nearest .cdp-profile file wins, then the first matching entry of
+// directoryProfiles, then the current profile. Returns nil if nothing applies.
+func (c *Config) ResolveProfile(dir string) (*Resolution, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	if res, err := findProfileFile(absDir); err != nil || res != nil {
+		return res, err
+	}
+
+	if res := c.matchDirectoryRule(absDir); res != nil {
+		return res, nil
+	}
+
+	if c.CurrentProfile != "" {
+		return &Resolution{Profile: c.CurrentProfile, Source: SourceCurrent}, nil
+	}
+
+	return nil, nil
+}
+
+// findProfileFile walks up from dir looking for a .cdp-profile file
+func findProfileFile(dir string) (*Resolution, error) {
+	for {
+		path := filepath.Join(dir, ProfileFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			name, err := readProfileFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return &Resolution{Profile: name, Source: SourceProfileFile, Detail: path}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readProfileFile returns the first non-empty, non-comment line of a .cdp-profile file
+func readProfileFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := ValidateName(line); err != nil {
+			return "", fmt.Errorf("invalid profile in %s: %w", path, err)
+		}
+		return line, nil
+	}
+
+	return "", fmt.Errorf("%s does not name a profile", path)
+}
+
+// matchDirectoryRule returns the first directory binding matching dir or one of its parents
+func (c *Config) matchDirectoryRule(dir string) *Resolution {
+	for _, binding := range c.DirectoryProfiles {
+		pattern := expandHome(binding.Path)
+		// A trailing /** is implied since parents are matched too
+		pattern = strings.TrimSuffix(pattern, "/**")
+		pattern = filepath.Clean(pattern)
+
+		for d := dir; ; d = filepath.Dir(d) {
+			if ok, _ := filepath.Match(pattern, d); ok {
+				return &Resolution{Profile: binding.Profile, Source: SourceDirectoryRule, Detail: binding.Path}
+			}
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveProfile_ProfileFile(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	root := t.TempDir()
+	nested := filepath.Join(root, "project", "src", "pkg")
+	os.MkdirAll(nested, 0755)
+
+	profileFile := filepath.Join(root, "project", ProfileFileName)
+	os.WriteFile(profileFile, []byte("# client work\nacme\n"), 0644)
+
+	res, err := cfg.ResolveProfile(nested)
+	if err != nil {
+		t.Fatalf("ResolveProfile() failed: %v", err)
+	}
+	if res == nil || res.Profile != "acme" {
+		t.Fatalf("ResolveProfile() = %+v, want profile 'acme'", res)
+	}
+	if res.Source != SourceProfileFile || res.Detail != profileFile {
+		t.Errorf("ResolveProfile() source = %s (%s), want profile file %s", res.Source, res.Detail, profileFile)
+	}
+	if !res.IsDirectoryBound() {
+		t.Error("IsDirectoryBound() = false, want true")
+	}
+}
+
+func TestResolveProfile_InvalidProfileFile(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ProfileFileName), []byte("not a valid name!\n"), 0644)
+
+	if _, err := cfg.ResolveProfile(dir); err == nil {
+		t.Error("ResolveProfile() should fail for an invalid .cdp-profile")
+	}
+}
+
+func TestResolveProfile_DirectoryRule(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	home, _ := os.UserHomeDir()
+	clientDir := filepath.Join(home, "code", "clients", "globex", "api")
+	os.MkdirAll(clientDir, 0755)
+
+	cfg.DirectoryProfiles = []DirectoryBinding{
+		{Path: "~/code/clients/*", Profile: "clients"},
+		{Path: "~/code/**", Profile: "personal"},
+	}
+
+	res, err := cfg.ResolveProfile(clientDir)
+	if err != nil {
+		t.Fatalf("ResolveProfile() failed: %v", err)
+	}
+	if res == nil || res.Profile != "clients" || res.Source != SourceDirectoryRule {
+		t.Fatalf("ResolveProfile() = %+v, want 'clients' from directory rule", res)
+	}
+
+	res, _ = cfg.ResolveProfile(filepath.Join(home, "code"))
+	if res == nil || res.Profile != "personal" {
+		t.Errorf("ResolveProfile(~/code) = %+v, want 'personal'", res)
+	}
+}
+
+func TestResolveProfile_ProfileFileBeatsRule(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ProfileFileName), []byte("pinned"), 0644)
+	cfg.DirectoryProfiles = []DirectoryBinding{{Path: dir, Profile: "rule"}}
+
+	res, _ := cfg.ResolveProfile(dir)
+	if res == nil || res.Profile != "pinned" {
+		t.Errorf("ResolveProfile() = %+v, want 'pinned'", res)
+	}
+}
+
+func TestResolveProfile_FallsBackToCurrent(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	dir := t.TempDir()
+
+	res, err := cfg.ResolveProfile(dir)
+	if err != nil || res != nil {
+		t.Fatalf("ResolveProfile() = %+v, %v; want nil, nil", res, err)
+	}
+
+	cfg.CurrentProfile = "work"
+	res, _ = cfg.ResolveProfile(dir)
+	if res == nil || res.Profile != "work" || res.Source != SourceCurrent {
+		t.Fatalf("ResolveProfile() = %+v, want current profile 'work'", res)
+	}
+	if res.IsDirectoryBound() {
+		t.Error("IsDirectoryBound() = true for current profile fallback")
+	}
+}
+
+func TestDirectoryProfiles_Persist(t *testing.T) {
+	cfg, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	cfg.DirectoryProfiles = []DirectoryBinding{{Path: "~/work", Profile: "work"}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(loaded.DirectoryProfiles) != 1 || loaded.DirectoryProfiles[0].Profile != "work" {
+		t.Errorf("DirectoryProfiles = %+v, want one 'work' binding", loaded.DirectoryProfiles)
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// BackupTargetType selects where a backup target keeps backups
+type BackupTargetType string
+
+const (
+	// TargetDir keeps backups in a directory, such as a mounted NAS share or
+	// a Syncthing folder
+	TargetDir BackupTargetType = "dir"
+	// TargetS3 keeps backups in an S3-compatible bucket (AWS S3, MinIO, ...)
+	TargetS3 BackupTargetType = "s3"
+)
+
+// LocalTarget names the backup directory, ~/.cdp/backups. It cannot be used
+// for an entry of backupTargets.
+const LocalTarget = "local"
+
+const (
+	defaultAccessKeyEnv = "AWS_ACCESS_KEY_ID"
+	defaultSecretKeyEnv = "AWS_SECRET_ACCESS_KEY"
+	defaultRegion       = "us-east-1"
+)
+
+// BackupTarget is an entry of the backupTargets section of config.yaml
+type BackupTarget struct {
+	Type BackupTargetType `yaml:"type"`
+	// Path is the directory of dir targets. It must exist, so backups never
+	// end up on the local disk while a share is not mounted.
+	Path string `yaml:"path,omitempty"`
+
+	// Endpoint is the URL of the S3 service, e.g.
+	// https://s3.eu-west-1.amazonaws.com or http://nas.local:9000
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Region defaults to us-east-1, which MinIO accepts too
+	Region string `yaml:"region,omitempty"`
+	Bucket string `yaml:"bucket,omitempty"`
+	// Prefix is put before the name of every backup, to share a bucket
+	Prefix string `yaml:"prefix,omitempty"`
+	// AccessKeyEnv and SecretKeyEnv name the environment variables holding
+	// the credentials, so they stay out of config.yaml. They default to
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+	AccessKeyEnv string `yaml:"accessKeyEnv,omitempty"`
+	SecretKeyEnv string `yaml:"secretKeyEnv,omitempty"`
+}
+
+// Validate reports settings a target of its type is missing
+func (t BackupTarget) Validate() error {
+	switch t.Type {
+	case TargetDir:
+		if t.Path == "" {
+			return fmt.Errorf("dir targets need a path")
+		}
+	case TargetS3:
+		if t.Endpoint == "" || t.Bucket == "" {
+			return fmt.Errorf("s3 targets need an endpoint and a bucket")
+		}
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid endpoint '%s' (use http:// or https://)", t.Endpoint)
+		}
+	case "":
+		return fmt.Errorf("no type (use %s or %s)", TargetDir, TargetS3)
+	default:
+		return fmt.Errorf("unknown type '%s' (use %s or %s)", t.Type, TargetDir, TargetS3)
+	}
+	return nil
+}
+
+// Dir returns the directory of a dir target, with ~ expanded
+func (t BackupTarget) Dir() string {
+	return expandHome(t.Path)
+}
+
+// RegionOrDefault returns the region of an s3 target
+func (t BackupTarget) RegionOrDefault() string {
+	if t.Region == "" {
+		return defaultRegion
+	}
+	return t.Region
+}
+
+// Credentials reads the access key and secret key of an s3 target from the
+// environment
+func (t BackupTarget) Credentials() (string, string, error) {
+	accessEnv, secretEnv := t.AccessKeyEnv, t.SecretKeyEnv
+	if accessEnv == "" {
+		accessEnv = defaultAccessKeyEnv
+	}
+	if secretEnv == "" {
+		secretEnv = defaultSecretKeyEnv
+	}
+
+	accessKey, secretKey := os.Getenv(accessEnv), os.Getenv(secretEnv)
+	if accessKey == "" || secretKey == "" {
+		return "", "", fmt.Errorf("set %s and %s to the credentials of bucket '%s'", accessEnv, secretEnv, t.Bucket)
+	}
+	return accessKey, secretKey, nil
+}
+
+// ValidateBackupTargets checks every entry of backupTargets
+func (c *Config) ValidateBackupTargets() error {
+	names := make([]string, 0, len(c.BackupTargets))
+	for name := range c.BackupTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == LocalTarget {
+			return fmt.Errorf("backup target name '%s' is reserved for the backup directory", LocalTarget)
+		}
+		if err := c.BackupTargets[name].Validate(); err != nil {
+			return fmt.Errorf("backup target '%s': %w", name, err)
+		}
+	}
+	return nil
+}
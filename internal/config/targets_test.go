@@ -0,0 +1,78 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupTarget_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  BackupTarget
+		wantErr string
+	}{
+		{"dir", BackupTarget{Type: TargetDir, Path: "/mnt/nas"}, ""},
+		{"dir without path", BackupTarget{Type: TargetDir}, "need a path"},
+		{"s3", BackupTarget{Type: TargetS3, Endpoint: "http://nas.local:9000", Bucket: "cdp"}, ""},
+		{"s3 without bucket", BackupTarget{Type: TargetS3, Endpoint: "https://s3.amazonaws.com"}, "need an endpoint and a bucket"},
+		{"s3 with bad endpoint", BackupTarget{Type: TargetS3, Endpoint: "s3.amazonaws.com", Bucket: "cdp"}, "invalid endpoint"},
+		{"no type", BackupTarget{Path: "/mnt/nas"}, "no type"},
+		{"unknown type", BackupTarget{Type: "ftp"}, "unknown type 'ftp'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.target.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateBackupTargets(t *testing.T) {
+	cfg := &Config{BackupTargets: map[string]BackupTarget{
+		"nas": {Type: TargetDir, Path: "/mnt/nas"},
+	}}
+	if err := cfg.ValidateBackupTargets(); err != nil {
+		t.Errorf("ValidateBackupTargets() = %v", err)
+	}
+
+	cfg.BackupTargets[LocalTarget] = BackupTarget{Type: TargetDir, Path: "/tmp"}
+	if err := cfg.ValidateBackupTargets(); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("ValidateBackupTargets() with a 'local' target = %v", err)
+	}
+
+	delete(cfg.BackupTargets, LocalTarget)
+	cfg.BackupTargets["offsite"] = BackupTarget{Type: TargetS3}
+	if err := cfg.ValidateBackupTargets(); err == nil || !strings.Contains(err.Error(), "'offsite'") {
+		t.Errorf("ValidateBackupTargets() = %v, want the offsite target named", err)
+	}
+}
+
+func TestBackupTarget_Settings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	target := BackupTarget{Type: TargetDir, Path: "~/Sync/cdp"}
+	if got := target.Dir(); got != filepath.Join(home, "Sync", "cdp") {
+		t.Errorf("Dir() = %s", got)
+	}
+
+	target = BackupTarget{Type: TargetS3, Bucket: "cdp", AccessKeyEnv: "CDP_S3_KEY", SecretKeyEnv: "CDP_S3_SECRET"}
+	if region := target.RegionOrDefault(); region != "us-east-1" {
+		t.Errorf("RegionOrDefault() = %s", region)
+	}
+	if _, _, err := target.Credentials(); err == nil || !strings.Contains(err.Error(), "CDP_S3_KEY") {
+		t.Errorf("Credentials() without the variables = %v", err)
+	}
+	t.Setenv("CDP_S3_KEY", "key")
+	t.Setenv("CDP_S3_SECRET", "secret")
+	if accessKey, secretKey, err := target.Credentials(); err != nil || accessKey != "key" || secretKey != "secret" {
+		t.Errorf("Credentials() = %s, %s, %v", accessKey, secretKey, err)
+	}
+}
@@ -3,19 +3,54 @@ package config
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
 )
 
 //go:embed templates/*.json
 var embeddedTemplates embed.FS
 
+// Template keys that describe the template itself rather than settings
+const (
+	templateDescriptionKey = "description"
+	templateExtendsKey     = "extends"
+	templateArrayMergeKey  = "arrayMerge"
+)
+
+// TemplateOrigin describes where a template is defined
+type TemplateOrigin string
+
+const (
+	OriginBuiltIn TemplateOrigin = "built-in"
+	OriginCustom  TemplateOrigin = "custom"
+)
+
+// TemplateInfo describes an available template
+type TemplateInfo struct {
+	Name        string
+	Description string
+	Origin      TemplateOrigin
+	// Path is the template file for custom templates
+	Path string
+	// ShadowsBuiltIn is true when a custom template hides a built-in with the same name
+	ShadowsBuiltIn bool
+}
+
 // Template represents a profile template
 type Template struct {
-	Name    string                 `json:"name"`
-	Content map[string]interface{} `json:"content"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Content     map[string]interface{} `json:"content"`
+	// Extends lists templates whose content is merged in first, in order
+	Extends []string `json:"extends,omitempty"`
+	// ArrayMerge sets the array strategy per settings path ("*" for all)
+	ArrayMerge ArrayStrategies `json:"arrayMerge,omitempty"`
 }
 
 // TemplateManager handles template operations
@@ -31,9 +66,11 @@ func NewTemplateManager() *TemplateManager {
 	}
 }
 
-// ListTemplates returns all available templates (built-in + custom)
-func (tm *TemplateManager) ListTemplates() ([]string, error) {
-	templates := []string{}
+// ListTemplates returns all available templates (built-in + custom).
+// A custom template with the same name as a built-in replaces it in the list.
+func (tm *TemplateManager) ListTemplates() ([]TemplateInfo, error) {
+	templates := []TemplateInfo{}
+	index := make(map[string]int)
 
 	// List built-in templates
 	entries, err := embeddedTemplates.ReadDir("templates")
@@ -41,7 +78,12 @@ func (tm *TemplateManager) ListTemplates() ([]string, error) {
 		for _, entry := range entries {
 			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
 				name := strings.TrimSuffix(entry.Name(), ".json")
-				templates = append(templates, name)
+				info, err := tm.GetTemplateInfo(name)
+				if err != nil {
+					continue
+				}
+				index[name] = len(templates)
+				templates = append(templates, *info)
 			}
 		}
 	}
@@ -53,17 +95,16 @@ func (tm *TemplateManager) ListTemplates() ([]string, error) {
 			for _, entry := range entries {
 				if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
 					name := strings.TrimSuffix(entry.Name(), ".json")
-					// Avoid duplicates
-					found := false
-					for _, t := range templates {
-						if t == name {
-							found = true
-							break
-						}
+					info, err := tm.GetTemplateInfo(name)
+					if err != nil {
+						continue
 					}
-					if !found {
-						templates = append(templates, name)
+					// Avoid duplicates
+					if i, found := index[name]; found {
+						templates[i] = *info
+						continue
 					}
+					templates = append(templates, *info)
 				}
 			}
 		}
@@ -72,10 +113,82 @@ func (tm *TemplateManager) ListTemplates() ([]string, error) {
 	return templates, nil
 }
 
+// GetTemplateInfo returns the origin and description of a template
+func (tm *TemplateManager) GetTemplateInfo(name string) (*TemplateInfo, error) {
+	data, info, err := tm.ReadTemplateFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// An unparseable custom template is still listed so it can be fixed
+	if template, err := parseTemplate(name, data); err == nil {
+		info.Description = template.Description
+	}
+
+	return info, nil
+}
+
+// templateNotFoundError reports a template that is neither custom nor
+// built in. It matches fs.ErrNotExist.
+type templateNotFoundError struct {
+	name string
+}
+
+func (e templateNotFoundError) Error() string {
+	return fmt.Sprintf("template '%s' not found", e.name)
+}
+
+func (e templateNotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// ReadTemplateFile returns the raw JSON of a template and where it comes
+// from. The error matches fs.ErrNotExist only if there is no such template;
+// a custom template that cannot be read is an error of its own.
+func (tm *TemplateManager) ReadTemplateFile(name string) ([]byte, *TemplateInfo, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, nil, fmt.Errorf("invalid template name: %w", err)
+	}
+
+	_, builtInErr := embeddedTemplates.ReadFile("templates/" + name + ".json")
+	hasBuiltIn := builtInErr == nil
+
+	customPath := tm.customTemplatePath(name)
+	data, err := os.ReadFile(customPath)
+	if err == nil {
+		return data, &TemplateInfo{
+			Name:           name,
+			Origin:         OriginCustom,
+			Path:           customPath,
+			ShadowsBuiltIn: hasBuiltIn,
+		}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to read template '%s': %w", name, err)
+	}
+
+	data, err = embeddedTemplates.ReadFile("templates/" + name + ".json")
+	if err != nil {
+		return nil, nil, templateNotFoundError{name: name}
+	}
+
+	return data, &TemplateInfo{Name: name, Origin: OriginBuiltIn}, nil
+}
+
+// IsBuiltIn checks if a built-in template with the given name exists
+func (tm *TemplateManager) IsBuiltIn(name string) bool {
+	_, err := embeddedTemplates.ReadFile("templates/" + name + ".json")
+	return err == nil
+}
+
 // LoadTemplate loads a template by name
 func (tm *TemplateManager) LoadTemplate(name string) (*Template, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid template name: %w", err)
+	}
+
 	// Try custom templates first
-	customPath := filepath.Join(tm.customTemplatesDir, name+".json")
+	customPath := tm.customTemplatePath(name)
 	if _, err := os.Stat(customPath); err == nil {
 		return tm.loadTemplateFromFile(customPath, name)
 	}
@@ -86,15 +199,16 @@ func (tm *TemplateManager) LoadTemplate(name string) (*Template, error) {
 		return nil, fmt.Errorf("template '%s' not found", name)
 	}
 
-	var content map[string]interface{}
-	if err := json.Unmarshal(data, &content); err != nil {
+	template, err := parseTemplate(name, data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse template '%s': %w", name, err)
 	}
 
-	return &Template{
-		Name:    name,
-		Content: content,
-	}, nil
+	if err := ValidateSettings(template.Content).Err(); err != nil {
+		return nil, fmt.Errorf("template '%s' has invalid settings: %w", name, err)
+	}
+
+	return template, nil
 }
 
 // loadTemplateFromFile loads a template from a file path
@@ -104,55 +218,340 @@ func (tm *TemplateManager) loadTemplateFromFile(path, name string) (*Template, e
 		return nil, fmt.Errorf("failed to read template file: %w", err)
 	}
 
+	template, err := parseTemplate(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	if err := ValidateSettings(template.Content).Err(); err != nil {
+		return nil, fmt.Errorf("template '%s' has invalid settings: %w", name, err)
+	}
+
+	return template, nil
+}
+
+// parseTemplate splits a template file into its settings content and template keys
+func parseTemplate(name string, data []byte) (*Template, error) {
 	var content map[string]interface{}
 	if err := json.Unmarshal(data, &content); err != nil {
-		return nil, fmt.Errorf("failed to parse template: %w", err)
+		return nil, err
+	}
+	if content == nil {
+		content = make(map[string]interface{})
+	}
+
+	template := &Template{Name: name}
+
+	switch description := content[templateDescriptionKey].(type) {
+	case nil:
+	case string:
+		template.Description = description
+	default:
+		return nil, fmt.Errorf("'%s' must be a string", templateDescriptionKey)
+	}
+
+	// extends: "base" or ["base", "other"]
+	switch extends := content[templateExtendsKey].(type) {
+	case nil:
+	case string:
+		template.Extends = []string{extends}
+	case []interface{}:
+		for _, item := range extends {
+			parent, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%s' must contain template names", templateExtendsKey)
+			}
+			template.Extends = append(template.Extends, parent)
+		}
+	default:
+		return nil, fmt.Errorf("'%s' must be a template name or a list of names", templateExtendsKey)
 	}
 
+	// arrayMerge: "replace" or {"permissions.allow": "replace", "*": "union"}
+	switch arrayMerge := content[templateArrayMergeKey].(type) {
+	case nil:
+	case string:
+		strategy, err := ParseArrayStrategy(arrayMerge)
+		if err != nil {
+			return nil, err
+		}
+		template.ArrayMerge = ArrayStrategies{"*": strategy}
+	case map[string]interface{}:
+		template.ArrayMerge = make(ArrayStrategies)
+		for path, value := range arrayMerge {
+			name, _ := value.(string)
+			strategy, err := ParseArrayStrategy(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", templateArrayMergeKey, path, err)
+			}
+			template.ArrayMerge[path] = strategy
+		}
+	default:
+		return nil, fmt.Errorf("'%s' must be a strategy or a map of paths to strategies", templateArrayMergeKey)
+	}
+
+	delete(content, templateDescriptionKey)
+	delete(content, templateExtendsKey)
+	delete(content, templateArrayMergeKey)
+	template.Content = content
+
+	return template, nil
+}
+
+// ResolveTemplate loads a template and merges in the templates it extends.
+// Parents are merged in order and the template's own content is applied last.
+func (tm *TemplateManager) ResolveTemplate(name string) (*Template, error) {
+	return tm.resolveTemplate(name, nil)
+}
+
+func (tm *TemplateManager) resolveTemplate(name string, chain []string) (*Template, error) {
+	for _, seen := range chain {
+		if seen == name {
+			return nil, fmt.Errorf("template inheritance cycle: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+	}
+	chain = append(chain, name)
+
+	template, err := tm.LoadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []*Template
+	strategies := make(ArrayStrategies)
+	for _, parentName := range template.Extends {
+		parent, err := tm.resolveTemplate(parentName, chain)
+		if err != nil {
+			return nil, fmt.Errorf("template '%s' extends '%s': %w", name, parentName, err)
+		}
+		parents = append(parents, parent)
+		for path, strategy := range parent.ArrayMerge {
+			strategies[path] = strategy
+		}
+	}
+	for path, strategy := range template.ArrayMerge {
+		strategies[path] = strategy
+	}
+
+	content := make(map[string]interface{})
+	for _, parent := range parents {
+		content = DeepMerge(content, parent.Content, strategies)
+	}
+	content = DeepMerge(content, template.Content, strategies)
+
 	return &Template{
-		Name:    name,
-		Content: content,
+		Name:        name,
+		Description: template.Description,
+		Content:     content,
+		Extends:     template.Extends,
+		ArrayMerge:  strategies,
 	}, nil
 }
 
-// ApplyTemplate applies a template to a profile's settings.json
+// PreviewTemplate returns a profile's current settings and the settings
+// that applying the template would produce, without writing anything
+func (tm *TemplateManager) PreviewTemplate(profilePath, templateName string) (map[string]interface{}, map[string]interface{}, error) {
+	template, err := tm.ResolveTemplate(templateName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := loadSettings(profilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return settings, DeepMerge(settings, template.Content, template.ArrayMerge), nil
+}
+
+// ApplyTemplate deep-merges a template into a profile's settings.json
 func (tm *TemplateManager) ApplyTemplate(profilePath, templateName string) error {
-	template, err := tm.LoadTemplate(templateName)
+	_, settings, err := tm.PreviewTemplate(profilePath, templateName)
 	if err != nil {
 		return err
 	}
 
-	settingsPath := filepath.Join(profilePath, ClaudeSettingsFile)
+	return saveSettings(profilePath, settings)
+}
+
+// TemplateExists checks if a template exists
+func (tm *TemplateManager) TemplateExists(name string) bool {
+	_, err := tm.LoadTemplate(name)
+	return err == nil
+}
 
-	// Load existing settings if any
-	var settings map[string]interface{}
-	if data, err := os.ReadFile(settingsPath); err == nil {
-		json.Unmarshal(data, &settings)
+// ValidateTemplate checks that template JSON parses, that its settings match
+// the settings schema and that everything it extends can be resolved.
+// name is used to detect self-references.
+func (tm *TemplateManager) ValidateTemplate(name string, data []byte) error {
+	template, err := parseTemplate(name, data)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
 	}
-	if settings == nil {
-		settings = make(map[string]interface{})
+
+	if err := ValidateSettings(template.Content).Err(); err != nil {
+		return fmt.Errorf("invalid template settings: %w", err)
+	}
+
+	for _, parent := range template.Extends {
+		if parent == name {
+			return fmt.Errorf("template '%s' cannot extend itself", name)
+		}
+		if _, err := tm.resolveTemplate(parent, []string{name}); err != nil {
+			return fmt.Errorf("template '%s' extends '%s': %w", name, parent, err)
+		}
+	}
+
+	return nil
+}
+
+// SaveTemplate validates template JSON and writes it as a custom template
+func (tm *TemplateManager) SaveTemplate(name string, data []byte) error {
+	if err := ValidateName(name); err != nil {
+		return fmt.Errorf("invalid template name: %w", err)
+	}
+
+	if err := tm.ValidateTemplate(name, data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(tm.customTemplatesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(tm.customTemplatePath(name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write template file: %w", err)
+	}
+
+	return nil
+}
+
+// CreateTemplateFromProfile snapshots a profile's settings.json as a custom template
+func (tm *TemplateManager) CreateTemplateFromProfile(name, profilePath, description string) error {
+	if err := ValidateName(name); err != nil {
+		return fmt.Errorf("invalid template name: %w", err)
+	}
+
+	if _, err := os.Stat(tm.customTemplatePath(name)); err == nil {
+		return fmt.Errorf("custom template '%s' already exists", name)
+	}
+
+	settings, err := loadSettings(profilePath)
+	if err != nil {
+		return err
+	}
+
+	content := make(map[string]interface{}, len(settings)+1)
+	for key, value := range settings {
+		content[key] = value
+	}
+	if description != "" {
+		content[templateDescriptionKey] = description
+	}
+
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
 	}
 
-	// Merge template content into settings
+	return tm.SaveTemplate(name, data)
+}
+
+// DeleteTemplate removes a custom template. Built-in templates cannot be deleted.
+func (tm *TemplateManager) DeleteTemplate(name string) error {
+	if err := ValidateName(name); err != nil {
+		return fmt.Errorf("invalid template name: %w", err)
+	}
+
+	path := tm.customTemplatePath(name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if tm.IsBuiltIn(name) {
+			return fmt.Errorf("'%s' is a built-in template and cannot be deleted", name)
+		}
+		return fmt.Errorf("template '%s' not found", name)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	return nil
+}
+
+// ExportTemplate returns template JSON for sharing. If resolved is true the
+// extended templates are merged in so the result is self-contained.
+func (tm *TemplateManager) ExportTemplate(name string, resolved bool) ([]byte, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, fmt.Errorf("invalid template name: %w", err)
+	}
+
+	if !resolved {
+		data, _, err := tm.ReadTemplateFile(name)
+		return data, err
+	}
+
+	template, err := tm.ResolveTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make(map[string]interface{}, len(template.Content)+2)
 	for key, value := range template.Content {
-		settings[key] = value
+		content[key] = value
+	}
+	if template.Description != "" {
+		content[templateDescriptionKey] = template.Description
+	}
+	if len(template.ArrayMerge) > 0 {
+		content[templateArrayMergeKey] = template.ArrayMerge
 	}
 
-	// Write back
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal template: %w", err)
+	}
+	return data, nil
+}
+
+// customTemplatePath returns the file path of a custom template
+func (tm *TemplateManager) customTemplatePath(name string) string {
+	return filepath.Join(tm.customTemplatesDir, name+".json")
+}
+
+// loadSettings reads a profile's settings.json, returning an empty map if it does not exist
+func loadSettings(profilePath string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+
+	data, err := os.ReadFile(filepath.Join(profilePath, ClaudeSettingsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings file: %w", err)
+	}
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+
+	return settings, nil
+}
+
+// saveSettings writes a profile's settings.json
+func saveSettings(profilePath string, settings map[string]interface{}) error {
+	settingsPath := filepath.Join(profilePath, ClaudeSettingsFile)
+
 	data, err := json.MarshalIndent(settings, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal settings: %w", err)
 	}
 
-	if err := os.WriteFile(settingsPath, data, 0644); err != nil {
+	if err := atomicfile.WriteFile(settingsPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write settings file: %w", err)
 	}
 
 	return nil
 }
-
-// TemplateExists checks if a template exists
-func (tm *TemplateManager) TemplateExists(name string) bool {
-	_, err := tm.LoadTemplate(name)
-	return err == nil
-}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
@@ -31,11 +33,11 @@ func TestListTemplates(t *testing.T) {
 	// Check for expected templates
 	hasRestrictive := false
 	hasPermissive := false
-	for _, name := range templates {
-		if name == "restrictive" {
+	for _, info := range templates {
+		if info.Name == "restrictive" {
 			hasRestrictive = true
 		}
-		if name == "permissive" {
+		if info.Name == "permissive" {
 			hasPermissive = true
 		}
 	}
@@ -89,6 +91,27 @@ func TestLoadTemplate_NotFound(t *testing.T) {
 	}
 }
 
+func TestReadTemplateFile_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	tm := NewTemplateManager()
+	if _, _, err := tm.ReadTemplateFile("nonexistent"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadTemplateFile('nonexistent') error = %v, want fs.ErrNotExist", err)
+	}
+
+	// A custom template that cannot be read is not a missing one
+	if err := os.MkdirAll(tm.customTemplatePath("broken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := tm.ReadTemplateFile("broken")
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadTemplateFile('broken') error = %v, want a read error", err)
+	}
+}
+
 func TestTemplateExists(t *testing.T) {
 	tm := NewTemplateManager()
 
@@ -216,3 +239,287 @@ func TestLoadTemplate_CustomTemplate(t *testing.T) {
 		t.Error("template should not be nil")
 	}
 }
+
+func TestApplyTemplate_DeepMergeKeepsAllowList(t *testing.T) {
+	tmpDir := t.TempDir()
+	profilePath := filepath.Join(tmpDir, "test-profile")
+	os.MkdirAll(profilePath, 0755)
+
+	settingsPath := filepath.Join(profilePath, ClaudeSettingsFile)
+	os.WriteFile(settingsPath, []byte(`{"permissions":{"allow":["Bash(go test:*)"],"deny":["Read(.env)"]}}`), 0644)
+
+	tm := NewTemplateManager()
+	if err := tm.ApplyTemplate(profilePath, "restrictive"); err != nil {
+		t.Fatalf("ApplyTemplate() error = %v", err)
+	}
+
+	settings, err := loadSettings(profilePath)
+	if err != nil {
+		t.Fatalf("loadSettings() error = %v", err)
+	}
+
+	permissions := settings["permissions"].(map[string]interface{})
+	allow := permissions["allow"].([]interface{})
+	if len(allow) != 1 || allow[0] != "Bash(go test:*)" {
+		t.Errorf("allow = %v, want the profile's own allow list", allow)
+	}
+
+	deny := permissions["deny"].([]interface{})
+	if deny[0] != "Read(.env)" || len(deny) != 8 {
+		t.Errorf("deny = %v, want union of profile and template entries", deny)
+	}
+}
+
+func TestApplyTemplate_InvalidSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, ClaudeSettingsFile), []byte(`{not json`), 0644)
+
+	tm := NewTemplateManager()
+	if err := tm.ApplyTemplate(tmpDir, "restrictive"); err == nil {
+		t.Error("ApplyTemplate() should not overwrite an unparseable settings file")
+	}
+}
+
+func TestResolveTemplate_Extends(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	customDir := filepath.Join(tmpDir, ".cdp", "templates")
+	os.MkdirAll(customDir, 0755)
+	os.WriteFile(filepath.Join(customDir, "team.json"), []byte(`{
+		"extends": ["restrictive"],
+		"arrayMerge": {"permissions.ask": "replace"},
+		"model": "sonnet",
+		"permissions": {"ask": ["Bash(git push:*)"], "deny": ["Bash(ssh:*)"]}
+	}`), 0644)
+
+	tm := NewTemplateManager()
+	template, err := tm.ResolveTemplate("team")
+	if err != nil {
+		t.Fatalf("ResolveTemplate() error = %v", err)
+	}
+
+	if _, ok := template.Content["extends"]; ok {
+		t.Error("template keys should not be part of the content")
+	}
+	if template.Content["model"] != "sonnet" {
+		t.Errorf("model = %v, want sonnet", template.Content["model"])
+	}
+
+	permissions := template.Content["permissions"].(map[string]interface{})
+	if ask := permissions["ask"].([]interface{}); len(ask) != 1 {
+		t.Errorf("ask = %v, want replaced list with 1 entry", ask)
+	}
+	if deny := permissions["deny"].([]interface{}); len(deny) != 9 {
+		t.Errorf("deny = %v, want restrictive entries plus Bash(ssh:*)", deny)
+	}
+}
+
+func TestResolveTemplate_Cycle(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	customDir := filepath.Join(tmpDir, ".cdp", "templates")
+	os.MkdirAll(customDir, 0755)
+	os.WriteFile(filepath.Join(customDir, "a.json"), []byte(`{"extends": "b"}`), 0644)
+	os.WriteFile(filepath.Join(customDir, "b.json"), []byte(`{"extends": "a"}`), 0644)
+
+	tm := NewTemplateManager()
+	if _, err := tm.ResolveTemplate("a"); err == nil {
+		t.Error("ResolveTemplate() should detect inheritance cycles")
+	}
+}
+
+func TestProfileManagerApplyTemplate(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+	if err := pm.ApplyTemplate("work", "permissive"); err != nil {
+		t.Fatalf("ApplyTemplate() error = %v", err)
+	}
+
+	profile, _ := pm.GetProfile("work")
+	if profile.Metadata.Template != "permissive" {
+		t.Errorf("Template = %q, want permissive", profile.Metadata.Template)
+	}
+}
+
+func TestListTemplates_DescriptionsAndShadowing(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	customDir := filepath.Join(tmpDir, ".cdp", "templates")
+	os.MkdirAll(customDir, 0755)
+	os.WriteFile(filepath.Join(customDir, "permissive.json"), []byte(`{"description":"Team permissive"}`), 0644)
+	os.WriteFile(filepath.Join(customDir, "team.json"), []byte(`{"description":"Team"}`), 0644)
+
+	tm := NewTemplateManager()
+	templates, err := tm.ListTemplates()
+	if err != nil {
+		t.Fatalf("ListTemplates() error = %v", err)
+	}
+
+	byName := make(map[string]TemplateInfo)
+	for _, info := range templates {
+		if _, dup := byName[info.Name]; dup {
+			t.Errorf("ListTemplates() returned %q twice", info.Name)
+		}
+		byName[info.Name] = info
+	}
+
+	if info := byName["restrictive"]; info.Origin != OriginBuiltIn || info.Description == "" {
+		t.Errorf("restrictive = %+v, want built-in with description", info)
+	}
+	if info := byName["permissive"]; info.Origin != OriginCustom || !info.ShadowsBuiltIn || info.Description != "Team permissive" {
+		t.Errorf("permissive = %+v, want custom shadowing built-in", info)
+	}
+	if info := byName["team"]; info.Origin != OriginCustom || info.ShadowsBuiltIn {
+		t.Errorf("team = %+v, want custom without shadowing", info)
+	}
+}
+
+func TestCreateTemplateFromProfile(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+	profile, _ := pm.GetProfile("work")
+	os.WriteFile(filepath.Join(profile.Path, ClaudeSettingsFile), []byte(`{"model":"opus"}`), 0644)
+
+	tm := NewTemplateManager()
+	if err := tm.CreateTemplateFromProfile("team", profile.Path, "Team policy"); err != nil {
+		t.Fatalf("CreateTemplateFromProfile() error = %v", err)
+	}
+
+	template, err := tm.LoadTemplate("team")
+	if err != nil {
+		t.Fatalf("LoadTemplate() error = %v", err)
+	}
+	if template.Description != "Team policy" || template.Content["model"] != "opus" {
+		t.Errorf("template = %+v, want description and model from profile", template)
+	}
+
+	if err := tm.CreateTemplateFromProfile("team", profile.Path, ""); err == nil {
+		t.Error("CreateTemplateFromProfile() should not overwrite an existing template")
+	}
+}
+
+func TestSaveTemplate_Validation(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	tm := NewTemplateManager()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"description":"ok","extends":"restrictive"}`, false},
+		{"invalid json", `{"permissions": [}`, true},
+		{"unknown parent", `{"extends":"missing"}`, true},
+		{"self reference", `{"extends":"valid"}`, true},
+		{"bad strategy", `{"arrayMerge":"append"}`, true},
+		{"bad description", `{"description":42}`, true},
+		{"bad permission rules", `{"permissions":{"deny":"Bash(curl:*)"}}`, true},
+		{"odd permission rule", `{"permissions":{"deny":["Bash(curl:*"]}}`, false},
+		{"unknown setting", `{"futureSetting":true}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tm.SaveTemplate("valid", []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SaveTemplate(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	tm := NewTemplateManager()
+	tm.SaveTemplate("team", []byte(`{}`))
+
+	if err := tm.DeleteTemplate("team"); err != nil {
+		t.Fatalf("DeleteTemplate() error = %v", err)
+	}
+	if tm.TemplateExists("team") {
+		t.Error("template should be deleted")
+	}
+	if err := tm.DeleteTemplate("restrictive"); err == nil {
+		t.Error("DeleteTemplate() should refuse built-in templates")
+	}
+}
+
+func TestTemplates_RejectTraversal(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	tm := NewTemplateManager()
+	name := "../profiles/work/settings"
+	target := tm.customTemplatePath(name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte(`{"model":"opus"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := tm.ReadTemplateFile(name); err == nil {
+		t.Error("ReadTemplateFile() should reject a path as name")
+	}
+	if _, err := tm.LoadTemplate(name); err == nil {
+		t.Error("LoadTemplate() should reject a path as name")
+	}
+	if _, err := tm.ExportTemplate(name, false); err == nil {
+		t.Error("ExportTemplate() should reject a path as name")
+	}
+	if err := tm.CreateTemplateFromProfile(name, t.TempDir(), ""); err == nil {
+		t.Error("CreateTemplateFromProfile() should reject a path as name")
+	}
+	if err := tm.DeleteTemplate(name); err == nil {
+		t.Error("DeleteTemplate() should reject a path as name")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("file outside the templates directory is gone: %v", err)
+	}
+}
+
+func TestExportTemplate_Resolved(t *testing.T) {
+	tmpDir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", origHome)
+
+	tm := NewTemplateManager()
+	tm.SaveTemplate("team", []byte(`{"extends":"permissive","model":"opus"}`))
+
+	data, err := tm.ExportTemplate("team", true)
+	if err != nil {
+		t.Fatalf("ExportTemplate() error = %v", err)
+	}
+
+	exported, err := parseTemplate("exported", data)
+	if err != nil {
+		t.Fatalf("exported template does not parse: %v", err)
+	}
+	if len(exported.Extends) != 0 || exported.Content["permissions"] == nil || exported.Content["model"] != "opus" {
+		t.Errorf("exported = %+v, want self-contained content", exported)
+	}
+}
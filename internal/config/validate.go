@@ -0,0 +1,352 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed schema/settings.json
+var settingsSchemaJSON []byte
+
+// Severity of a validation issue
+type Severity string
+
+const (
+	// SeverityError marks settings Claude cannot use
+	SeverityError Severity = "error"
+	// SeverityWarning marks settings that are probably mistakes, such as unknown keys
+	SeverityWarning Severity = "warning"
+)
+
+// ValidationIssue is a single problem found in a profile or template
+type ValidationIssue struct {
+	// File is the file the issue was found in, if any
+	File string
+	// Path is the JSON path of the offending value, e.g. permissions.allow[2]
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+// String formats the issue as "file: path: message"
+func (i ValidationIssue) String() string {
+	var parts []string
+	if i.File != "" {
+		parts = append(parts, i.File)
+	}
+	if i.Path != "" {
+		parts = append(parts, i.Path)
+	}
+	parts = append(parts, i.Message)
+	return strings.Join(parts, ": ")
+}
+
+// ValidationIssues is a list of validation issues
+type ValidationIssues []ValidationIssue
+
+// HasErrors reports whether any issue is an error
+func (issues ValidationIssues) HasErrors() bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns only the issues with error severity
+func (issues ValidationIssues) Errors() ValidationIssues {
+	var errs ValidationIssues
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			errs = append(errs, issue)
+		}
+	}
+	return errs
+}
+
+// Err returns an error summarizing the error-level issues, or nil if there are none
+func (issues ValidationIssues) Err() error {
+	errs := issues.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(errs))
+	for i, issue := range errs {
+		lines[i] = issue.String()
+	}
+	return errors.New(strings.Join(lines, "; "))
+}
+
+// schemaNode is the subset of JSON Schema used to describe settings.json
+type schemaNode struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*schemaNode `json:"properties,omitempty"`
+	AdditionalProperties *schemaNode            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *schemaNode            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Defs                 map[string]*schemaNode `json:"$defs,omitempty"`
+}
+
+var settingsSchema = mustParseSchema(settingsSchemaJSON)
+
+func mustParseSchema(data []byte) *schemaNode {
+	var schema schemaNode
+	if err := json.Unmarshal(data, &schema); err != nil {
+		panic(fmt.Sprintf("invalid embedded settings schema: %v", err))
+	}
+	return &schema
+}
+
+// ValidateSettings checks decoded settings.json content against the settings schema.
+// Only values of the wrong type are errors. Unknown keys and values, missing
+// keys and odd permission rules are reported as warnings, since Claude adds
+// settings over time and accepts more than the schema knows about.
+func ValidateSettings(settings map[string]interface{}) ValidationIssues {
+	var issues ValidationIssues
+	validateNode(settingsSchema, settings, "", &issues)
+	return issues
+}
+
+// ValidateSettingsJSON parses and validates settings.json content.
+// Syntax errors are reported with their line and column.
+func ValidateSettingsJSON(data []byte) ValidationIssues {
+	var settings interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return ValidationIssues{{Message: describeJSONError(data, err), Severity: SeverityError}}
+	}
+
+	object, ok := settings.(map[string]interface{})
+	if !ok {
+		return ValidationIssues{{Message: "settings must be a JSON object", Severity: SeverityError}}
+	}
+
+	return ValidateSettings(object)
+}
+
+func validateNode(node *schemaNode, value interface{}, path string, issues *ValidationIssues) {
+	if node.Ref != "" {
+		node = resolveSchemaRef(node.Ref)
+	}
+
+	addError := func(format string, args ...interface{}) {
+		*issues = append(*issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...), Severity: SeverityError})
+	}
+	addWarning := func(format string, args ...interface{}) {
+		*issues = append(*issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...), Severity: SeverityWarning})
+	}
+
+	if node.Type != "" && !hasSchemaType(value, node.Type) {
+		addError("expected %s, got %s", node.Type, jsonTypeName(value))
+		return
+	}
+
+	if len(node.Enum) > 0 && !containsValue(node.Enum, value) {
+		allowed := make([]string, len(node.Enum))
+		for i, v := range node.Enum {
+			allowed[i] = fmt.Sprint(v)
+		}
+		addWarning("unknown value %v (known: %s)", formatSchemaValue(value), strings.Join(allowed, ", "))
+		return
+	}
+
+	if node.Minimum != nil {
+		if n, ok := value.(float64); ok && n < *node.Minimum {
+			addWarning("should be at least %v", *node.Minimum)
+		}
+	}
+
+	if node.Format == "permission-rule" {
+		if rule, ok := value.(string); ok {
+			if err := ValidatePermissionRule(rule); err != nil {
+				addWarning("%v", err)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range node.Required {
+			if _, ok := v[key]; !ok {
+				addWarning("missing key '%s'", key)
+			}
+		}
+		for _, key := range sortedKeys(v) {
+			childPath := joinPath(path, key)
+			if child, ok := node.Properties[key]; ok {
+				validateNode(child, v[key], childPath, issues)
+			} else if node.AdditionalProperties != nil {
+				validateNode(node.AdditionalProperties, v[key], childPath, issues)
+			} else if node.Properties != nil {
+				*issues = append(*issues, ValidationIssue{Path: childPath, Message: "unknown setting", Severity: SeverityWarning})
+			}
+		}
+	case []interface{}:
+		if node.Items != nil {
+			for i, item := range v {
+				validateNode(node.Items, item, fmt.Sprintf("%s[%d]", path, i), issues)
+			}
+		}
+	}
+}
+
+// resolveSchemaRef resolves a "#/$defs/name" reference in the settings schema
+func resolveSchemaRef(ref string) *schemaNode {
+	name := strings.TrimPrefix(ref, "#/$defs/")
+	if node, ok := settingsSchema.Defs[name]; ok {
+		return node
+	}
+	panic(fmt.Sprintf("settings schema: unknown reference %s", ref))
+}
+
+func hasSchemaType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	default:
+		return jsonTypeName(value) == schemaType
+	}
+}
+
+// jsonTypeName returns the JSON type of a decoded value
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func formatSchemaValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("'%s'", s)
+	}
+	return fmt.Sprint(value)
+}
+
+// Tool names such as Bash, WebFetch or mcp__github__create_issue
+var permissionToolPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// ValidatePermissionRule checks the syntax of a permission rule such as
+// "Edit", "Bash(git push:*)" or "Read(**/secrets/**)". It is a lint:
+// Claude accepts some rules it rejects, so settings validation only warns.
+func ValidatePermissionRule(rule string) error {
+	if strings.TrimSpace(rule) == "" {
+		return fmt.Errorf("permission rule cannot be empty")
+	}
+	if rule != strings.TrimSpace(rule) {
+		return fmt.Errorf("permission rule '%s' has surrounding whitespace", rule)
+	}
+
+	tool, specifier, hasSpecifier := strings.Cut(rule, "(")
+	if !permissionToolPattern.MatchString(tool) {
+		return fmt.Errorf("invalid tool name in permission rule '%s'", rule)
+	}
+	if !hasSpecifier {
+		if strings.Contains(rule, ")") {
+			return fmt.Errorf("unbalanced parentheses in permission rule '%s'", rule)
+		}
+		return nil
+	}
+
+	if !strings.HasSuffix(specifier, ")") {
+		return fmt.Errorf("permission rule '%s' must end with ')'", rule)
+	}
+	specifier = strings.TrimSuffix(specifier, ")")
+	if strings.TrimSpace(specifier) == "" {
+		return fmt.Errorf("empty specifier in permission rule '%s' (use '%s' to match every use)", rule, tool)
+	}
+	// Bash prefix matching is only supported at the end of a command
+	if tool == "Bash" {
+		if i := strings.Index(specifier, ":*"); i >= 0 && i != len(specifier)-2 {
+			return fmt.Errorf("':*' must be at the end of the command in permission rule '%s'", rule)
+		}
+	}
+
+	return nil
+}
+
+// CheckProfile validates a profile's files: the required files must exist
+// and parse, and settings.json must match the settings schema
+func (pm *ProfileManager) CheckProfile(profile *Profile) ValidationIssues {
+	if err := pm.ValidateProfile(profile); err != nil {
+		return ValidationIssues{{Message: err.Error(), Severity: SeverityError}}
+	}
+
+	var issues ValidationIssues
+	for _, file := range []string{MetadataFileName, ClaudeConfigFile, ClaudeSettingsFile} {
+		data, err := os.ReadFile(filepath.Join(profile.Path, file))
+		if err != nil {
+			issues = append(issues, ValidationIssue{File: file, Message: err.Error(), Severity: SeverityError})
+			continue
+		}
+
+		var fileIssues ValidationIssues
+		if file == ClaudeSettingsFile {
+			fileIssues = ValidateSettingsJSON(data)
+		} else if !json.Valid(data) {
+			var v interface{}
+			err := json.Unmarshal(data, &v)
+			fileIssues = ValidationIssues{{Message: describeJSONError(data, err), Severity: SeverityError}}
+		}
+
+		for _, issue := range fileIssues {
+			issue.File = file
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// describeJSONError adds the line and column to JSON syntax errors
+func describeJSONError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("invalid JSON: %v", err)
+	}
+
+	line, column := 1, 1
+	for _, b := range data[:min(int(syntaxErr.Offset), len(data))] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %v", line, column, err)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePermissionRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{"Edit", false},
+		{"Bash(git push:*)", false},
+		{"Read(**/secrets/**)", false},
+		{"Bash(rm:-rf *)", false},
+		{"mcp__github__create_issue", false},
+		{"WebFetch(domain:example.com)", false},
+		{`Bash(echo ")")`, false},
+		{"", true},
+		{" Edit", true},
+		{"Bash(", true},
+		{"Bash(git push:*", true},
+		{"Bash()", true},
+		{"Edit)", true},
+		{"Bash(git:* push)", true},
+		{"not a tool", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			err := ValidatePermissionRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePermissionRule(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	settings := decodeJSON(t, `{
+		"model": 42,
+		"cleanupPeriodDays": 1.5,
+		"env": {"DEBUG": true},
+		"permissions": {
+			"allow": ["Edit", "Bash(git push:*"],
+			"defaultMode": "yolo"
+		},
+		"hooks": {
+			"PreToolUse": [{"matcher": "Bash", "hooks": [{}]}],
+			"OnBoot": []
+		},
+		"futureSetting": true
+	}`)
+
+	issues := ValidateSettings(settings)
+
+	want := map[string]Severity{
+		"cleanupPeriodDays":            SeverityError,
+		"env.DEBUG":                    SeverityError,
+		"futureSetting":                SeverityWarning,
+		"hooks.OnBoot":                 SeverityWarning,
+		"hooks.PreToolUse[0].hooks[0]": SeverityWarning,
+		"model":                        SeverityError,
+		"permissions.allow[1]":         SeverityWarning,
+		"permissions.defaultMode":      SeverityWarning,
+	}
+
+	got := make(map[string]Severity)
+	for _, issue := range issues {
+		got[issue.Path] = issue.Severity
+	}
+
+	for path, severity := range want {
+		if got[path] != severity {
+			t.Errorf("issue at %s = %q, want %q (issues: %v)", path, got[path], severity, issues)
+		}
+	}
+	if len(issues) != len(want) {
+		t.Errorf("got %d issues, want %d: %v", len(issues), len(want), issues)
+	}
+	if !issues.HasErrors() {
+		t.Error("HasErrors() = false, want true")
+	}
+}
+
+func TestValidateSettings_AcceptedByClaude(t *testing.T) {
+	// Settings Claude accepts must never be errors, or cdp refuses to launch
+	settings := decodeJSON(t, `{
+		"permissions": {
+			"allow": ["Bash(echo \")\")", "Bash(git:* push)"],
+			"defaultMode": "someFutureMode"
+		},
+		"hooks": {
+			"Stop": [{"hooks": [{"type": "prompt", "prompt": "Is the task done?"}]}]
+		},
+		"statusLine": {"type": "script"}
+	}`)
+
+	issues := ValidateSettings(settings)
+	if issues.HasErrors() {
+		t.Errorf("HasErrors() = true, want only warnings: %v", issues.Errors())
+	}
+
+	got := make(map[string]bool)
+	for _, issue := range issues {
+		got[issue.Path] = true
+	}
+	for _, path := range []string{"permissions.allow[1]", "permissions.defaultMode", "statusLine", "statusLine.type"} {
+		if !got[path] {
+			t.Errorf("no warning at %s (issues: %v)", path, issues)
+		}
+	}
+	if got["hooks.Stop[0].hooks[0]"] {
+		t.Errorf("prompt hook reported: %v", issues)
+	}
+}
+
+func TestValidateSettings_BuiltInTemplates(t *testing.T) {
+	tm := NewTemplateManager()
+	for _, name := range []string{"restrictive", "permissive"} {
+		template, err := tm.LoadTemplate(name)
+		if err != nil {
+			t.Fatalf("LoadTemplate(%s) failed: %v", name, err)
+		}
+		if issues := ValidateSettings(template.Content); len(issues) > 0 {
+			t.Errorf("built-in template %s has issues: %v", name, issues)
+		}
+	}
+}
+
+func TestValidateSettingsJSON_SyntaxError(t *testing.T) {
+	issues := ValidateSettingsJSON([]byte("{\n  \"model\": \"opus\",\n}"))
+	if len(issues) != 1 || !issues.HasErrors() {
+		t.Fatalf("issues = %v, want one error", issues)
+	}
+	if !strings.Contains(issues[0].Message, "line 3") {
+		t.Errorf("message = %q, want line number", issues[0].Message)
+	}
+
+	issues = ValidateSettingsJSON([]byte(`["not", "an", "object"]`))
+	if !issues.HasErrors() {
+		t.Error("non-object settings should be an error")
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	_, pm, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	pm.CreateProfile("work", "")
+	profile, _ := pm.GetProfile("work")
+
+	if issues := pm.CheckProfile(profile); len(issues) > 0 {
+		t.Errorf("new profile has issues: %v", issues)
+	}
+
+	os.WriteFile(filepath.Join(profile.Path, ClaudeSettingsFile), []byte(`{"permissions":{"deny":["Read", 42]}}`), 0644)
+	os.WriteFile(filepath.Join(profile.Path, ClaudeConfigFile), []byte(`{`), 0644)
+
+	issues := pm.CheckProfile(profile)
+	files := make(map[string]bool)
+	for _, issue := range issues {
+		files[issue.File] = true
+	}
+	if !files[ClaudeSettingsFile] || !files[ClaudeConfigFile] {
+		t.Errorf("issues = %v, want errors for %s and %s", issues, ClaudeSettingsFile, ClaudeConfigFile)
+	}
+	if err := issues.Err(); err == nil || !strings.Contains(err.Error(), "permissions.deny[1]") {
+		t.Errorf("Err() = %v, want JSON path of the bad rule", err)
+	}
+
+	os.Remove(filepath.Join(profile.Path, MetadataFileName))
+	if issues := pm.CheckProfile(profile); !issues.HasErrors() {
+		t.Error("missing metadata should be an error")
+	}
+}
+
+func TestLoadTemplate_RejectsInvalidSettings(t *testing.T) {
+	_, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	setupCustomTemplate(t, "broken", `{"permissions":{"allow":"Edit"}}`)
+
+	_, err := NewTemplateManager().LoadTemplate("broken")
+	if err == nil || !strings.Contains(err.Error(), "permissions.allow") {
+		t.Errorf("LoadTemplate() error = %v, want schema error", err)
+	}
+}
@@ -0,0 +1,527 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/backup"
+	"github.com/tiagokriok/cdp/internal/config"
+	"github.com/tiagokriok/cdp/internal/executor"
+	"github.com/tiagokriok/cdp/pkg/aliases"
+	"github.com/tiagokriok/cdp/pkg/encryption"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusError   Status = "error"
+)
+
+// Result describes the outcome of a single check
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Fix describes the repair --fix applies, if the problem can be fixed safely
+	Fix string `json:"fix,omitempty"`
+	// Fixed is true when the problem was repaired during this run
+	Fixed bool `json:"fixed,omitempty"`
+}
+
+// Report is the outcome of a doctor run
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// HasErrors reports whether any check failed and was not fixed
+func (r *Report) HasErrors() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusError && !result.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// Options controls a doctor run
+type Options struct {
+	// Fix repairs the problems that can be repaired safely
+	Fix bool
+}
+
+type runner struct {
+	opts   Options
+	report *Report
+}
+
+// Run checks the cdp installation: the config, profiles, shell aliases,
+// the claude binary and backups
+func Run(opts Options) *Report {
+	r := &runner{opts: opts, report: &Report{}}
+
+	cfg := r.checkConfig()
+	if cfg != nil {
+		r.checkCurrentProfile(cfg)
+		r.checkProfiles(cfg)
+	}
+	r.checkAliases()
+	r.checkClaude()
+	r.checkBackups(cfg)
+
+	return r.report
+}
+
+func (r *runner) add(result Result) {
+	r.report.Results = append(r.report.Results, result)
+}
+
+// fix records a fixable problem and repairs it if --fix was given
+func (r *runner) fix(result Result, repair func() error) {
+	if r.opts.Fix {
+		if err := repair(); err != nil {
+			result.Message = fmt.Sprintf("%s (fix failed: %v)", result.Message, err)
+		} else {
+			result.Fixed = true
+		}
+	}
+	r.add(result)
+}
+
+// checkConfig checks config.yaml and returns it if it could be loaded
+func (r *runner) checkConfig() *config.Config {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		r.add(Result{Check: "config", Status: StatusError, Message: err.Error()})
+		return nil
+	}
+
+	if !config.Exists() {
+		r.fix(Result{
+			Check:   "config",
+			Status:  StatusError,
+			Message: fmt.Sprintf("%s not found", configPath),
+			Fix:     "create the default configuration (cdp init)",
+		}, config.Init)
+		if !config.Exists() {
+			return nil
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		r.add(Result{Check: "config", Status: StatusError, Message: err.Error()})
+		return nil
+	}
+	r.add(Result{Check: "config", Status: StatusOK, Message: fmt.Sprintf("%s is valid", configPath)})
+
+	switch cfg.Version {
+	case config.ConfigVersion:
+		r.add(Result{Check: "config version", Status: StatusOK, Message: fmt.Sprintf("version %s", cfg.Version)})
+	case "":
+		r.fix(Result{
+			Check:   "config version",
+			Status:  StatusWarning,
+			Message: "config.yaml has no version",
+			Fix:     fmt.Sprintf("set version to %s", config.ConfigVersion),
+		}, func() error {
+			return cfg.Update(func(latest *config.Config) {
+				if latest.Version == "" {
+					latest.Version = config.ConfigVersion
+				}
+			})
+		})
+	default:
+		r.add(Result{
+			Check:   "config version",
+			Status:  StatusError,
+			Message: fmt.Sprintf("unsupported config version %s (expected %s)", cfg.Version, config.ConfigVersion),
+		})
+	}
+
+	r.checkProfilesDir(cfg)
+	r.checkAutoBackup(cfg)
+	r.checkEncryption(cfg)
+	r.checkBackupTargets(cfg)
+	return cfg
+}
+
+// checkBackupTargets reports targets that scheduled backups could not reach
+func (r *runner) checkBackupTargets(cfg *config.Config) {
+	if len(cfg.BackupTargets) == 0 {
+		return
+	}
+	if err := cfg.ValidateBackupTargets(); err != nil {
+		r.add(Result{Check: "backup targets", Status: StatusError, Message: err.Error()})
+		return
+	}
+
+	names := make([]string, 0, len(cfg.BackupTargets))
+	for name := range cfg.BackupTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		target := cfg.BackupTargets[name]
+		switch target.Type {
+		case config.TargetDir:
+			if info, err := os.Stat(target.Dir()); err != nil || !info.IsDir() {
+				problems = append(problems, fmt.Sprintf("%s: %s is not a directory (not mounted?)", name, target.Dir()))
+			}
+		case config.TargetS3:
+			if _, _, err := target.Credentials(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		r.add(Result{Check: "backup targets", Status: StatusWarning, Message: strings.Join(problems, "; ")})
+		return
+	}
+	r.add(Result{Check: "backup targets", Status: StatusOK, Message: strings.Join(names, ", ")})
+}
+
+func (r *runner) checkEncryption(cfg *config.Config) {
+	if cfg.Encryption == nil {
+		return
+	}
+	keys, err := cfg.Encryption.Keys()
+	if err != nil {
+		r.add(Result{Check: "encryption", Status: StatusError, Message: err.Error()})
+		return
+	}
+
+	switch {
+	case len(keys.Recipients) > 0:
+		r.add(Result{Check: "encryption", Status: StatusOK, Message: fmt.Sprintf("backups and bundles are encrypted to %d recipient(s)", len(keys.Recipients))})
+	case cfg.Encryption.RequireForCredentials:
+		r.add(Result{
+			Check:   "encryption",
+			Status:  StatusWarning,
+			Message: "required for credentials but no recipients are set; every such backup needs a passphrase, so scheduled and automatic backups fail without CDP_PASSPHRASE",
+		})
+	default:
+		r.add(Result{Check: "encryption", Status: StatusOK, Message: "only with --encrypt"})
+	}
+}
+
+func (r *runner) checkAutoBackup(cfg *config.Config) {
+	if cfg.AutoBackup == nil {
+		return
+	}
+	if err := cfg.AutoBackup.Validate(); err != nil {
+		r.add(Result{Check: "auto backup", Status: StatusError, Message: err.Error()})
+		return
+	}
+	if !cfg.AutoBackup.Enabled {
+		r.add(Result{Check: "auto backup", Status: StatusOK, Message: "disabled"})
+		return
+	}
+
+	var covered []string
+	for _, op := range config.BackupOperations {
+		if cfg.AutoBackup.Covers(op) {
+			covered = append(covered, string(op))
+		}
+	}
+	r.add(Result{Check: "auto backup", Status: StatusOK, Message: "before " + strings.Join(covered, ", ")})
+}
+
+func (r *runner) checkProfilesDir(cfg *config.Config) {
+	if cfg.ProfilesDir == "" {
+		defaultDir, err := config.GetDefaultProfilesDir()
+		if err != nil {
+			r.add(Result{Check: "profiles directory", Status: StatusError, Message: err.Error()})
+			return
+		}
+		r.fix(Result{
+			Check:   "profiles directory",
+			Status:  StatusError,
+			Message: "config.yaml does not set profilesDir",
+			Fix:     fmt.Sprintf("set profilesDir to %s", defaultDir),
+		}, func() error {
+			return cfg.Update(func(latest *config.Config) {
+				if latest.ProfilesDir == "" {
+					latest.ProfilesDir = defaultDir
+				}
+			})
+		})
+		if cfg.ProfilesDir == "" {
+			return
+		}
+	}
+
+	info, err := os.Stat(cfg.ProfilesDir)
+	switch {
+	case os.IsNotExist(err):
+		r.fix(Result{
+			Check:   "profiles directory",
+			Status:  StatusError,
+			Message: fmt.Sprintf("%s does not exist", cfg.ProfilesDir),
+			Fix:     "create the profiles directory",
+		}, func() error {
+			return os.MkdirAll(cfg.ProfilesDir, 0755)
+		})
+	case err != nil:
+		r.add(Result{Check: "profiles directory", Status: StatusError, Message: err.Error()})
+	case !info.IsDir():
+		r.add(Result{Check: "profiles directory", Status: StatusError, Message: fmt.Sprintf("%s is not a directory", cfg.ProfilesDir)})
+	default:
+		r.add(Result{Check: "profiles directory", Status: StatusOK, Message: cfg.ProfilesDir})
+	}
+}
+
+func (r *runner) checkCurrentProfile(cfg *config.Config) {
+	if cfg.CurrentProfile == "" {
+		r.add(Result{Check: "current profile", Status: StatusOK, Message: "no profile is active"})
+		return
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.ProfilesDir, cfg.CurrentProfile)); err == nil {
+		r.add(Result{Check: "current profile", Status: StatusOK, Message: cfg.CurrentProfile})
+		return
+	}
+
+	r.fix(Result{
+		Check:   "current profile",
+		Status:  StatusWarning,
+		Message: fmt.Sprintf("current profile '%s' does not exist", cfg.CurrentProfile),
+		Fix:     "clear the current profile",
+	}, func() error {
+		return cfg.SetCurrentProfile("")
+	})
+}
+
+// checkProfiles checks every profile directory, including broken ones
+func (r *runner) checkProfiles(cfg *config.Config) {
+	entries, err := os.ReadDir(cfg.ProfilesDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.add(Result{Check: "profiles", Status: StatusError, Message: err.Error()})
+		}
+		return
+	}
+
+	pm := config.NewProfileManager(cfg)
+	checked := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if strings.HasPrefix(name, config.ImportStagingPrefix) {
+			r.checkImportStaging(cfg, entry)
+			continue
+		}
+		checked++
+
+		check := fmt.Sprintf("profile %s", name)
+		if err := config.ValidateName(name); err != nil {
+			r.add(Result{Check: check, Status: StatusWarning, Message: "directory name is not a valid profile name and is ignored"})
+			continue
+		}
+
+		profile := &config.Profile{Name: name, Path: filepath.Join(cfg.ProfilesDir, name)}
+		problems := profileFileProblems(pm, name, profile.Path)
+		if len(problems) > 0 {
+			r.fix(Result{
+				Check:   check,
+				Status:  StatusError,
+				Message: strings.Join(problems, "; "),
+				Fix:     fmt.Sprintf("rebuild metadata and recreate missing files (cdp repair %s)", name),
+			}, func() error {
+				_, err := pm.RepairProfile(name)
+				return err
+			})
+			if !r.opts.Fix {
+				continue
+			}
+		}
+
+		issues := pm.CheckProfile(profile).Errors()
+		if len(issues) > 0 {
+			messages := make([]string, len(issues))
+			for i, issue := range issues {
+				messages[i] = issue.String()
+			}
+			r.add(Result{Check: check, Status: StatusError, Message: strings.Join(messages, "; ")})
+			continue
+		}
+
+		if len(problems) == 0 {
+			r.add(Result{Check: check, Status: StatusOK, Message: "valid"})
+		}
+	}
+
+	if checked == 0 {
+		r.add(Result{Check: "profiles", Status: StatusOK, Message: "no profiles"})
+	}
+}
+
+// staleStagingAge is how old an import staging directory must be before it
+// is considered left behind by an interrupted import rather than in use
+const staleStagingAge = time.Hour
+
+// checkImportStaging reports an import staging directory left behind by an
+// interrupted import
+func (r *runner) checkImportStaging(cfg *config.Config, entry os.DirEntry) {
+	info, err := entry.Info()
+	if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+		return
+	}
+
+	path := filepath.Join(cfg.ProfilesDir, entry.Name())
+	r.fix(Result{
+		Check:   "import staging",
+		Status:  StatusWarning,
+		Message: fmt.Sprintf("%s was left behind by an interrupted import", path),
+		Fix:     "remove the staging directory",
+	}, func() error {
+		return os.RemoveAll(path)
+	})
+}
+
+// profileFileProblems describes missing profile files and unreadable metadata,
+// which RepairProfile can fix
+func profileFileProblems(pm *config.ProfileManager, name, profilePath string) []string {
+	var missing []string
+	for _, file := range []string{config.MetadataFileName, config.ClaudeConfigFile, config.ClaudeSettingsFile} {
+		if _, err := os.Stat(filepath.Join(profilePath, file)); os.IsNotExist(err) {
+			missing = append(missing, file)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing %s", strings.Join(missing, ", ")))
+	}
+	if _, err := os.Stat(filepath.Join(profilePath, config.MetadataFileName)); err == nil {
+		if _, err := pm.GetProfile(name); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is unreadable", config.MetadataFileName))
+		}
+	}
+	return problems
+}
+
+func (r *runner) checkAliases() {
+	am, err := aliases.New()
+	if err != nil {
+		r.add(Result{Check: "aliases", Status: StatusWarning, Message: fmt.Sprintf("cannot determine shell: %v", err)})
+		return
+	}
+
+	if err := am.CheckAliasBlock(); err != nil {
+		r.add(Result{Check: "aliases", Status: StatusError, Message: fmt.Sprintf("%v; fix the markers by hand", err)})
+		return
+	}
+
+	message := fmt.Sprintf("no aliases installed in %s", am.GetRCFile())
+	if am.IsInstalled() {
+		message = fmt.Sprintf("alias block in %s is intact", am.GetRCFile())
+	}
+	r.add(Result{Check: "aliases", Status: StatusOK, Message: message})
+}
+
+func (r *runner) checkClaude() {
+	path, err := executor.NewExecutor().FindClaude()
+	if err != nil {
+		r.add(Result{Check: "claude", Status: StatusError, Message: err.Error()})
+		return
+	}
+	r.add(Result{Check: "claude", Status: StatusOK, Message: path})
+
+	// A stale shim first in PATH breaks a bare 'claude', though not cdp
+	if found, err := exec.LookPath(aliases.ShimName); err == nil {
+		if shim, err := aliases.ReadShim(found); err == nil {
+			if _, err := os.Stat(shim.Claude); err != nil {
+				r.add(Result{Check: "claude shim", Status: StatusWarning, Message: fmt.Sprintf("%s runs %s, which no longer exists; run 'cdp shim install' again", shim.Path, shim.Claude)})
+			}
+		}
+	}
+}
+
+func (r *runner) checkBackups(cfg *config.Config) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		r.add(Result{Check: "backups", Status: StatusError, Message: err.Error()})
+		return
+	}
+
+	// Avoid creating the backup directory just to check it
+	if _, err := os.Stat(filepath.Join(configDir, "backups")); os.IsNotExist(err) {
+		r.add(Result{Check: "backups", Status: StatusOK, Message: "no backups"})
+		return
+	}
+
+	bm, err := backup.NewBackupManager("")
+	if err != nil {
+		r.add(Result{Check: "backups", Status: StatusError, Message: err.Error()})
+		return
+	}
+
+	requireEncryption := false
+	if cfg != nil && cfg.Encryption != nil {
+		requireEncryption = cfg.Encryption.RequireForCredentials
+		// A broken encryption config is reported by the encryption check
+		if keys, err := cfg.Encryption.Keys(); err == nil {
+			bm.SetEncryption(&config.ArchiveEncryption{Keys: keys.WithoutPassphrase()})
+		}
+	}
+
+	backups, err := bm.List()
+	if err != nil {
+		r.add(Result{Check: "backups", Status: StatusError, Message: err.Error()})
+		return
+	}
+
+	var broken, locked, exposed []string
+	for _, b := range backups {
+		// Verify also checks file hashes against the manifest
+		result, err := bm.Verify(b.Path)
+		if errors.Is(err, encryption.ErrNoKey) {
+			locked = append(locked, b.Name)
+			continue
+		}
+		if err != nil || !result.OK() {
+			broken = append(broken, b.Name)
+			continue
+		}
+		if requireEncryption && !b.Encrypted && result.Manifest != nil && result.Manifest.HasCredentialFiles() {
+			exposed = append(exposed, b.Name)
+		}
+	}
+
+	if len(exposed) > 0 {
+		r.add(Result{
+			Check:   "backup encryption",
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("%d backup(s) hold credentials unencrypted: %s", len(exposed), strings.Join(exposed, ", ")),
+		})
+	}
+
+	if len(broken) > 0 {
+		r.add(Result{
+			Check:   "backups",
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("%d of %d backup(s) failed verification: %s", len(broken), len(backups), strings.Join(broken, ", ")),
+		})
+		return
+	}
+	message := fmt.Sprintf("%d backup(s) verified", len(backups)-len(locked))
+	if len(locked) > 0 {
+		message += fmt.Sprintf(", %d encrypted backup(s) not checked (no key)", len(locked))
+	}
+	r.add(Result{Check: "backups", Status: StatusOK, Message: message})
+}
@@ -0,0 +1,282 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tiagokriok/cdp/internal/backup"
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+// setupTestEnv initializes cdp in a temporary home with a fake claude in PATH
+func setupTestEnv(t *testing.T) (*config.Config, *config.ProfileManager) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("SHELL", "/bin/bash")
+
+	binDir := filepath.Join(tmpDir, "bin")
+	os.MkdirAll(binDir, 0755)
+	os.WriteFile(filepath.Join(binDir, "claude"), []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", binDir)
+
+	if err := config.Init(); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	return cfg, config.NewProfileManager(cfg)
+}
+
+func findResult(report *Report, check string) *Result {
+	for i := range report.Results {
+		if report.Results[i].Check == check {
+			return &report.Results[i]
+		}
+	}
+	return nil
+}
+
+func TestRun_Healthy(t *testing.T) {
+	_, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+
+	report := Run(Options{})
+	if report.HasErrors() {
+		t.Errorf("healthy installation has errors: %+v", report.Results)
+	}
+	for _, result := range report.Results {
+		if result.Status != StatusOK {
+			t.Errorf("%s: status = %s (%s), want ok", result.Check, result.Status, result.Message)
+		}
+	}
+}
+
+func TestRun_NotInitialized(t *testing.T) {
+	setupTestEnv(t)
+	configPath, _ := config.GetConfigPath()
+	os.Remove(configPath)
+
+	report := Run(Options{})
+	result := findResult(report, "config")
+	if result == nil || result.Status != StatusError || result.Fix == "" {
+		t.Fatalf("config result = %+v, want fixable error", result)
+	}
+
+	report = Run(Options{Fix: true})
+	if report.HasErrors() {
+		t.Errorf("errors after --fix: %+v", report.Results)
+	}
+	if !config.Exists() {
+		t.Error("config was not created")
+	}
+}
+
+func TestRun_FixesDanglingCurrentProfileAndMissingFiles(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+	cfg.SetCurrentProfile("gone")
+
+	workPath := filepath.Join(cfg.ProfilesDir, "work")
+	os.Remove(filepath.Join(workPath, config.MetadataFileName))
+	os.Remove(filepath.Join(workPath, config.ClaudeSettingsFile))
+
+	report := Run(Options{})
+	if !report.HasErrors() {
+		t.Error("missing profile files should be an error")
+	}
+	if result := findResult(report, "current profile"); result == nil || result.Status != StatusWarning {
+		t.Errorf("current profile result = %+v, want warning", result)
+	}
+	// Checking alone must not change anything
+	if _, err := os.Stat(filepath.Join(workPath, config.MetadataFileName)); !os.IsNotExist(err) {
+		t.Error("doctor without --fix modified the profile")
+	}
+
+	report = Run(Options{Fix: true})
+	if report.HasErrors() {
+		t.Errorf("errors after --fix: %+v", report.Results)
+	}
+	if result := findResult(report, "profile work"); result == nil || !result.Fixed {
+		t.Errorf("profile result = %+v, want fixed", result)
+	}
+
+	reloaded, _ := config.Load()
+	if reloaded.CurrentProfile != "" {
+		t.Errorf("CurrentProfile = %q, want cleared", reloaded.CurrentProfile)
+	}
+	if _, err := pm.GetProfile("work"); err != nil {
+		t.Errorf("profile not repaired: %v", err)
+	}
+}
+
+func TestRun_FixesConfigVersionAndProfilesDir(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+	configPath, _ := config.GetConfigPath()
+	os.WriteFile(configPath, []byte("currentProfile: work\n"), 0644)
+
+	report := Run(Options{Fix: true})
+	for _, check := range []string{"config version", "profiles directory"} {
+		if result := findResult(report, check); result == nil || !result.Fixed {
+			t.Errorf("%s result = %+v, want fixed", check, result)
+		}
+	}
+
+	reloaded, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if reloaded.Version != config.ConfigVersion || reloaded.ProfilesDir != cfg.ProfilesDir {
+		t.Errorf("config = version %q, profilesDir %q; want %q, %q", reloaded.Version, reloaded.ProfilesDir, config.ConfigVersion, cfg.ProfilesDir)
+	}
+	if reloaded.CurrentProfile != "work" {
+		t.Errorf("CurrentProfile = %q, want it kept", reloaded.CurrentProfile)
+	}
+}
+
+func TestRun_RemovesStaleImportStaging(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+
+	stale := filepath.Join(cfg.ProfilesDir, config.ImportStagingPrefix+"work-123")
+	fresh := filepath.Join(cfg.ProfilesDir, config.ImportStagingPrefix+"work-456")
+	for _, dir := range []string{stale, fresh} {
+		os.MkdirAll(filepath.Join(dir, "work"), 0755)
+	}
+	old := time.Now().Add(-2 * staleStagingAge)
+	os.Chtimes(stale, old, old)
+
+	report := Run(Options{})
+	result := findResult(report, "import staging")
+	if result == nil || result.Status != StatusWarning || !strings.Contains(result.Message, stale) {
+		t.Fatalf("import staging result = %+v, want warning about %s", result, stale)
+	}
+	if findResult(report, "profile "+filepath.Base(stale)) != nil || findResult(report, "profile "+filepath.Base(fresh)) != nil {
+		t.Errorf("a staging directory was reported as a profile: %+v", report.Results)
+	}
+
+	report = Run(Options{Fix: true})
+	if result := findResult(report, "import staging"); result == nil || !result.Fixed {
+		t.Errorf("import staging result = %+v, want fixed", result)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale staging directory still exists: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("an import in progress was removed: %v", err)
+	}
+}
+
+func TestRun_FixesBrokenMetadata(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+	os.WriteFile(filepath.Join(cfg.ProfilesDir, "work", config.MetadataFileName), []byte("{"), 0644)
+
+	report := Run(Options{})
+	if result := findResult(report, "profile work"); result == nil || result.Status != StatusError || result.Fix == "" {
+		t.Fatalf("profile result = %+v, want fixable error", result)
+	}
+
+	report = Run(Options{Fix: true})
+	if report.HasErrors() {
+		t.Errorf("errors after --fix: %+v", report.Results)
+	}
+	if _, err := pm.GetProfile("work"); err != nil {
+		t.Errorf("profile not repaired: %v", err)
+	}
+}
+
+func TestRun_ReportsUnfixableProblems(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+
+	os.WriteFile(filepath.Join(cfg.ProfilesDir, "work", config.ClaudeConfigFile), []byte("{"), 0644)
+	os.WriteFile(filepath.Join(os.Getenv("HOME"), ".bashrc"), []byte("# cdp-aliases-start\n"), 0644)
+
+	backupDir := filepath.Join(os.Getenv("HOME"), ".cdp", "backups")
+	os.MkdirAll(backupDir, 0755)
+	os.WriteFile(filepath.Join(backupDir, "work-20240101-000000.tar.gz"), []byte("garbage"), 0644)
+
+	t.Setenv("PATH", t.TempDir())
+
+	report := Run(Options{Fix: true})
+
+	want := map[string]Status{
+		"profile work": StatusError,
+		"aliases":      StatusError,
+		"backups":      StatusWarning,
+	}
+	for check, status := range want {
+		result := findResult(report, check)
+		if result == nil || result.Status != status || result.Fixed {
+			t.Errorf("%s result = %+v, want unfixed %s", check, result, status)
+		}
+	}
+	if !report.HasErrors() {
+		t.Error("HasErrors() = false, want true")
+	}
+
+	// The broken files are left alone
+	data, _ := os.ReadFile(filepath.Join(cfg.ProfilesDir, "work", config.ClaudeConfigFile))
+	if string(data) != "{" {
+		t.Errorf("broken file was modified: %q", data)
+	}
+}
+
+func TestRun_ReportsUnencryptedCredentialBackups(t *testing.T) {
+	cfg, pm := setupTestEnv(t)
+	pm.CreateProfile("work", "")
+
+	bm, err := backup.NewBackupManager(cfg.ProfilesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bm.Backup("work"); err != nil {
+		t.Fatalf("Backup() failed: %v", err)
+	}
+
+	cfg.Encryption = &config.EncryptionPolicy{RequireForCredentials: true}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	report := Run(Options{})
+	if result := findResult(report, "backup encryption"); result == nil || result.Status != StatusWarning {
+		t.Errorf("backup encryption result = %+v, want a warning", result)
+	}
+	if result := findResult(report, "encryption"); result == nil || result.Status != StatusWarning {
+		t.Errorf("encryption result = %+v, want a warning without recipients", result)
+	}
+}
+
+func TestRun_ChecksBackupTargets(t *testing.T) {
+	cfg, _ := setupTestEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+
+	cfg.BackupTargets = map[string]config.BackupTarget{
+		"nas":     {Type: config.TargetDir, Path: t.TempDir()},
+		"offsite": {Type: config.TargetS3, Endpoint: "http://127.0.0.1:9000", Bucket: "backups"},
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	report := Run(Options{})
+	if result := findResult(report, "backup targets"); result == nil || result.Status != StatusWarning {
+		t.Errorf("backup targets result = %+v, want a warning without credentials", result)
+	}
+
+	cfg.BackupTargets["broken"] = config.BackupTarget{Type: "ftp"}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	report = Run(Options{})
+	if result := findResult(report, "backup targets"); result == nil || result.Status != StatusError {
+		t.Errorf("backup targets result = %+v, want an error", result)
+	}
+}
@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tiagokriok/cdp/internal/config"
+)
+
+const (
+	// ActivateFileEnv names the file the shell hook sources after cdp exits.
+	// Commands that activate a profile write their shell code there.
+	ActivateFileEnv = "CDP_ACTIVATE_FILE"
+	// ShellEnv names the shell the hook was installed in
+	ShellEnv = "CDP_SHELL"
+
+	// activeVarsEnv lists the variables changed by the active profile
+	activeVarsEnv = "_CDP_ACTIVE_VARS"
+	// savedEnvPrefix prefixes the values those variables had before
+	savedEnvPrefix = "_CDP_SAVED_"
+)
+
+// hookEnv holds the variables the shell hook passes to a single cdp run.
+// They never reach Claude or the shell itself.
+var hookEnv = map[string]bool{
+	ActivateFileEnv: true,
+	ShellEnv:        true,
+}
+
+// EnvChange is a change to the environment of a shell: a variable to set,
+// or to remove when Unset is true
+type EnvChange struct {
+	Key   string
+	Value string
+	Unset bool
+}
+
+// Activate returns the changes that give a shell with the environment
+// environ the environment Claude gets with the given profile. The profile
+// active in the shell, if any, is deactivated first. What the changes
+// replace is saved in the environment, so Deactivate can restore it.
+// Profile variables with invalid names are left out and returned, since
+// their names end up in shell code.
+func Activate(environ []string, profilePath string, set map[string]string, unset []string) ([]EnvChange, []string) {
+	set, unset, dropped := validProfileEnv(set, unset)
+
+	base := envMap(InactiveEnv(environ))
+	target := envMap(BuildEnv(InactiveEnv(environ), profilePath, set, unset))
+
+	var managed []string
+	for key, value := range target {
+		if old, ok := base[key]; !ok || old != value {
+			managed = append(managed, key)
+		}
+	}
+	for key := range base {
+		if _, ok := target[key]; !ok && !hookEnv[key] {
+			managed = append(managed, key)
+		}
+	}
+	sort.Strings(managed)
+
+	for _, key := range managed {
+		if old, ok := base[key]; ok {
+			target[savedEnvPrefix+key] = old
+		}
+	}
+	target[activeVarsEnv] = strings.Join(managed, " ")
+
+	return diffEnv(envMap(environ), target), dropped
+}
+
+// validProfileEnv splits off the profile variables whose names
+// config.ValidateEnvName refuses. Profiles from bundles, backups or edited
+// metadata never went through 'cdp env set'.
+func validProfileEnv(set map[string]string, unset []string) (map[string]string, []string, []string) {
+	var dropped []string
+	validSet := make(map[string]string, len(set))
+	for key, value := range set {
+		if config.ValidateEnvName(key) != nil {
+			dropped = append(dropped, key)
+			continue
+		}
+		validSet[key] = value
+	}
+	var validUnset []string
+	for _, key := range unset {
+		if config.ValidateEnvName(key) != nil {
+			dropped = append(dropped, key)
+			continue
+		}
+		validUnset = append(validUnset, key)
+	}
+	sort.Strings(dropped)
+	return validSet, validUnset, dropped
+}
+
+// Deactivate returns the changes that undo the profile active in a shell
+// with the environment environ, or nil if none is
+func Deactivate(environ []string) []EnvChange {
+	return diffEnv(envMap(environ), envMap(InactiveEnv(environ)))
+}
+
+// ActiveProfile returns the name of the profile active in a shell with the
+// environment environ, or "" if none is
+func ActiveProfile(environ []string) string {
+	env := envMap(environ)
+	if _, ok := env[activeVarsEnv]; !ok {
+		return ""
+	}
+	return env["CLAUDE_PROFILE"]
+}
+
+// InactiveEnv returns environ as it was before the active profile was
+// activated
+func InactiveEnv(environ []string) []string {
+	env := envMap(environ)
+	managed, ok := env[activeVarsEnv]
+	if !ok {
+		return environ
+	}
+
+	keys := strings.Fields(managed)
+	sort.Strings(keys)
+	restore := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		restore[key] = true
+	}
+
+	result := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if restore[key] || key == activeVarsEnv || strings.HasPrefix(key, savedEnvPrefix) {
+			continue
+		}
+		result = append(result, kv)
+	}
+	for _, key := range keys {
+		if old, ok := env[savedEnvPrefix+key]; ok {
+			result = append(result, key+"="+old)
+		}
+	}
+	return result
+}
+
+// diffEnv returns the changes that turn the environment from into to
+func diffEnv(from, to map[string]string) []EnvChange {
+	var changes []EnvChange
+	for _, key := range sortedKeys(to) {
+		if old, ok := from[key]; (!ok || old != to[key]) && !hookEnv[key] {
+			changes = append(changes, EnvChange{Key: key, Value: to[key]})
+		}
+	}
+	for _, key := range sortedKeys(from) {
+		if _, ok := to[key]; !ok && !hookEnv[key] {
+			changes = append(changes, EnvChange{Key: key, Unset: true})
+		}
+	}
+	return changes
+}
+
+func envMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// applyChanges applies changes to an environment the way a shell would
+func applyChanges(environ []string, changes []EnvChange) []string {
+	env := envMap(environ)
+	for _, c := range changes {
+		if c.Unset {
+			delete(env, c.Key)
+		} else {
+			env[c.Key] = c.Value
+		}
+	}
+	result := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		result = append(result, key+"="+env[key])
+	}
+	return result
+}
+
+func sortedEnv(environ []string) []string {
+	result := append([]string(nil), environ...)
+	sort.Strings(result)
+	return result
+}
+
+func TestActivate(t *testing.T) {
+	shell := []string{
+		"HOME=/home/user",
+		"HTTPS_PROXY=http://old:3128",
+		"ANTHROPIC_API_KEY=secret",
+		"CDP_ACTIVATE_FILE=/tmp/cdp-activate.abc",
+	}
+
+	changes, dropped := Activate(shell, "/profiles/work", map[string]string{
+		"HTTPS_PROXY": "http://proxy.corp:8080",
+		"CERTS":       "${HOME}/certs",
+	}, []string{"ANTHROPIC_API_KEY"})
+	if dropped != nil {
+		t.Errorf("Activate() dropped %v", dropped)
+	}
+	for _, c := range changes {
+		if c.Key == ActivateFileEnv {
+			t.Errorf("Activate() changes the hook variable: %+v", c)
+		}
+	}
+
+	work := applyChanges(shell, changes)
+	env := envMap(work)
+	if env["CLAUDE_CONFIG_DIR"] != "/profiles/work" || env["CLAUDE_PROFILE"] != "work" ||
+		env["HTTPS_PROXY"] != "http://proxy.corp:8080" || env["CERTS"] != "/home/user/certs" {
+		t.Errorf("activated environment = %v", work)
+	}
+	if _, ok := env["ANTHROPIC_API_KEY"]; ok {
+		t.Error("Activate() kept a variable the profile unsets")
+	}
+	if got := ActiveProfile(work); got != "work" {
+		t.Errorf("ActiveProfile() = %q, want work", got)
+	}
+
+	// Activating another profile starts from the original environment
+	changes, _ = Activate(work, "/profiles/personal", nil, nil)
+	personal := applyChanges(work, changes)
+	env = envMap(personal)
+	if env["CLAUDE_PROFILE"] != "personal" || env["HTTPS_PROXY"] != "http://old:3128" || env["ANTHROPIC_API_KEY"] != "secret" {
+		t.Errorf("environment after switching = %v", personal)
+	}
+	if _, ok := env["CERTS"]; ok {
+		t.Error("the previous profile's variable leaked")
+	}
+
+	restored := applyChanges(personal, Deactivate(personal))
+	if !reflect.DeepEqual(restored, sortedEnv(shell)) {
+		t.Errorf("Deactivate() =\n%v\nwant\n%v", restored, sortedEnv(shell))
+	}
+	if ActiveProfile(restored) != "" || Deactivate(restored) != nil {
+		t.Error("a deactivated shell still has an active profile")
+	}
+}
+
+func TestInactiveEnv(t *testing.T) {
+	shell := []string{"PATH=/usr/bin", "CLAUDE_CONFIG_DIR=/elsewhere"}
+	changes, _ := Activate(shell, "/profiles/work", map[string]string{"A": "1"}, nil)
+	work := applyChanges(shell, changes)
+
+	if got := sortedEnv(InactiveEnv(work)); !reflect.DeepEqual(got, sortedEnv(shell)) {
+		t.Errorf("InactiveEnv() = %v, want %v", got, sortedEnv(shell))
+	}
+	if got := InactiveEnv(shell); !reflect.DeepEqual(got, shell) {
+		t.Errorf("InactiveEnv() without a profile = %v", got)
+	}
+}
+
+func TestActivate_DropsInvalidNames(t *testing.T) {
+	hostile := "X;touch /tmp/cdp-pwned;Y"
+	changes, dropped := Activate([]string{"HOME=/home/user"}, "/profiles/work",
+		map[string]string{hostile: "v", "OK": "1"}, []string{"$(reboot)"})
+
+	if !reflect.DeepEqual(dropped, []string{"$(reboot)", hostile}) {
+		t.Errorf("dropped = %v", dropped)
+	}
+	for _, c := range changes {
+		if strings.Contains(c.Key, ";") || strings.Contains(c.Value, ";") || strings.Contains(c.Key, "$(") {
+			t.Errorf("Activate() kept an invalid name: %+v", c)
+		}
+	}
+	if env := envMap(applyChanges(nil, changes)); env["OK"] != "1" {
+		t.Errorf("activated environment = %v, want OK=1", env)
+	}
+}
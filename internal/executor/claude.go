@@ -5,11 +5,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/tiagokriok/cdp/pkg/aliases"
 )
 
 // Executor handles execution of Claude Code
 type Executor struct {
 	claudePath string
+	envSet     map[string]string
+	envUnset   []string
 }
 
 // NewExecutor creates a new executor
@@ -28,13 +32,9 @@ func (e *Executor) Run(profilePath string, flags []string) error {
 	// Build command
 	cmd := exec.Command(claudePath, flags...)
 
-	// Set environment variables
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, fmt.Sprintf("CLAUDE_CONFIG_DIR=%s", profilePath))
-
-	// Extract profile name from path
-	profileName := filepath.Base(profilePath)
-	cmd.Env = append(cmd.Env, fmt.Sprintf("CLAUDE_PROFILE=%s", profileName))
+	// Set environment variables. A profile activated in the shell does not
+	// leak into another one.
+	cmd.Env = BuildEnv(InactiveEnv(os.Environ()), profilePath, e.envSet, e.envUnset)
 
 	// Inherit stdio
 	cmd.Stdin = os.Stdin
@@ -54,17 +54,29 @@ func (e *Executor) Run(profilePath string, flags []string) error {
 	return nil
 }
 
-// findClaude locates the Claude executable
+// FindClaude returns the path of the Claude executable that Run would use
+func (e *Executor) FindClaude() (string, error) {
+	return e.findClaude()
+}
+
+// findClaude locates the Claude executable. The shim installed by 'cdp shim'
+// is skipped, so cdp and the shim itself always get the real claude.
 func (e *Executor) findClaude() (string, error) {
 	if e.claudePath != "" {
 		return e.claudePath, nil
 	}
 
 	// Try to find claude in PATH first
-	claudePath, err := exec.LookPath("claude")
-	if err == nil {
-		e.claudePath = claudePath
-		return claudePath, nil
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		// Like exec.LookPath, never run claude from a relative directory
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		claudePath, err := exec.LookPath(filepath.Join(dir, "claude"))
+		if err == nil && !aliases.IsShim(claudePath) {
+			e.claudePath = claudePath
+			return claudePath, nil
+		}
 	}
 
 	// Fallback: search in common locations
@@ -82,7 +94,7 @@ func (e *Executor) findClaude() (string, error) {
 	}
 
 	for _, location := range commonLocations {
-		if _, err := os.Stat(location); err == nil {
+		if _, err := os.Stat(location); err == nil && !aliases.IsShim(location) {
 			e.claudePath = location
 			return location, nil
 		}
@@ -95,3 +107,10 @@ func (e *Executor) findClaude() (string, error) {
 func (e *Executor) SetClaudePath(path string) {
 	e.claudePath = path
 }
+
+// SetProfileEnv sets the profile environment variables to add and remove
+// when running Claude
+func (e *Executor) SetProfileEnv(set map[string]string, unset []string) {
+	e.envSet = set
+	e.envUnset = unset
+}
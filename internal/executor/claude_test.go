@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/tiagokriok/cdp/pkg/aliases"
 )
 
 func TestNewExecutor(t *testing.T) {
@@ -73,6 +75,33 @@ func TestFindClaude_InPath(t *testing.T) {
 	}
 }
 
+func TestFindClaude_SkipsShim(t *testing.T) {
+	e := NewExecutor()
+
+	// The real claude comes after a shim in PATH
+	realDir := t.TempDir()
+	claudePath := filepath.Join(realDir, "claude")
+	if err := os.WriteFile(claudePath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create temp claude: %v", err)
+	}
+	shimDir := t.TempDir()
+	if _, err := aliases.InstallShim(shimDir, claudePath, filepath.Join(t.TempDir(), "config.yaml")); err != nil {
+		t.Skipf("cannot install shim: %v", err)
+	}
+
+	originalPath := os.Getenv("PATH")
+	os.Setenv("PATH", shimDir+string(os.PathListSeparator)+realDir)
+	defer os.Setenv("PATH", originalPath)
+
+	path, err := e.findClaude()
+	if err != nil {
+		t.Fatalf("findClaude() error = %v, want nil", err)
+	}
+	if path != claudePath {
+		t.Errorf("findClaude() = %q, want %q", path, claudePath)
+	}
+}
+
 func TestFindClaude_CommonLocations(t *testing.T) {
 	e := NewExecutor()
 
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envRefPattern matches the ${VAR} references expanded in profile values,
+// and $$, which stands for a literal $
+var envRefPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// BuildEnv builds the environment for a Claude process running with the given profile.
+// Variables in unset and set are removed from the parent environment, the set
+// values are expanded against the parent environment (see expandEnv), and
+// CLAUDE_CONFIG_DIR and CLAUDE_PROFILE are added last. Variables of the shell
+// hook are dropped.
+func BuildEnv(parent []string, profilePath string, set map[string]string, unset []string) []string {
+	lookup := make(map[string]string)
+	for _, kv := range parent {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			lookup[key] = value
+		}
+	}
+
+	remove := map[string]bool{
+		"CLAUDE_CONFIG_DIR": true,
+		"CLAUDE_PROFILE":    true,
+	}
+	for _, key := range unset {
+		remove[key] = true
+	}
+	for key := range set {
+		remove[key] = true
+	}
+	for key := range hookEnv {
+		remove[key] = true
+	}
+
+	env := make([]string, 0, len(parent)+len(set)+2)
+	for _, kv := range parent {
+		key, _, _ := strings.Cut(kv, "=")
+		if remove[key] {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	// Add profile variables in a stable order
+	for _, key := range sortedKeys(set) {
+		env = append(env, fmt.Sprintf("%s=%s", key, expandEnv(set[key], lookup)))
+	}
+
+	env = append(env, fmt.Sprintf("CLAUDE_CONFIG_DIR=%s", profilePath))
+	env = append(env, fmt.Sprintf("CLAUDE_PROFILE=%s", filepath.Base(profilePath)))
+
+	return env
+}
+
+// expandEnv replaces ${VAR} in value with the variable from lookup, and $$
+// with $. Any other $ is kept, so passwords and tokens containing one
+// survive.
+func expandEnv(value string, lookup map[string]string) string {
+	return envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		return lookup[ref[2:len(ref)-1]]
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
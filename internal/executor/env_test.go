@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildEnv(t *testing.T) {
+	parent := []string{
+		"HOME=/home/user",
+		"PATH=/usr/bin",
+		"HTTPS_PROXY=http://old:3128",
+		"ANTHROPIC_API_KEY=secret",
+		"CLAUDE_CONFIG_DIR=/somewhere/else",
+	}
+	set := map[string]string{
+		"HTTPS_PROXY":         "http://proxy.corp:8080",
+		"NODE_EXTRA_CA_CERTS": "${HOME}/certs/corp.pem",
+	}
+	unset := []string{"ANTHROPIC_API_KEY"}
+
+	got := BuildEnv(parent, "/profiles/work", set, unset)
+	want := []string{
+		"HOME=/home/user",
+		"PATH=/usr/bin",
+		"HTTPS_PROXY=http://proxy.corp:8080",
+		"NODE_EXTRA_CA_CERTS=/home/user/certs/corp.pem",
+		"CLAUDE_CONFIG_DIR=/profiles/work",
+		"CLAUDE_PROFILE=work",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildEnv() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestBuildEnv_MissingVariableExpandsEmpty(t *testing.T) {
+	got := BuildEnv(nil, "/profiles/p", map[string]string{"URL": "${MISSING}/v1"}, nil)
+	if got[0] != "URL=/v1" {
+		t.Errorf("BuildEnv()[0] = %q, want %q", got[0], "URL=/v1")
+	}
+}
+
+func TestBuildEnv_LiteralDollar(t *testing.T) {
+	parent := []string{"HOME=/home/user", "PASS=leaked"}
+	set := map[string]string{
+		"PASSWORD": "pa$$word$PASS",
+		"SCHEMA":   "$schema",
+		"ESCAPED":  "$${HOME} is ${HOME}",
+		"PRICE":    "5$",
+	}
+
+	got := envMap(BuildEnv(parent, "/profiles/p", set, nil))
+	want := map[string]string{
+		"PASSWORD": "pa$word$PASS",
+		"SCHEMA":   "$schema",
+		"ESCAPED":  "${HOME} is /home/user",
+		"PRICE":    "5$",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestSetProfileEnv(t *testing.T) {
+	e := NewExecutor()
+	e.SetProfileEnv(map[string]string{"A": "1"}, []string{"B"})
+
+	if e.envSet["A"] != "1" || len(e.envUnset) != 1 {
+		t.Errorf("SetProfileEnv() did not store env: %v %v", e.envSet, e.envUnset)
+	}
+}
@@ -0,0 +1,161 @@
+// Package shellenv writes the shell code that activates a profile in the
+// user's shell, and the hook that evaluates it
+package shellenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/tiagokriok/cdp/internal/executor"
+)
+
+// Shell is a shell cdp writes code for
+type Shell string
+
+const (
+	Bash       Shell = "bash"
+	Zsh        Shell = "zsh"
+	Fish       Shell = "fish"
+	PowerShell Shell = "powershell"
+)
+
+// Shells lists the supported shells
+var Shells = []Shell{Bash, Zsh, Fish, PowerShell}
+
+// namePattern matches the variable names Script writes; anything else
+// could inject code into the shell
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parse returns the shell with this name. "pwsh" is PowerShell.
+func Parse(name string) (Shell, error) {
+	switch strings.ToLower(name) {
+	case "bash", "sh":
+		return Bash, nil
+	case "zsh":
+		return Zsh, nil
+	case "fish":
+		return Fish, nil
+	case "powershell", "pwsh":
+		return PowerShell, nil
+	}
+	return "", fmt.Errorf("unsupported shell '%s'; use bash, zsh, fish or powershell", name)
+}
+
+// Detect returns the shell the hook was installed in, or else the login
+// shell from $SHELL. It falls back to PowerShell on Windows and bash
+// elsewhere.
+func Detect() Shell {
+	if shell, err := Parse(os.Getenv(executor.ShellEnv)); err == nil {
+		return shell
+	}
+	if shell, err := Parse(filepath.Base(os.Getenv("SHELL"))); err == nil {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		return PowerShell
+	}
+	return Bash
+}
+
+// Script returns the code that applies changes to the environment. Changes
+// to variables with invalid names are skipped.
+func (s Shell) Script(changes []executor.EnvChange) string {
+	var b strings.Builder
+	for _, c := range changes {
+		if !namePattern.MatchString(c.Key) {
+			continue
+		}
+		switch s {
+		case Fish:
+			if c.Unset {
+				fmt.Fprintf(&b, "set -e %s;\n", c.Key)
+			} else {
+				fmt.Fprintf(&b, "set -gx %s %s;\n", c.Key, fishQuote(c.Value))
+			}
+		case PowerShell:
+			if c.Unset {
+				fmt.Fprintf(&b, "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", c.Key)
+			} else {
+				fmt.Fprintf(&b, "$env:%s = %s\n", c.Key, powerShellQuote(c.Value))
+			}
+		default:
+			if c.Unset {
+				fmt.Fprintf(&b, "unset %s;\n", c.Key)
+			} else {
+				fmt.Fprintf(&b, "export %s=%s;\n", c.Key, posixQuote(c.Value))
+			}
+		}
+	}
+	return b.String()
+}
+
+// Hook returns the code that defines a cdp function calling executable.
+// The function gives cdp a file to write shell code to, and evaluates it
+// once cdp exits, so activating a profile changes the calling shell.
+func (s Shell) Hook(executable string) string {
+	switch s {
+	case Fish:
+		return fmt.Sprintf(`function cdp
+    set -l cdp_file (mktemp -t cdp-activate.XXXXXX); or return
+    %s=fish %s=$cdp_file %s $argv
+    set -l cdp_status $status
+    if test -s $cdp_file
+        source $cdp_file
+    end
+    rm -f $cdp_file
+    return $cdp_status
+end
+`, executor.ShellEnv, executor.ActivateFileEnv, fishQuote(executable))
+	case PowerShell:
+		return fmt.Sprintf(`function cdp {
+    $cdpFile = (New-TemporaryFile).FullName
+    $env:%[1]s = 'powershell'
+    $env:%[2]s = $cdpFile
+    try {
+        & %[3]s @args
+        $cdpStatus = $LASTEXITCODE
+    } finally {
+        Remove-Item Env:%[1]s, Env:%[2]s -ErrorAction SilentlyContinue
+    }
+    if ((Get-Item $cdpFile).Length -gt 0) {
+        Invoke-Expression (Get-Content -Raw $cdpFile)
+    }
+    Remove-Item $cdpFile -ErrorAction SilentlyContinue
+    $global:LASTEXITCODE = $cdpStatus
+}
+`, executor.ShellEnv, executor.ActivateFileEnv, powerShellQuote(executable))
+	default:
+		return fmt.Sprintf(`cdp() {
+  local cdp_file cdp_status
+  cdp_file="$(mktemp -t cdp-activate.XXXXXX)" || return
+  %s=%s %s="$cdp_file" %s "$@"
+  cdp_status=$?
+  if [ -s "$cdp_file" ]; then
+    . "$cdp_file"
+  fi
+  rm -f "$cdp_file"
+  return $cdp_status
+}
+`, executor.ShellEnv, s, executor.ActivateFileEnv, posixQuote(executable))
+	}
+}
+
+// posixQuote quotes s for bash and zsh
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes s for fish, where backslashes escape inside quotes
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// powerShellQuote quotes s for PowerShell
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
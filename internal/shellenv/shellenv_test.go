@@ -0,0 +1,104 @@
+package shellenv
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/tiagokriok/cdp/internal/executor"
+)
+
+func TestParse(t *testing.T) {
+	for name, want := range map[string]Shell{"bash": Bash, "ZSH": Zsh, "fish": Fish, "pwsh": PowerShell} {
+		if got, err := Parse(name); err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := Parse("tcsh"); err == nil {
+		t.Error("Parse() accepted an unsupported shell")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv(executor.ShellEnv, "")
+	t.Setenv("SHELL", "/usr/local/bin/fish")
+	if got := Detect(); got != Fish {
+		t.Errorf("Detect() = %q, want fish from $SHELL", got)
+	}
+	t.Setenv(executor.ShellEnv, "zsh")
+	if got := Detect(); got != Zsh {
+		t.Errorf("Detect() = %q, want the hook's shell", got)
+	}
+}
+
+func TestScript(t *testing.T) {
+	changes := []executor.EnvChange{
+		{Key: "QUOTE", Value: `it's a \ test`},
+		{Key: "GONE", Unset: true},
+	}
+
+	tests := map[Shell]string{
+		Bash:       "export QUOTE='it'\\''s a \\ test';\nunset GONE;\n",
+		Fish:       "set -gx QUOTE 'it\\'s a \\\\ test';\nset -e GONE;\n",
+		PowerShell: "$env:QUOTE = 'it''s a \\ test'\nRemove-Item Env:GONE -ErrorAction SilentlyContinue\n",
+	}
+	for shell, want := range tests {
+		if got := shell.Script(changes); got != want {
+			t.Errorf("%s Script() =\n%s\nwant\n%s", shell, got, want)
+		}
+	}
+}
+
+func TestScript_SkipsInvalidNames(t *testing.T) {
+	changes := []executor.EnvChange{
+		{Key: "X;touch /tmp/cdp-pwned;Y", Value: "v"},
+		{Key: "$(id)", Unset: true},
+		{Key: "OK", Value: "1"},
+	}
+	for _, shell := range Shells {
+		if got, want := shell.Script(changes), shell.Script(changes[2:]); got != want {
+			t.Errorf("%s Script() =\n%s\nwant\n%s", shell, got, want)
+		}
+	}
+}
+
+func TestScript_Bash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+
+	value := "it's \"$HOME\" `id` \\n\nnext line"
+	script := Bash.Script([]executor.EnvChange{{Key: "VALUE", Value: value}, {Key: "GONE", Unset: true}})
+	out, err := exec.Command(bash, "-c", "GONE=1\n"+script+`printf '%s|%s' "$VALUE" "${GONE-unset}"`).Output()
+	if err != nil {
+		t.Fatalf("bash failed: %v", err)
+	}
+	if string(out) != value+"|unset" {
+		t.Errorf("bash saw %q, want %q", out, value+"|unset")
+	}
+}
+
+func TestHook(t *testing.T) {
+	for _, shell := range Shells {
+		hook := shell.Hook("/opt/cdp's/cdp")
+		if !strings.Contains(hook, executor.ActivateFileEnv) || !strings.Contains(hook, "cdp") {
+			t.Errorf("%s Hook() =\n%s", shell, hook)
+		}
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	// The function runs the executable with the file and sources what it writes
+	fake := `printf 'export SEEN=%s' "$CDP_SHELL" > "$CDP_ACTIVATE_FILE"`
+	script := Bash.Hook("/bin/sh") + "cdp -c '" + strings.ReplaceAll(fake, "'", `'\''`) + "'\n" + `printf '%s' "$SEEN"`
+	out, err := exec.Command(bash, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("bash failed: %v", err)
+	}
+	if string(out) != "bash" {
+		t.Errorf("hook sourced %q, want bash", out)
+	}
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -79,6 +80,14 @@ func PrintProfileList(profiles []config.Profile, currentProfile string) {
 			nameStyle = CurrentProfileStyle
 		}
 
+		if profile.IsBroken() {
+			fmt.Printf("%s%s %s\n", marker, nameStyle.Render(profile.Name), ErrorStyle.Render("(broken)"))
+			fmt.Printf("   %s %s\n", DimStyle.Render("│"), ErrorStyle.Render("Metadata unreadable: "+profile.LoadErr.Error()))
+			fmt.Printf("   %s Run 'cdp repair %s' to rebuild it\n", DimStyle.Render("│"), profile.Name)
+			fmt.Println()
+			continue
+		}
+
 		fmt.Printf("%s%s\n", marker, nameStyle.Render(profile.Name))
 
 		if profile.Metadata.Description != "" {
@@ -143,6 +152,16 @@ func PrintProfileInfo(profile *config.Profile, isCurrent bool) {
 	if len(profile.Metadata.CustomFlags) > 0 {
 		fmt.Printf("Custom Flags: %s\n", DescriptionStyle.Render(strings.Join(profile.Metadata.CustomFlags, " ")))
 	}
+
+	// Environment (names only, values may be secrets)
+	if len(profile.Metadata.Env) > 0 {
+		keys := make([]string, 0, len(profile.Metadata.Env))
+		for key := range profile.Metadata.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Printf("Environment:  %s\n", DescriptionStyle.Render(strings.Join(keys, ", ")))
+	}
 }
 
 // formatTime formats a time.Time into a human-readable relative time string
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"strings"
@@ -127,6 +128,27 @@ func TestPrintProfileList_WithProfiles(t *testing.T) {
 	}
 }
 
+func TestPrintProfileList_Broken(t *testing.T) {
+	profiles := []config.Profile{
+		{
+			Name:    "lost",
+			Path:    "/home/user/.claude-profiles/lost",
+			LoadErr: errors.New("failed to parse metadata: unexpected end of JSON input"),
+		},
+	}
+
+	output := captureOutput(func() {
+		PrintProfileList(profiles, "")
+	})
+
+	if !strings.Contains(output, "(broken)") {
+		t.Errorf("PrintProfileList() output = %q, want it to mark the profile as broken", output)
+	}
+	if !strings.Contains(output, "cdp repair lost") {
+		t.Errorf("PrintProfileList() output = %q, want it to suggest 'cdp repair lost'", output)
+	}
+}
+
 func TestPrintProfileInfo(t *testing.T) {
 	profile := &config.Profile{
 		Name: "test",
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
 )
 
 // ShellType represents the type of shell
@@ -22,6 +24,9 @@ const (
 	aliasBlockEnd   = "# cdp-aliases-end"
 )
 
+// RCBackupSuffix is appended to the RC file name for the copy kept before each rewrite
+const RCBackupSuffix = ".cdp.bak"
+
 // AliasManager handles shell alias operations
 type AliasManager struct {
 	shellType ShellType
@@ -109,6 +114,11 @@ func (am *AliasManager) GetRCFile() string {
 	return am.rcFile
 }
 
+// GetBackupFile returns the copy of the RC file made before cdp last changed it
+func (am *AliasManager) GetBackupFile() string {
+	return am.rcFile + RCBackupSuffix
+}
+
 // InstallAliases installs aliases for the given profiles
 func (am *AliasManager) InstallAliases(profiles map[string]string) error {
 	// Read existing content
@@ -178,6 +188,31 @@ func (am *AliasManager) IsInstalled() bool {
 	return strings.Contains(content, aliasBlockStart)
 }
 
+// CheckAliasBlock reports an error if the cdp alias block markers in the RC
+// file are unbalanced, which would make install and uninstall unreliable
+func (am *AliasManager) CheckAliasBlock() error {
+	content, err := am.readRCFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read RC file: %w", err)
+	}
+
+	starts := strings.Count(content, aliasBlockStart)
+	ends := strings.Count(content, aliasBlockEnd)
+	switch {
+	case starts != ends:
+		return fmt.Errorf("%s has %d '%s' and %d '%s' markers", am.rcFile, starts, aliasBlockStart, ends, aliasBlockEnd)
+	case starts > 1:
+		return fmt.Errorf("%s has %d cdp alias blocks", am.rcFile, starts)
+	case starts == 1 && strings.Index(content, aliasBlockEnd) < strings.Index(content, aliasBlockStart):
+		return fmt.Errorf("%s has '%s' before '%s'", am.rcFile, aliasBlockEnd, aliasBlockStart)
+	}
+
+	return nil
+}
+
 // generateAliasBlock generates the alias block for the RC file
 func (am *AliasManager) generateAliasBlock(profiles map[string]string) string {
 	var sb strings.Builder
@@ -274,14 +309,36 @@ func (am *AliasManager) readRCFile() (string, error) {
 	return string(data), nil
 }
 
-// writeRCFile writes content to the RC file
+// writeRCFile atomically replaces the RC file, keeping the previous version
+// as a .cdp.bak copy
 func (am *AliasManager) writeRCFile(content string) error {
 	// Ensure parent directory exists (for fish)
 	dir := filepath.Dir(am.rcFile)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	return os.WriteFile(am.rcFile, []byte(content), 0644)
+
+	if previous, err := os.ReadFile(am.rcFile); err == nil {
+		if string(previous) == content {
+			return nil
+		}
+		// The backup is as private as the RC file itself
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(am.rcFile); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := atomicfile.WriteFile(am.GetBackupFile(), previous, perm); err != nil {
+			return fmt.Errorf("failed to back up RC file: %w", err)
+		}
+		// atomicfile keeps the mode of an existing backup, which may be looser
+		if err := os.Chmod(am.GetBackupFile(), perm); err != nil {
+			return fmt.Errorf("failed to back up RC file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return atomicfile.WriteFile(am.rcFile, []byte(content), 0644)
 }
 
 // GenerateDefaultAliases generates default short aliases for profiles
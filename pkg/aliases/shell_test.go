@@ -258,3 +258,69 @@ alias cp='cdp personal'
 		t.Errorf("aliases['cp'] = %s, want 'personal'", aliases["cp"])
 	}
 }
+
+func TestCheckAliasBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"no rc content", "", false},
+		{"balanced", "export A=1\n" + aliasBlockStart + "\nalias cw='cdp work'\n" + aliasBlockEnd + "\n", false},
+		{"missing end", aliasBlockStart + "\nalias cw='cdp work'\n", true},
+		{"missing start", "alias cw='cdp work'\n" + aliasBlockEnd + "\n", true},
+		{"reversed", aliasBlockEnd + "\n" + aliasBlockStart + "\n", true},
+		{"duplicate blocks", strings.Repeat(aliasBlockStart+"\n"+aliasBlockEnd+"\n", 2), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalHome := os.Getenv("HOME")
+			os.Setenv("HOME", tmpDir)
+			defer os.Setenv("HOME", originalHome)
+
+			am, _ := NewWithShell(Bash)
+			if tt.content != "" {
+				os.WriteFile(am.GetRCFile(), []byte(tt.content), 0644)
+			}
+
+			err := am.CheckAliasBlock()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckAliasBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstallAliases_KeepsBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", originalHome)
+
+	am, _ := NewWithShell(Bash)
+	original := "export PATH=$HOME/bin:$PATH\n"
+	os.WriteFile(am.GetRCFile(), []byte(original), 0600)
+	// A backup left from before the RC file was tightened
+	os.WriteFile(am.GetBackupFile(), []byte("old\n"), 0644)
+
+	if err := am.InstallAliases(map[string]string{"work": "cw"}); err != nil {
+		t.Fatalf("InstallAliases() error = %v", err)
+	}
+
+	backup, err := os.ReadFile(am.GetBackupFile())
+	if err != nil {
+		t.Fatalf("backup not written: %v", err)
+	}
+	if string(backup) != original {
+		t.Errorf("backup = %q, want %q", backup, original)
+	}
+
+	for _, path := range []string{am.GetRCFile(), am.GetBackupFile()} {
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", path, info.Mode().Perm())
+		}
+	}
+}
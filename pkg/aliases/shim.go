@@ -0,0 +1,179 @@
+package aliases
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/tiagokriok/cdp/pkg/atomicfile"
+)
+
+// ShimName is the file name of the shim, which stands in for claude
+const ShimName = "claude"
+
+// shimMarker identifies the shims written by cdp. It sits on the second
+// line, right after the shebang.
+const shimMarker = "# cdp-shim"
+
+// ErrNotShim is returned for a claude file that cdp did not write, such as
+// the real claude
+var ErrNotShim = errors.New("not a cdp shim")
+
+// Shim is a claude wrapper script that runs the real claude with the
+// current cdp profile, for IDEs and scripts that call claude directly
+type Shim struct {
+	// Path is the location of the shim
+	Path string
+	// Claude is the real claude the shim runs
+	Claude string
+	// Config is the cdp config.yaml the shim reads the current profile from
+	Config string
+}
+
+// DefaultShimDir returns the directory the shim is installed to by default,
+// ~/.local/bin
+func DefaultShimDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "bin"), nil
+}
+
+// ShimPath returns the location of the shim in dir
+func ShimPath(dir string) string {
+	return filepath.Join(dir, ShimName)
+}
+
+// IsShim reports whether the file at path is a cdp shim
+func IsShim(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 256)
+	n, _ := io.ReadFull(file, head)
+	lines := bytes.SplitN(head[:n], []byte("\n"), 3)
+	return len(lines) >= 2 && bytes.HasPrefix(lines[0], []byte("#!")) && bytes.HasPrefix(lines[1], []byte(shimMarker))
+}
+
+// ReadShim reads the shim at path. It returns ErrNotShim if the file is
+// not one.
+func ReadShim(path string) (*Shim, error) {
+	if !IsShim(path) {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", path, ErrNotShim)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	shim := &Shim{Path: path}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "claude":
+			shim.Claude = posixUnquote(value)
+		case "config":
+			shim.Config = posixUnquote(value)
+		}
+	}
+	return shim, nil
+}
+
+// InstallShim writes a shim to dir that runs claudePath with the profile
+// that is current in configPath. An existing shim is replaced, any other
+// claude in dir is left alone.
+func InstallShim(dir, claudePath, configPath string) (*Shim, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("the claude shim is a shell script and does not support Windows")
+	}
+
+	path := ShimPath(dir)
+	if _, err := os.Lstat(path); err == nil && !IsShim(path) {
+		return nil, fmt.Errorf("%s already exists and is %w; choose another directory with --dir", path, ErrNotShim)
+	}
+	if filepath.Clean(claudePath) == filepath.Clean(path) {
+		return nil, fmt.Errorf("the shim cannot run itself")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := atomicfile.WriteFile(path, []byte(shimScript(claudePath, configPath)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to write shim: %w", err)
+	}
+
+	return &Shim{Path: path, Claude: claudePath, Config: configPath}, nil
+}
+
+// UninstallShim removes the shim from dir. It returns an error wrapping
+// os.ErrNotExist if there is none, and ErrNotShim if dir holds another
+// claude.
+func UninstallShim(dir string) error {
+	path := ShimPath(dir)
+	if _, err := ReadShim(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// shimScript generates the shim. It reads config.yaml with sed so that
+// starting claude does not wait for cdp.
+func shimScript(claudePath, configPath string) string {
+	return `#!/bin/sh
+` + shimMarker + `: runs Claude Code with the current cdp profile.
+# Written by 'cdp shim install'; remove it with 'cdp shim uninstall'.
+claude=` + posixQuote(claudePath) + `
+config=` + posixQuote(configPath) + `
+
+# yaml_value prints a top-level scalar of config.yaml without its quotes
+yaml_value() {
+  sed -n "s/^$1:[[:space:]]*//p" "$config" | sed -e 's/^"\(.*\)"$/\1/' -e "s/^'\(.*\)'\$/\1/"
+}
+
+# A profile chosen by 'cdp run', 'cdp activate' or the caller wins
+if [ -z "${CLAUDE_CONFIG_DIR:-}" ] && [ -f "$config" ]; then
+  profile=$(yaml_value currentProfile)
+  dir=$(yaml_value profilesDir)
+  if [ -n "$profile" ] && [ -d "$dir/$profile" ]; then
+    CLAUDE_CONFIG_DIR="$dir/$profile"
+    CLAUDE_PROFILE="$profile"
+    export CLAUDE_CONFIG_DIR CLAUDE_PROFILE
+  fi
+fi
+
+if [ ! -x "$claude" ]; then
+  echo "claude: $claude no longer exists; run 'cdp shim install' again" >&2
+  exit 127
+fi
+exec "$claude" "$@"
+`
+}
+
+// posixQuote quotes s for sh
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// posixUnquote reverses posixQuote
+func posixUnquote(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+	return strings.ReplaceAll(s, `'\''`, "'")
+}
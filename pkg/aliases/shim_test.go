@@ -0,0 +1,191 @@
+package aliases
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFakeClaude creates a claude that prints its profile and arguments
+func writeFakeClaude(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "claude")
+	script := "#!/bin/sh\necho \"$CLAUDE_CONFIG_DIR|$CLAUDE_PROFILE|$*\"\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake claude: %v", err)
+	}
+	return path
+}
+
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the shim does not support Windows")
+	}
+}
+
+func TestInstallShim(t *testing.T) {
+	skipOnWindows(t)
+
+	realClaude := writeFakeClaude(t, t.TempDir())
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	dir := filepath.Join(t.TempDir(), "bin")
+
+	shim, err := InstallShim(dir, realClaude, configPath)
+	if err != nil {
+		t.Fatalf("InstallShim() error = %v", err)
+	}
+	if shim.Path != ShimPath(dir) {
+		t.Errorf("Path = %s, want %s", shim.Path, ShimPath(dir))
+	}
+
+	info, err := os.Stat(shim.Path)
+	if err != nil {
+		t.Fatalf("Failed to stat shim: %v", err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("shim mode = %v, want executable", info.Mode().Perm())
+	}
+	if !IsShim(shim.Path) {
+		t.Error("IsShim() = false, want true")
+	}
+	if IsShim(realClaude) {
+		t.Error("IsShim() on the real claude = true, want false")
+	}
+
+	read, err := ReadShim(shim.Path)
+	if err != nil {
+		t.Fatalf("ReadShim() error = %v", err)
+	}
+	if read.Claude != realClaude || read.Config != configPath {
+		t.Errorf("ReadShim() = %+v, want claude %s and config %s", read, realClaude, configPath)
+	}
+
+	// Reinstalling replaces the shim
+	if _, err := InstallShim(dir, realClaude, configPath); err != nil {
+		t.Errorf("InstallShim() over a shim error = %v", err)
+	}
+}
+
+func TestInstallShim_RefusesOtherClaude(t *testing.T) {
+	skipOnWindows(t)
+
+	dir := t.TempDir()
+	realClaude := writeFakeClaude(t, dir)
+
+	_, err := InstallShim(dir, realClaude, filepath.Join(dir, "config.yaml"))
+	if !errors.Is(err, ErrNotShim) {
+		t.Fatalf("InstallShim() error = %v, want ErrNotShim", err)
+	}
+
+	data, _ := os.ReadFile(realClaude)
+	if !strings.Contains(string(data), "CLAUDE_CONFIG_DIR") {
+		t.Error("InstallShim() overwrote the real claude")
+	}
+}
+
+func TestUninstallShim(t *testing.T) {
+	skipOnWindows(t)
+
+	dir := t.TempDir()
+	if err := UninstallShim(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("UninstallShim() without a shim error = %v, want os.ErrNotExist", err)
+	}
+
+	realClaude := writeFakeClaude(t, dir)
+	if err := UninstallShim(dir); !errors.Is(err, ErrNotShim) {
+		t.Errorf("UninstallShim() on the real claude error = %v, want ErrNotShim", err)
+	}
+	if _, err := os.Stat(realClaude); err != nil {
+		t.Errorf("UninstallShim() removed the real claude: %v", err)
+	}
+
+	shimDir := t.TempDir()
+	if _, err := InstallShim(shimDir, realClaude, filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("InstallShim() error = %v", err)
+	}
+	if err := UninstallShim(shimDir); err != nil {
+		t.Fatalf("UninstallShim() error = %v", err)
+	}
+	if _, err := os.Stat(ShimPath(shimDir)); !os.IsNotExist(err) {
+		t.Errorf("shim still exists after UninstallShim(): %v", err)
+	}
+}
+
+func TestShimScript(t *testing.T) {
+	skipOnWindows(t)
+
+	base := t.TempDir()
+	realClaude := writeFakeClaude(t, base)
+	profilesDir := filepath.Join(base, "it's profiles")
+	if err := os.MkdirAll(filepath.Join(profilesDir, "work"), 0755); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	configPath := filepath.Join(base, "config.yaml")
+	shimDir := filepath.Join(base, "bin")
+
+	shim, err := InstallShim(shimDir, realClaude, configPath)
+	if err != nil {
+		t.Fatalf("InstallShim() error = %v", err)
+	}
+
+	run := func(t *testing.T, env ...string) string {
+		t.Helper()
+		cmd := exec.Command(shim.Path, "--resume", "a b")
+		cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, env...)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("running the shim: %v", err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	t.Run("no config", func(t *testing.T) {
+		if got := run(t); got != "||--resume a b" {
+			t.Errorf("shim output = %q, want no profile", got)
+		}
+	})
+
+	config := "version: \"1.0\"\nprofilesDir: " + profilesDir + "\ncurrentProfile: work\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	t.Run("current profile", func(t *testing.T) {
+		want := filepath.Join(profilesDir, "work") + "|work|--resume a b"
+		if got := run(t); got != want {
+			t.Errorf("shim output = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("CLAUDE_CONFIG_DIR set", func(t *testing.T) {
+		if got := run(t, "CLAUDE_CONFIG_DIR=/elsewhere"); got != "/elsewhere||--resume a b" {
+			t.Errorf("shim output = %q, want the preset CLAUDE_CONFIG_DIR", got)
+		}
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		config := "version: \"1.0\"\nprofilesDir: '" + base + "'\ncurrentProfile: gone\n"
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if got := run(t); got != "||--resume a b" {
+			t.Errorf("shim output = %q, want no profile", got)
+		}
+	})
+
+	t.Run("missing claude", func(t *testing.T) {
+		if err := os.Remove(realClaude); err != nil {
+			t.Fatalf("Failed to remove fake claude: %v", err)
+		}
+		err := exec.Command(shim.Path).Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 127 {
+			t.Errorf("running the shim error = %v, want exit status 127", err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_New(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := WriteFile(path, []byte("version: 1.0\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "version: 1.0\n" {
+		t.Errorf("content = %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestWriteFile_KeepsPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(path, []byte("old"), 0640)
+	os.Chmod(path, 0640)
+
+	if err := WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("content = %q, want 'new'", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestWriteFile_FollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "zshrc")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	os.WriteFile(target, []byte("old"), 0644)
+
+	link := filepath.Join(dir, ".zshrc")
+	if err := os.Symlink("dotfiles/zshrc", link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if err := WriteFile(link, []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	info, _ := os.Lstat(link)
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("symlink was replaced by a regular file")
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != "new" {
+		t.Errorf("link target content = %q, want 'new'", data)
+	}
+}
+
+func TestWriteFile_LeavesNoTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+
+	for i := 0; i < 3; i++ {
+		if err := WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatalf("WriteFile() failed: %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		t.Errorf("directory contains %v, want only settings.json", names)
+	}
+}
+
+func TestWriteFile_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "settings.json")
+	if err := WriteFile(path, []byte("{}"), 0644); err == nil {
+		t.Error("WriteFile() should fail when the directory does not exist")
+	}
+}
@@ -0,0 +1,201 @@
+// Package encryption encrypts files with age, either to X25519 public keys
+// or with a passphrase, and decrypts them transparently when reading. The
+// output is a standard age file, so it can also be decrypted with the age
+// command line tool.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Magic starts every age encrypted file
+const Magic = "age-encryption.org/v1\n"
+
+// ErrNoKey is returned when reading an encrypted file without any key that
+// can decrypt it
+var ErrNoKey = errors.New("no key to decrypt it")
+
+// PassphraseFunc returns the passphrase. confirm is true when the passphrase
+// is used to encrypt, so a mistyped one can be caught by asking twice.
+type PassphraseFunc func(confirm bool) (string, error)
+
+// Keys are the keys used to encrypt and decrypt files
+type Keys struct {
+	// Recipients are the public keys files are encrypted to
+	Recipients []age.Recipient
+	// Identities are the private keys tried when decrypting
+	Identities []age.Identity
+	// Passphrase is asked for at most once, and only when it is needed:
+	// to encrypt a file when there are no recipients, or to decrypt a file
+	// that was encrypted with a passphrase
+	Passphrase PassphraseFunc
+
+	passphrase string
+}
+
+// ParseRecipient parses an age public key (age1...)
+func ParseRecipient(s string) (age.Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient '%s': %w", s, err)
+	}
+	return recipient, nil
+}
+
+// LoadIdentities reads the age private keys in a file, as written by
+// age-keygen
+func LoadIdentities(path string) ([]age.Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// CanEncrypt reports whether the keys can encrypt a file
+func (k *Keys) CanEncrypt() bool {
+	return k != nil && (len(k.Recipients) > 0 || k.Passphrase != nil)
+}
+
+// WithoutPassphrase returns the keys that decrypt without asking for a
+// passphrase or running the deliberately slow passphrase derivation
+func (k *Keys) WithoutPassphrase() *Keys {
+	if k == nil {
+		return nil
+	}
+	return &Keys{Identities: k.Identities}
+}
+
+// NewWriter returns a writer encrypting to w. It encrypts to the recipients,
+// or with the passphrase when there are none. The writer must be closed to
+// flush the last chunk.
+func NewWriter(w io.Writer, keys *Keys) (io.WriteCloser, error) {
+	if !keys.CanEncrypt() {
+		return nil, errors.New("no recipient or passphrase to encrypt with")
+	}
+
+	recipients := keys.Recipients
+	if len(recipients) == 0 {
+		passphrase, err := keys.getPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = []age.Recipient{recipient}
+	}
+
+	writer, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return writer, nil
+}
+
+// NewReader returns a reader of the content of r, decrypting it if it is
+// encrypted. Reports whether it was encrypted.
+func NewReader(r io.Reader, keys *Keys) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(r)
+	if !IsEncrypted(buffered) {
+		return buffered, false, nil
+	}
+
+	var identities []age.Identity
+	if keys != nil {
+		identities = append(identities, keys.Identities...)
+		if keys.Passphrase != nil {
+			identities = append(identities, &passphraseIdentity{keys: keys})
+		}
+	}
+	if len(identities) == 0 {
+		return nil, true, ErrNoKey
+	}
+
+	plain, err := age.Decrypt(buffered, identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, true, ErrNoKey
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return plain, true, nil
+}
+
+// IsEncrypted reports whether r starts with an age header, without
+// consuming it
+func IsEncrypted(r *bufio.Reader) bool {
+	header, _ := r.Peek(len(Magic))
+	return bytes.Equal(header, []byte(Magic))
+}
+
+// IsEncryptedFile reports whether the file at path is age encrypted
+func IsEncryptedFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	return IsEncrypted(bufio.NewReaderSize(file, len(Magic))), nil
+}
+
+func (k *Keys) getPassphrase(confirm bool) (string, error) {
+	if k.passphrase != "" {
+		return k.passphrase, nil
+	}
+	passphrase, err := k.Passphrase(confirm)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase is empty")
+	}
+	k.passphrase = passphrase
+	return passphrase, nil
+}
+
+// passphraseIdentity asks for the passphrase only once a file turns out to
+// be encrypted with one
+type passphraseIdentity struct {
+	keys *Keys
+}
+
+func (i *passphraseIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	if len(stanzas) != 1 || stanzas[0].Type != "scrypt" {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	passphrase, err := i.keys.getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := identity.Unwrap(stanzas)
+	if errors.Is(err, age.ErrIncorrectIdentity) {
+		// Ask again next time
+		i.keys.passphrase = ""
+		return nil, errors.New("incorrect passphrase")
+	}
+	return fileKey, err
+}
@@ -0,0 +1,160 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func encrypt(t *testing.T, keys *Keys, plaintext string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, keys)
+	if err != nil {
+		t.Fatalf("NewWriter() failed: %v", err)
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(keys *Keys, data []byte) (string, bool, error) {
+	r, encrypted, err := NewReader(bytes.NewReader(data), keys)
+	if err != nil {
+		return "", encrypted, err
+	}
+	plain, err := io.ReadAll(r)
+	return string(plain), encrypted, err
+}
+
+func TestRecipientRoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := ParseRecipient(identity.Recipient().String())
+	if err != nil {
+		t.Fatalf("ParseRecipient() failed: %v", err)
+	}
+
+	data := encrypt(t, &Keys{Recipients: []age.Recipient{recipient}}, `{"oauthAccount":"token"}`)
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		t.Fatal("output is not an age file")
+	}
+	if bytes.Contains(data, []byte("token")) {
+		t.Fatal("output contains the plaintext")
+	}
+
+	plain, encrypted, err := decrypt(&Keys{Identities: []age.Identity{identity}}, data)
+	if err != nil {
+		t.Fatalf("NewReader() failed: %v", err)
+	}
+	if !encrypted || plain != `{"oauthAccount":"token"}` {
+		t.Errorf("got %q (encrypted %v)", plain, encrypted)
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	if _, _, err := decrypt(&Keys{Identities: []age.Identity{other}}, data); !errors.Is(err, ErrNoKey) {
+		t.Errorf("NewReader() with the wrong identity = %v, want ErrNoKey", err)
+	}
+	if _, _, err := decrypt(nil, data); !errors.Is(err, ErrNoKey) {
+		t.Errorf("NewReader() without keys = %v, want ErrNoKey", err)
+	}
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	asked := 0
+	keys := &Keys{Passphrase: func(confirm bool) (string, error) {
+		asked++
+		if !confirm {
+			t.Error("encrypting should ask to confirm the passphrase")
+		}
+		return "correct horse", nil
+	}}
+	data := encrypt(t, keys, "secret")
+
+	// The passphrase is asked for once per set of keys
+	if _, _, err := decrypt(keys, data); err != nil {
+		t.Fatalf("NewReader() with the same keys failed: %v", err)
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+
+	plain, _, err := decrypt(&Keys{Passphrase: func(bool) (string, error) { return "correct horse", nil }}, data)
+	if err != nil || plain != "secret" {
+		t.Fatalf("NewReader() = %q, %v", plain, err)
+	}
+
+	if _, _, err := decrypt(&Keys{Passphrase: func(bool) (string, error) { return "wrong", nil }}, data); err == nil {
+		t.Error("NewReader() should fail with the wrong passphrase")
+	}
+	if _, _, err := decrypt(keys.WithoutPassphrase(), data); !errors.Is(err, ErrNoKey) {
+		t.Errorf("NewReader() without the passphrase = %v, want ErrNoKey", err)
+	}
+}
+
+func TestPassphraseNotAskedForRecipientFiles(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	data := encrypt(t, &Keys{Recipients: []age.Recipient{identity.Recipient()}}, "secret")
+
+	keys := &Keys{
+		Identities: []age.Identity{identity},
+		Passphrase: func(bool) (string, error) {
+			t.Error("passphrase should not be asked for")
+			return "", nil
+		},
+	}
+	if plain, _, err := decrypt(keys, data); err != nil || plain != "secret" {
+		t.Errorf("NewReader() = %q, %v", plain, err)
+	}
+}
+
+func TestNewReader_Plaintext(t *testing.T) {
+	plain, encrypted, err := decrypt(nil, []byte("plain tar.gz"))
+	if err != nil {
+		t.Fatalf("NewReader() failed: %v", err)
+	}
+	if encrypted || plain != "plain tar.gz" {
+		t.Errorf("got %q (encrypted %v)", plain, encrypted)
+	}
+}
+
+func TestNewWriter_NoKeys(t *testing.T) {
+	if _, err := NewWriter(io.Discard, &Keys{}); err == nil {
+		t.Error("NewWriter() should fail without a recipient or passphrase")
+	}
+}
+
+func TestLoadIdentities(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	path := filepath.Join(t.TempDir(), "identity.txt")
+	os.WriteFile(path, []byte("# created: today\n"+identity.String()+"\n"), 0600)
+
+	identities, err := LoadIdentities(path)
+	if err != nil {
+		t.Fatalf("LoadIdentities() failed: %v", err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("got %d identities, want 1", len(identities))
+	}
+
+	if _, err := ParseRecipient("not-a-key"); err == nil {
+		t.Error("ParseRecipient() should reject invalid keys")
+	}
+
+	encrypted, err := IsEncryptedFile(path)
+	if err != nil || encrypted {
+		t.Errorf("IsEncryptedFile() = %v, %v for a plain file", encrypted, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package filelock provides advisory, inter-process file locks.
+//
+// Locks are exclusive and reentrant within a process: acquiring a lock the
+// process already holds succeeds immediately and must be released as many
+// times as it was acquired.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned when a lock could not be acquired in time
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// pollInterval is how often a held lock is retried
+const pollInterval = 50 * time.Millisecond
+
+var (
+	mu   sync.Mutex
+	held = make(map[string]*Lock)
+)
+
+// Lock is an acquired file lock
+type Lock struct {
+	path  string
+	file  *os.File
+	count int
+}
+
+// Acquire takes an exclusive lock on path, creating the file and its
+// directory if needed. It waits up to timeout for other processes to
+// release the lock and returns ErrTimeout if they do not.
+func Acquire(path string, timeout time.Duration) (*Lock, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve lock path: %w", err)
+	}
+
+	mu.Lock()
+	if lock, ok := held[absPath]; ok {
+		lock.count++
+		mu.Unlock()
+		return lock, nil
+	}
+	mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	file, err := os.OpenFile(absPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", absPath, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+
+	lock := &Lock{path: absPath, file: file, count: 1}
+	mu.Lock()
+	held[absPath] = lock
+	mu.Unlock()
+
+	return lock, nil
+}
+
+// Release releases the lock once the process has released it as often as it
+// was acquired
+func (l *Lock) Release() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	l.count--
+	if l.count > 0 {
+		return nil
+	}
+	delete(held, l.path)
+
+	err := unlock(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package filelock
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHelperHoldLock is run in a child process by the contention tests. It
+// holds the lock until its stdin is closed.
+func TestHelperHoldLock(t *testing.T) {
+	path := os.Getenv("FILELOCK_HELPER_PATH")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+
+	lock, err := Acquire(path, time.Second)
+	if err != nil {
+		t.Fatalf("helper failed to acquire lock: %v", err)
+	}
+	os.Stdout.WriteString("locked\n")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	lock.Release()
+}
+
+// holdInOtherProcess locks path in a child process and returns a function
+// that makes the child release it and exit
+func holdInOtherProcess(t *testing.T, path string) func() {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHoldLock$")
+	cmd.Env = append(os.Environ(), "FILELOCK_HELPER_PATH="+path)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start helper: %v", err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		t.Fatalf("helper did not acquire the lock: %q, %v", line, err)
+	}
+
+	return func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+}
+
+func TestAcquire_Reentrant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "work.lock")
+
+	outer, err := Acquire(path, time.Second)
+	if err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	inner, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("reentrant Acquire() failed: %v", err)
+	}
+
+	inner.Release()
+	if _, ok := held[outer.path]; !ok {
+		t.Error("lock released before the outer holder released it")
+	}
+	outer.Release()
+	if _, ok := held[outer.path]; ok {
+		t.Error("lock still held after all releases")
+	}
+}
+
+func TestAcquire_WaitsForOtherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	release := holdInOtherProcess(t, path)
+
+	start := time.Now()
+	_, err := Acquire(path, 200*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Acquire() error = %v, want ErrTimeout", err)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Error("Acquire() gave up before the timeout")
+	}
+
+	// Once the other process releases the lock, waiting succeeds
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		release()
+	}()
+
+	lock, err := Acquire(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Acquire() after release failed: %v", err)
+	}
+	lock.Release()
+}